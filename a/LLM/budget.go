@@ -0,0 +1,201 @@
+package LLM
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	ark "github.com/sashabaranov/go-openai"
+)
+
+// Budget 上下文的 token 预算
+type Budget struct {
+	// 发给大模型的上下文超过这个数就把较早的对话总结掉, 0 表示不限制
+	MaxTokens int
+	// 总结时至少原样保留最近这么多 token 的对话
+	KeepRecentTokens int
+}
+
+// 总结较早对话最多等多久
+const summarizeTimeout = 30 * time.Second
+
+const summarizePrompt = "你负责压缩对话历史。请把下面的对话总结成简短的要点, " +
+	"保留用户的身份、偏好、已经确认的事实和还没完成的事情, 省略寒暄, 不超过300字, 只输出总结本身。"
+
+// EstimateTokens 粗略估计消息的 token 数
+// 中文等非 ASCII 字符按每字 1 个, ASCII 按每 4 个字符 1 个, 每条消息另加固定开销
+func EstimateTokens(messages ...ark.ChatCompletionMessage) int {
+	total := 0
+	for _, message := range messages {
+		total += 4 + estimateText(message.Content)
+		for _, toolCall := range message.ToolCalls {
+			total += 8 + estimateText(toolCall.Function.Name) + estimateText(toolCall.Function.Arguments)
+		}
+	}
+	return total
+}
+
+func estimateText(s string) int {
+	ascii, other := 0, 0
+	for _, r := range s {
+		if r < utf8.RuneSelf {
+			ascii++
+		} else {
+			other++
+		}
+	}
+	return other + (ascii+3)/4
+}
+
+// prompt 实际发给大模型的上下文: 开场消息、情感标签的说明、环境信息、较早对话的总结和最近的对话, 调用时需持有 c.mu
+func (c *LLMContext) prompt() []ark.ChatCompletionMessage {
+	opening := min(c.opening, len(c.messages))
+	start := max(c.summarized, opening)
+	prompt := make([]ark.ChatCompletionMessage, 0, len(c.messages)-start+opening+3)
+	prompt = append(prompt, c.messages[:opening]...)
+	if c.opts.EmotionTags {
+		prompt = append(prompt, ark.ChatCompletionMessage{
+			Role:    ark.ChatMessageRoleSystem,
+			Content: emotionPrompt,
+		})
+	}
+	if c.environment != "" {
+		prompt = append(prompt, ark.ChatCompletionMessage{
+			Role:    ark.ChatMessageRoleSystem,
+			Content: c.environment,
+		})
+	}
+	if c.summary != "" {
+		prompt = append(prompt, ark.ChatCompletionMessage{
+			Role:    ark.ChatMessageRoleSystem,
+			Content: "之前的对话总结: " + c.summary,
+		})
+	}
+	return append(prompt, c.messages[start:]...)
+}
+
+// cutIndex 找到总结的截止位置, 之后至少还有 keep 个 token 的对话原样保留
+// 只在用户消息处截断, 这样工具调用和工具结果总是在同一边; 调用时需持有 c.mu
+func (c *LLMContext) cutIndex(keep int) int {
+	start := max(c.summarized, c.opening)
+	kept := 0
+	for i := len(c.messages) - 1; i > start; i-- {
+		kept += EstimateTokens(c.messages[i])
+		if kept >= keep && c.messages[i].Role == ark.ChatMessageRoleUser {
+			return i
+		}
+	}
+	return start
+}
+
+// compact 上下文超过预算时把较早的对话交给大模型总结
+// 在回复结束后调用, 不持有 askMu, 同一时间只有一个总结在进行
+func (c *LLMContext) compact() {
+	budget := c.opts.Budget
+	if budget.MaxTokens <= 0 {
+		return
+	}
+	c.mu.Lock()
+	if c.compacting {
+		c.mu.Unlock()
+		return
+	}
+	tokens := EstimateTokens(c.prompt()...)
+	if tokens <= budget.MaxTokens {
+		c.mu.Unlock()
+		return
+	}
+	start := max(c.summarized, c.opening)
+	cut := c.cutIndex(budget.KeepRecentTokens)
+	if cut <= start {
+		c.mu.Unlock()
+		log.Printf("上下文约 %d token, 超过预算 %d, 但最近的对话无法再压缩", tokens, budget.MaxTokens)
+		return
+	}
+	older := append([]ark.ChatCompletionMessage(nil), c.messages[start:cut]...)
+	previous := c.summary
+	c.compacting, c.compactStart, c.compactCut, c.compactStale = true, start, cut, false
+	c.mu.Unlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), summarizeTimeout)
+	defer cancel()
+	summary, err := c.summarize(ctx, previous, older)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.compacting = false
+	if err != nil {
+		log.Printf("总结较早的对话失败, 下一轮再试: %v", err)
+		return
+	}
+	// 总结期间被打断的回答改动了要总结的消息, 这份总结已经过时
+	if c.compactStale || max(c.summarized, c.opening) != c.compactStart {
+		log.Printf("总结期间较早的对话有改动, 放弃这次总结, 下一轮再试")
+		return
+	}
+	c.summary = summary
+	c.summarized = c.compactCut
+	c.record(func(r Recorder) error { return r.Summarize(c.summarized, summary) })
+	log.Printf("上下文约 %d token, 超过预算 %d, 已把 %d 条较早的消息总结为摘要, 现在约 %d token",
+		tokens, budget.MaxTokens, len(older), EstimateTokens(c.prompt()...))
+}
+
+// compactChanged 第 index 条消息被修改或删除时调用, 后台的总结按新的位置截断或作废, 调用时需持有 c.mu
+func (c *LLMContext) compactChanged(index int, removed bool) {
+	if !c.compacting || index >= c.compactCut {
+		return
+	}
+	if index >= c.compactStart {
+		c.compactStale = true
+	}
+	if removed {
+		c.compactCut--
+		if index < c.compactStart {
+			c.compactStart--
+		}
+	}
+}
+
+// summarize 把之前的总结和新一段较早的对话合并成一份总结
+func (c *LLMContext) summarize(ctx context.Context, previous string, older []ark.ChatCompletionMessage) (string, error) {
+	var b strings.Builder
+	if previous != "" {
+		b.WriteString("之前的总结: ")
+		b.WriteString(previous)
+		b.WriteString("\n\n接下来的对话:\n")
+	}
+	for _, message := range older {
+		switch message.Role {
+		case ark.ChatMessageRoleUser:
+			fmt.Fprintf(&b, "用户: %s\n", message.Content)
+		case ark.ChatMessageRoleAssistant:
+			if message.Content != "" {
+				fmt.Fprintf(&b, "助手: %s\n", message.Content)
+			}
+			for _, toolCall := range message.ToolCalls {
+				fmt.Fprintf(&b, "助手调用工具 %s(%s)\n", toolCall.Function.Name, toolCall.Function.Arguments)
+			}
+		case ark.ChatMessageRoleTool:
+			fmt.Fprintf(&b, "工具 %s 返回: %s\n", message.Name, message.Content)
+		default:
+			fmt.Fprintf(&b, "%s: %s\n", message.Role, message.Content)
+		}
+	}
+
+	resp, err := c.provider.CreateChatCompletion(ctx, ark.ChatCompletionRequest{
+		Messages: []ark.ChatCompletionMessage{
+			{Role: ark.ChatMessageRoleSystem, Content: summarizePrompt},
+			{Role: ark.ChatMessageRoleUser, Content: b.String()},
+		},
+	})
+	if err != nil {
+		return "", err
+	}
+	if len(resp.Choices) == 0 || strings.TrimSpace(resp.Choices[0].Message.Content) == "" {
+		return "", fmt.Errorf("%s 没有返回总结", c.provider.Name())
+	}
+	return strings.TrimSpace(resp.Choices[0].Message.Content), nil
+}
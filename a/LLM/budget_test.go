@@ -0,0 +1,168 @@
+package LLM
+
+import (
+	"context"
+	"main/LLM/llm/LLMConfigs"
+	"strings"
+	"testing"
+	"time"
+
+	ark "github.com/sashabaranov/go-openai"
+)
+
+// slowSummarizer 回答照常, 总结要等 release 关闭才返回
+type slowSummarizer struct {
+	*LLMConfigs.ScriptedProvider
+	started chan struct{}
+	release chan struct{}
+}
+
+func newSlowSummarizer() *slowSummarizer {
+	return &slowSummarizer{
+		ScriptedProvider: LLMConfigs.NewScriptedProvider("fake"),
+		started:          make(chan struct{}, 1),
+		release:          make(chan struct{}),
+	}
+}
+
+func (p *slowSummarizer) CreateChatCompletion(ctx context.Context, request ark.ChatCompletionRequest) (ark.ChatCompletionResponse, error) {
+	p.started <- struct{}{}
+	select {
+	case <-p.release:
+	case <-ctx.Done():
+		return ark.ChatCompletionResponse{}, ctx.Err()
+	}
+	return ark.ChatCompletionResponse{Choices: []ark.ChatCompletionChoice{
+		{Message: ark.ChatCompletionMessage{Role: ark.ChatMessageRoleAssistant, Content: "用户打过招呼"}},
+	}}, nil
+}
+
+// memoryRecorder 记下总结
+type memoryRecorder struct {
+	summarized int
+	summary    string
+}
+
+func (r *memoryRecorder) Append(messages ...ark.ChatCompletionMessage) error { return nil }
+func (r *memoryRecorder) Replace(index int, content string) error            { return nil }
+func (r *memoryRecorder) Remove(index int) error                             { return nil }
+func (r *memoryRecorder) Summarize(summarized int, summary string) error {
+	r.summarized, r.summary = summarized, summary
+	return nil
+}
+
+// smallBudget 让两轮对话就超出预算, 只保留最近一轮
+func smallBudget() Options {
+	opts := DefaultOptions()
+	opts.Budget = Budget{MaxTokens: 20, KeepRecentTokens: 1}
+	return opts
+}
+
+// waitCompacted 等后台的总结结束
+func waitCompacted(t *testing.T, c *LLMContext) {
+	t.Helper()
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		c.mu.Lock()
+		compacting := c.compacting
+		c.mu.Unlock()
+		if !compacting {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("总结没有结束")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestCompactDoesNotBlockAsk(t *testing.T) {
+	provider := newSlowSummarizer()
+	c := NewLLMContextWithMessages(provider, []ark.ChatCompletionMessage{{Role: ark.ChatMessageRoleSystem, Content: "你是助手"}}, nil, smallBudget())
+	recorder := &memoryRecorder{}
+	c.SetRecorder(recorder)
+
+	collect(c.Ask(context.Background(), "你好, 我叫小明"))
+	collect(c.Ask(context.Background(), "今天天气不错啊"))
+	<-provider.started
+
+	// 总结还没返回, 下一个问题照常回答
+	done := make(chan string)
+	go func() {
+		text, _ := collect(c.Ask(context.Background(), "讲个笑话"))
+		done <- text
+	}()
+	select {
+	case text := <-done:
+		if text != "你说的是: 讲个笑话" {
+			t.Errorf("回答 %q", text)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("总结期间提问被卡住")
+	}
+
+	close(provider.release)
+	waitCompacted(t, c)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.summary != "用户打过招呼" || c.summarized != 3 {
+		t.Errorf("总结 %q 截止到 %d, 应截止到第二个问题 3", c.summary, c.summarized)
+	}
+	if recorder.summary != c.summary || recorder.summarized != c.summarized {
+		t.Errorf("总结应记入历史记录: %+v", recorder)
+	}
+	prompt := c.prompt()
+	var summary int
+	for i, message := range prompt {
+		if strings.Contains(message.Content, "用户打过招呼") {
+			summary = i
+		}
+	}
+	if summary == 0 || prompt[summary+1].Content != "今天天气不错啊" {
+		t.Errorf("上下文应为开场、总结和最近的对话: %+v", prompt)
+	}
+}
+
+func TestCompactStaleAfterTruncate(t *testing.T) {
+	provider := newSlowSummarizer()
+	c := NewLLMContextWithMessages(provider, []ark.ChatCompletionMessage{{Role: ark.ChatMessageRoleSystem, Content: "你是助手"}}, nil, smallBudget())
+	recorder := &memoryRecorder{}
+	c.SetRecorder(recorder)
+
+	first := c.Ask(context.Background(), "你好, 我叫小明")
+	collect(first)
+	collect(c.Ask(context.Background(), "今天天气不错啊"))
+	<-provider.started
+
+	// 总结期间第一轮的回答被删掉, 要总结的消息变了, 截止位置也前移
+	first.Truncate("")
+	c.mu.Lock()
+	if c.compactCut != 2 || !c.compactStale {
+		t.Errorf("截止位置应前移到 2 并作废, 得到 %d %v", c.compactCut, c.compactStale)
+	}
+	c.mu.Unlock()
+
+	close(provider.release)
+	waitCompacted(t, c)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.summary != "" || c.summarized != 0 || recorder.summary != "" {
+		t.Errorf("过时的总结不应生效: %q %d", c.summary, c.summarized)
+	}
+}
+
+func TestCompactChangedAfterCut(t *testing.T) {
+	c := &LLMContext{compacting: true, compactStart: 1, compactCut: 3}
+	c.compactChanged(4, true)
+	if c.compactCut != 3 || c.compactStale {
+		t.Errorf("截止位置之后的改动不影响总结: %d %v", c.compactCut, c.compactStale)
+	}
+	c.compactChanged(0, true)
+	if c.compactStart != 0 || c.compactCut != 2 || c.compactStale {
+		t.Errorf("总结范围之前删除一条, 整体前移: %d %d %v", c.compactStart, c.compactCut, c.compactStale)
+	}
+	c.compactChanged(1, false)
+	if !c.compactStale {
+		t.Error("总结范围内的内容被修改, 总结应作废")
+	}
+}
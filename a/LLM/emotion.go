@@ -0,0 +1,142 @@
+package LLM
+
+import (
+	"strconv"
+	"strings"
+)
+
+// 大模型在回答里用 [happy] 或 [happy:150] 这样的标签标出接下来的情感, 直到下一个标签或本次回答结束
+// 标签在显示和合成之前去掉, 情感交给语音合成, 音色不支持时按中性合成
+
+// Emotion 一句话的情感, Category 为空表示中性
+type Emotion struct {
+	Category  string
+	Intensity int // 情感程度 [50,200], 0 表示默认的 100
+}
+
+// emotionNames 标签里可以写的情感, 中文别名方便中文模型
+var emotionNames = map[string]string{
+	"neutral":   "neutral",
+	"happy":     "happy",
+	"sad":       "sad",
+	"angry":     "angry",
+	"fear":      "fear",
+	"sajiao":    "sajiao",
+	"amaze":     "amaze",
+	"disgusted": "disgusted",
+	"peaceful":  "peaceful",
+	"中性":        "neutral",
+	"开心":        "happy",
+	"高兴":        "happy",
+	"难过":        "sad",
+	"伤心":        "sad",
+	"生气":        "angry",
+	"害怕":        "fear",
+	"撒娇":        "sajiao",
+	"惊讶":        "amaze",
+	"厌恶":        "disgusted",
+	"平静":        "peaceful",
+}
+
+const emotionPrompt = "回答会被转成语音. 语气有明显变化时, 在那句话开头加一个情感标签, 比如 [happy]、[sad:150], " +
+	"可选 neutral, happy, sad, angry, fear, sajiao, amaze, disgusted, peaceful, 冒号后面是 50~200 的强度, 可以省略. " +
+	"标签对之后的句子一直有效, 不要解释标签, 也不要在其他地方使用方括号."
+
+// 标签最长的字节数, 超过后不再当作标签等待
+const maxEmotionTag = 24
+
+// parseEmotionTag 解析 [ 和 ] 之间的内容, 不是认识的情感时 ok 为 false
+func parseEmotionTag(tag string) (Emotion, bool) {
+	name, level, hasLevel := strings.Cut(strings.TrimSpace(tag), ":")
+	category, ok := emotionNames[strings.ToLower(strings.TrimSpace(name))]
+	if !ok {
+		return Emotion{}, false
+	}
+	e := Emotion{Category: category}
+	if hasLevel {
+		intensity, err := strconv.Atoi(strings.TrimSpace(level))
+		if err != nil {
+			return Emotion{}, false
+		}
+		e.Intensity = min(max(intensity, 50), 200)
+	}
+	if e.Category == "neutral" {
+		e = Emotion{}
+	}
+	return e, true
+}
+
+// StripEmotion 去掉一句话里的情感标签, 返回去掉后的文字和这句话的情感
+// 没有标签时沿用 current, 有多个时最后一个生效
+func StripEmotion(text string, current Emotion) (string, Emotion) {
+	if !strings.Contains(text, "[") {
+		return text, current
+	}
+	var out strings.Builder
+	for {
+		open := strings.IndexByte(text, '[')
+		if open < 0 {
+			break
+		}
+		end := strings.IndexByte(text[open:], ']')
+		if end < 0 {
+			break
+		}
+		end += open
+		if e, ok := parseEmotionTag(text[open+1 : end]); ok {
+			out.WriteString(text[:open])
+			current = e
+		} else {
+			out.WriteString(text[:end+1])
+		}
+		text = text[end+1:]
+	}
+	out.WriteString(text)
+	return strings.TrimSpace(out.String()), current
+}
+
+// EmotionStripper 从流式增量里去掉情感标签, 标签可能被拆在几段增量里
+type EmotionStripper struct {
+	pending string // 以 [ 开头, 还不知道是不是标签的内容
+}
+
+// Feed 追加一段增量, 返回可以显示的文字
+func (s *EmotionStripper) Feed(delta string) string {
+	text := s.pending + delta
+	s.pending = ""
+	var out strings.Builder
+	for text != "" {
+		open := strings.IndexByte(text, '[')
+		if open < 0 {
+			out.WriteString(text)
+			break
+		}
+		out.WriteString(text[:open])
+		text = text[open:]
+		end := strings.IndexByte(text, ']')
+		if end < 0 {
+			if len(text) <= maxEmotionTag {
+				// 等下一段增量
+				s.pending = text
+				break
+			}
+			out.WriteString(text[:1])
+			text = text[1:]
+			continue
+		}
+		if _, ok := parseEmotionTag(text[1:end]); !ok {
+			out.WriteString(text[:1])
+			text = text[1:]
+			continue
+		}
+		text = text[end+1:]
+	}
+	return out.String()
+}
+
+// Flush 回答结束时返回还没确定的内容
+func (s *EmotionStripper) Flush() string {
+	rest := s.pending
+	s.pending = ""
+	return rest
+}
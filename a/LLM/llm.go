@@ -1,52 +1,265 @@
 package LLM
 
 import (
+	"context"
 	ark "github.com/sashabaranov/go-openai"
+	"log"
 	"main/LLM/llm/server"
+	"main/LLM/llm/tools"
 	"sync"
 )
 
+// Recorder 保存历史记录的每一次变化, 由 history.Log 实现
+type Recorder interface {
+	Append(messages ...ark.ChatCompletionMessage) error
+	Replace(index int, content string) error
+	Remove(index int) error
+	// Summarize 较早的对话 messages[opening:summarized] 总结为 summary
+	Summarize(summarized int, summary string) error
+}
+
+// Options 上下文的设置, 创建时确定, 由 main 根据配置填写
+type Options struct {
+	// 一次提问最多连续调用几轮工具, 不大于 0 时使用 server.DefaultMaxToolRounds
+	MaxToolRounds int
+	// 上下文的 token 预算, MaxTokens 为 0 时不总结
+	Budget Budget
+	// 是否让大模型用情感标签标出语气, 见 StripEmotion
+	EmotionTags bool
+}
+
+// DefaultOptions 配置文件的默认值
+func DefaultOptions() Options {
+	return Options{
+		MaxToolRounds: server.DefaultMaxToolRounds,
+		Budget:        Budget{MaxTokens: 8000, KeepRecentTokens: 2000},
+		EmotionTags:   true,
+	}
+}
+
 type LLMContext struct {
+	provider Provider
+	opts     Options
+	// 本会话可用的工具, nil 表示全部内置工具
+	tools *tools.Registry
+	// 同一时间只处理一个问题
+	askMu sync.Mutex
+	// 保护 messages 和 Reply 的状态, 只在短时间内持有
+	mu       sync.Mutex
 	messages []ark.ChatCompletionMessage
-	input    chan string
-	output   chan string
-	wg       sync.WaitGroup
+	// 开头的系统设定、示例对话等开场消息条数, 总结时原样保留
+	opening int
+	// 较早对话的总结, 替代 messages[opening:summarized] 发给大模型
+	summary    string
+	summarized int
+	// 后台正在总结 messages[compactStart:compactCut], 期间这段被改动时总结作废
+	compacting   bool
+	compactStart int
+	compactCut   int
+	compactStale bool
+	// 环境信息, 比如用户当前的位置, 每次请求都放在开场消息后面, 不写入历史记录
+	environment string
+	// 为 nil 时不保存
+	recorder Recorder
 }
 
-func NewLLMContext(system, user string) *LLMContext {
+// Chunk 流式回复的一块, Delta 和 Sentence 每次只有一个不为空
+type Chunk struct {
+	Delta    string  // 文本增量, 用于实时显示, 已去掉情感标签
+	Sentence string  // 已完整的一句话, 用于语音合成
+	Emotion  Emotion // Sentence 的情感
+}
+
+// Reply 一次提问的回复
+type Reply struct {
+	// Chunks 文本增量和完整句子按生成顺序交替出现, 回复结束后关闭
+	Chunks <-chan Chunk
+
+	llm    *LLMContext
+	done   bool    // 回复已经写入历史记录
+	index  int     // 本轮回答在历史记录中的位置, -1 表示没有
+	spoken *string // 被打断时实际说出的内容
+}
+
+func NewLLMContext(provider Provider, system, user string, opts Options) *LLMContext {
 	ctx := &LLMContext{
-		input:  make(chan string),
-		output: make(chan string),
+		provider: provider,
+		opts:     opts,
 	}
 	//log.Printf("system: %s, user: %s", system, user)
 	ctx.messages = server.InitMessage(system, user)
+	ctx.opening = len(ctx.messages)
 	//log.Printf("messages: %s", ctx.messages)
+	return ctx
+}
+
+// NewLLMContextWithMessages 用现成的开场消息创建上下文, 例如角色设定, 只允许使用 toolset 中的工具
+func NewLLMContextWithMessages(provider Provider, messages []ark.ChatCompletionMessage, toolset *tools.Registry, opts Options) *LLMContext {
+	return &LLMContext{
+		provider: provider,
+		opts:     opts,
+		tools:    toolset,
+		messages: messages,
+		opening:  len(messages),
+	}
+}
+
+// Restore 接上之前保存的对话, 不会再次记入历史记录
+func (c *LLMContext) Restore(messages []ark.ChatCompletionMessage) {
+	c.mu.Lock()
+	c.messages = append(c.messages, messages...)
+	c.mu.Unlock()
+}
+
+// RestoreSummary 接上之前保存的总结, 和 Restore 一样不会再次记入历史记录
+func (c *LLMContext) RestoreSummary(summary string, summarized int) {
+	c.mu.Lock()
+	if summary != "" && summarized > c.opening && summarized <= len(c.messages) {
+		c.summary = summary
+		c.summarized = summarized
+	}
+	c.mu.Unlock()
+}
+
+// SetRecorder 之后历史记录的变化都交给 r 保存
+func (c *LLMContext) SetRecorder(r Recorder) {
+	c.mu.Lock()
+	c.recorder = r
+	c.mu.Unlock()
+}
+
+// SetEnvironment 设置随每次请求发给大模型的环境信息, 为空时不发送
+func (c *LLMContext) SetEnvironment(note string) {
+	c.mu.Lock()
+	c.environment = note
+	c.mu.Unlock()
+}
+
+// Messages 当前历史记录的副本
+func (c *LLMContext) Messages() []ark.ChatCompletionMessage {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]ark.ChatCompletionMessage(nil), c.messages...)
+}
+
+// record 调用时需持有 c.mu, 保存失败只记日志, 不影响对话
+func (c *LLMContext) record(save func(r Recorder) error) {
+	if c.recorder == nil {
+		return
+	}
+	if err := save(c.recorder); err != nil {
+		log.Printf("保存历史记录失败: %v", err)
+	}
+}
 
-	// 启动后台处理协程
-	ctx.wg.Add(1)
+// Ask 提问并流式返回回复, ctx 取消后停止生成
+func (c *LLMContext) Ask(ctx context.Context, text string) *Reply {
+	chunks := make(chan Chunk, 16)
+	reply := &Reply{Chunks: chunks, llm: c, index: -1}
 	go func() {
-		defer ctx.wg.Done()
-		for userText := range ctx.input {
-			if userText == "" {
-				continue
-			}
-			answer, updatedMessages := server.GetLLMAnswer(userText, ctx.messages)
-			ctx.messages = updatedMessages
-			ctx.output <- answer
+		if text == "" {
+			close(chunks)
+			return
 		}
-		close(ctx.output)
+		c.askMu.Lock()
+		c.answer(ctx, text, reply, chunks)
+		c.askMu.Unlock()
+		// 回复结束后再检查上下文是否超出预算, 总结期间下一个问题照常回答
+		c.compact()
 	}()
+	return reply
+}
 
-	return ctx
+// answer 生成一次回复, 结束后关闭 chunks
+func (c *LLMContext) answer(ctx context.Context, text string, reply *Reply, chunks chan<- Chunk) {
+	defer close(chunks)
+
+	c.mu.Lock()
+	prompt := c.prompt()
+	c.mu.Unlock()
+
+	// 历史记录里保留情感标签, 大模型能接着用同样的方式回答, 发出去的内容都去掉标签
+	var splitter SentenceSplitter
+	var stripper EmotionStripper
+	var emotion Emotion
+	sendSentence := func(sentence string) {
+		sentence, emotion = StripEmotion(sentence, emotion)
+		if sentence != "" {
+			chunks <- Chunk{Sentence: sentence, Emotion: emotion}
+		}
+	}
+	_, updatedMessages := server.GetLLMAnswer(ctx, c.provider, c.tools, c.opts.MaxToolRounds, text, prompt, func(delta string) {
+		if shown := stripper.Feed(delta); shown != "" {
+			chunks <- Chunk{Delta: shown}
+		}
+		for _, sentence := range splitter.Feed(delta) {
+			sendSentence(sentence)
+		}
+	})
+	if ctx.Err() == nil {
+		if shown := stripper.Flush(); shown != "" {
+			chunks <- Chunk{Delta: shown}
+		}
+		if rest := splitter.Flush(); rest != "" {
+			sendSentence(rest)
+		}
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	// 本轮新增的用户问题、工具调用、工具结果和回答
+	added := updatedMessages[len(prompt):]
+	base := len(c.messages)
+	c.messages = append(c.messages, added...)
+	if len(added) > 0 {
+		c.record(func(r Recorder) error { return r.Append(added...) })
+	}
+	if last := len(c.messages) - 1; last >= base && isPlainAnswer(c.messages[last]) {
+		reply.index = last
+	}
+	reply.done = true
+	if reply.spoken != nil {
+		c.applySpoken(reply)
+	}
 }
 
-func (c *LLMContext) Ask(text string) <-chan string {
-	result := make(chan string, 1)
-	c.input <- text
-	go func() {
-		answer := <-c.output // 等待结果
-		result <- answer
-		close(result)
-	}()
-	return result
+// Truncate 回答被打断时调用, 历史记录中本轮回答替换为实际说出的内容
+// 回复还在生成时会等生成结束后再替换
+func (r *Reply) Truncate(spoken string) {
+	r.llm.mu.Lock()
+	defer r.llm.mu.Unlock()
+	r.spoken = &spoken
+	if r.done {
+		r.llm.applySpoken(r)
+	}
+}
+
+// applySpoken 调用时需持有 c.mu
+func (c *LLMContext) applySpoken(reply *Reply) {
+	spoken := *reply.spoken
+	if reply.index >= 0 && reply.index < len(c.messages) {
+		if spoken == "" {
+			// 一句都没说出去, 当作没有回答
+			index := reply.index
+			c.messages = append(c.messages[:index], c.messages[index+1:]...)
+			if index < c.summarized {
+				c.summarized--
+			}
+			c.compactChanged(index, true)
+			reply.index = -1
+			c.record(func(r Recorder) error { return r.Remove(index) })
+		} else {
+			c.messages[reply.index].Content = spoken
+			c.compactChanged(reply.index, false)
+			c.record(func(r Recorder) error { return r.Replace(reply.index, spoken) })
+		}
+	} else if spoken != "" {
+		c.messages = server.AddAssistantMessage(spoken, c.messages)
+		reply.index = len(c.messages) - 1
+		c.record(func(r Recorder) error { return r.Append(c.messages[reply.index]) })
+	}
+}
+
+func isPlainAnswer(message ark.ChatCompletionMessage) bool {
+	return message.Role == ark.ChatMessageRoleAssistant && len(message.ToolCalls) == 0
 }
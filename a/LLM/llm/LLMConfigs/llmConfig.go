@@ -1,19 +1,59 @@
 package LLMConfigs
 
 import (
+	"context"
+
 	ark "github.com/sashabaranov/go-openai"
-	"main/client"
 )
 
-const (
-	DoubaoAPIKey string = client.DoubaoAPIKey
-	Model        string = client.Model
-	BaseURL      string = client.BaseURL
-)
+// Provider 大模型后端
+type Provider interface {
+	Name() string
+	CreateChatCompletion(ctx context.Context, request ark.ChatCompletionRequest) (ark.ChatCompletionResponse, error)
+	CreateChatCompletionStream(ctx context.Context, request ark.ChatCompletionRequest) (ChatStream, error)
+}
+
+// ChatStream 流式回复, Recv 读完后返回 io.EOF
+type ChatStream interface {
+	Recv() (ark.ChatCompletionStreamResponse, error)
+	Close() error
+}
+
+// OpenAIProvider 任何兼容 OpenAI 接口的服务: 豆包(方舟), Ollama, llama.cpp server, vLLM 等
+type OpenAIProvider struct {
+	name   string
+	model  string
+	client *ark.Client
+}
+
+// NewOpenAIProvider 本地服务一般不校验 apiKey, 可以传空
+func NewOpenAIProvider(name, baseURL, apiKey, model string) *OpenAIProvider {
+	config := ark.DefaultConfig(apiKey)
+	config.BaseURL = baseURL
+	return &OpenAIProvider{
+		name:   name,
+		model:  model,
+		client: ark.NewClientWithConfig(config),
+	}
+}
+
+func (p *OpenAIProvider) Name() string {
+	return p.name
+}
+
+// CreateChatCompletion 请求中没有指定模型时使用该后端的模型
+func (p *OpenAIProvider) CreateChatCompletion(ctx context.Context, request ark.ChatCompletionRequest) (ark.ChatCompletionResponse, error) {
+	if request.Model == "" {
+		request.Model = p.model
+	}
+	return p.client.CreateChatCompletion(ctx, request)
+}
 
-func Config() *ark.Client {
-	config := ark.DefaultConfig(DoubaoAPIKey)
-	config.BaseURL = BaseURL
-	client := ark.NewClientWithConfig(config)
-	return client
+// CreateChatCompletionStream 请求中没有指定模型时使用该后端的模型
+func (p *OpenAIProvider) CreateChatCompletionStream(ctx context.Context, request ark.ChatCompletionRequest) (ChatStream, error) {
+	if request.Model == "" {
+		request.Model = p.model
+	}
+	request.Stream = true
+	return p.client.CreateChatCompletionStream(ctx, request)
 }
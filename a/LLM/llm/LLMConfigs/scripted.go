@@ -0,0 +1,146 @@
+package LLMConfigs
+
+import (
+	"context"
+	"io"
+	"sync"
+
+	ark "github.com/sashabaranov/go-openai"
+)
+
+// ScriptedProvider 确定性的假大模型, 用于测试和离线开发
+// 按顺序返回预设回复, 用完后复述用户最后一句话
+type ScriptedProvider struct {
+	name    string
+	mu      sync.Mutex
+	replies []ark.ChatCompletionMessage
+	next    int
+}
+
+// NewScriptedProvider name 为配置里的后端名称, replies 为预设的纯文本回复
+func NewScriptedProvider(name string, replies ...string) *ScriptedProvider {
+	messages := make([]ark.ChatCompletionMessage, 0, len(replies))
+	for _, reply := range replies {
+		messages = append(messages, ark.ChatCompletionMessage{
+			Role:    ark.ChatMessageRoleAssistant,
+			Content: reply,
+		})
+	}
+	return NewScriptedProviderWithMessages(name, messages...)
+}
+
+// NewScriptedProviderWithMessages 预设完整的 assistant 消息, 可以包含 ToolCalls
+func NewScriptedProviderWithMessages(name string, replies ...ark.ChatCompletionMessage) *ScriptedProvider {
+	return &ScriptedProvider{name: name, replies: replies}
+}
+
+func (p *ScriptedProvider) Name() string {
+	return p.name
+}
+
+func (p *ScriptedProvider) CreateChatCompletion(ctx context.Context, request ark.ChatCompletionRequest) (ark.ChatCompletionResponse, error) {
+	if err := ctx.Err(); err != nil {
+		return ark.ChatCompletionResponse{}, err
+	}
+
+	message := p.nextReply(request)
+	return ark.ChatCompletionResponse{
+		Model: p.name,
+		Choices: []ark.ChatCompletionChoice{
+			{Message: message, FinishReason: finishReason(message)},
+		},
+	}, nil
+}
+
+// CreateChatCompletionStream 把预设回复按每几个字一块拆开, 最后一块带上 ToolCalls
+func (p *ScriptedProvider) CreateChatCompletionStream(ctx context.Context, request ark.ChatCompletionRequest) (ChatStream, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	message := p.nextReply(request)
+	var chunks []ark.ChatCompletionStreamResponse
+	content := []rune(message.Content)
+	for i := 0; i < len(content); i += scriptedChunkSize {
+		end := min(i+scriptedChunkSize, len(content))
+		chunks = append(chunks, p.streamChunk(ark.ChatCompletionStreamChoiceDelta{
+			Content: string(content[i:end]),
+		}))
+	}
+	if len(message.ToolCalls) > 0 {
+		toolCalls := make([]ark.ToolCall, len(message.ToolCalls))
+		for i, toolCall := range message.ToolCalls {
+			index := i
+			toolCall.Index = &index
+			toolCalls[i] = toolCall
+		}
+		chunks = append(chunks, p.streamChunk(ark.ChatCompletionStreamChoiceDelta{ToolCalls: toolCalls}))
+	}
+	last := p.streamChunk(ark.ChatCompletionStreamChoiceDelta{})
+	last.Choices[0].FinishReason = finishReason(message)
+	chunks = append(chunks, last)
+
+	return &scriptedStream{ctx: ctx, chunks: chunks}, nil
+}
+
+func (p *ScriptedProvider) nextReply(request ark.ChatCompletionRequest) ark.ChatCompletionMessage {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.next < len(p.replies) {
+		message := p.replies[p.next]
+		p.next++
+		return message
+	}
+	return ark.ChatCompletionMessage{
+		Role:    ark.ChatMessageRoleAssistant,
+		Content: "你说的是: " + lastUserText(request.Messages),
+	}
+}
+
+func finishReason(message ark.ChatCompletionMessage) ark.FinishReason {
+	if len(message.ToolCalls) > 0 {
+		return ark.FinishReasonToolCalls
+	}
+	return ark.FinishReasonStop
+}
+
+// 流式返回时每块的字数
+const scriptedChunkSize = 4
+
+func (p *ScriptedProvider) streamChunk(delta ark.ChatCompletionStreamChoiceDelta) ark.ChatCompletionStreamResponse {
+	return ark.ChatCompletionStreamResponse{
+		Model:   p.name,
+		Choices: []ark.ChatCompletionStreamChoice{{Delta: delta}},
+	}
+}
+
+// scriptedStream 按顺序返回预先拆好的块
+type scriptedStream struct {
+	ctx    context.Context
+	chunks []ark.ChatCompletionStreamResponse
+}
+
+func (s *scriptedStream) Recv() (ark.ChatCompletionStreamResponse, error) {
+	if err := s.ctx.Err(); err != nil {
+		return ark.ChatCompletionStreamResponse{}, err
+	}
+	if len(s.chunks) == 0 {
+		return ark.ChatCompletionStreamResponse{}, io.EOF
+	}
+	chunk := s.chunks[0]
+	s.chunks = s.chunks[1:]
+	return chunk, nil
+}
+
+func (s *scriptedStream) Close() error {
+	return nil
+}
+
+func lastUserText(messages []ark.ChatCompletionMessage) string {
+	for i := len(messages) - 1; i >= 0; i-- {
+		if messages[i].Role == ark.ChatMessageRoleUser {
+			return messages[i].Content
+		}
+	}
+	return ""
+}
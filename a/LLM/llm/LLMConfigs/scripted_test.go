@@ -0,0 +1,132 @@
+package LLMConfigs
+
+import (
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+
+	ark "github.com/sashabaranov/go-openai"
+)
+
+// readStream 读完一个流, 返回所有块
+func readStream(t *testing.T, stream ChatStream) []ark.ChatCompletionStreamResponse {
+	t.Helper()
+	defer stream.Close()
+	var chunks []ark.ChatCompletionStreamResponse
+	for {
+		chunk, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			return chunks
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		chunks = append(chunks, chunk)
+	}
+}
+
+func TestScriptedName(t *testing.T) {
+	p := NewScriptedProvider("offline")
+	if p.Name() != "offline" {
+		t.Errorf("名称 %q, 应为配置里的 offline", p.Name())
+	}
+	resp, err := p.CreateChatCompletion(context.Background(), ark.ChatCompletionRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.Model != "offline" {
+		t.Errorf("model %q, 应为 offline", resp.Model)
+	}
+}
+
+func TestScriptedStream(t *testing.T) {
+	p := NewScriptedProvider("fake", "今天天气很好哦")
+	request := ark.ChatCompletionRequest{Messages: []ark.ChatCompletionMessage{
+		{Role: ark.ChatMessageRoleUser, Content: "天气怎么样"},
+	}}
+
+	stream, err := p.CreateChatCompletionStream(context.Background(), request)
+	if err != nil {
+		t.Fatal(err)
+	}
+	chunks := readStream(t, stream)
+	var deltas []string
+	for _, chunk := range chunks[:len(chunks)-1] {
+		deltas = append(deltas, chunk.Choices[0].Delta.Content)
+		if chunk.Choices[0].FinishReason != "" {
+			t.Errorf("只有最后一块带结束原因: %+v", chunk)
+		}
+	}
+	if strings.Join(deltas, "|") != "今天天气|很好哦" {
+		t.Errorf("应按每 %d 个字拆开: %q", scriptedChunkSize, deltas)
+	}
+	if last := chunks[len(chunks)-1].Choices[0]; last.FinishReason != ark.FinishReasonStop || last.Delta.Content != "" {
+		t.Errorf("最后一块应为空并以 stop 结束: %+v", last)
+	}
+
+	// 预设回复用完后复述用户最后一句话
+	stream, err = p.CreateChatCompletionStream(context.Background(), request)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var text strings.Builder
+	for _, chunk := range readStream(t, stream) {
+		text.WriteString(chunk.Choices[0].Delta.Content)
+	}
+	if text.String() != "你说的是: 天气怎么样" {
+		t.Errorf("复述 %q", text.String())
+	}
+}
+
+func TestScriptedToolCall(t *testing.T) {
+	p := NewScriptedProviderWithMessages("fake", ark.ChatCompletionMessage{
+		Role:    ark.ChatMessageRoleAssistant,
+		Content: "我查一下",
+		ToolCalls: []ark.ToolCall{
+			{ID: "call-1", Type: ark.ToolTypeFunction, Function: ark.FunctionCall{Name: "GetWeatherByCity", Arguments: `{"city":"北京"}`}},
+			{ID: "call-2", Type: ark.ToolTypeFunction, Function: ark.FunctionCall{Name: "GetWeatherByCity", Arguments: `{"city":"上海"}`}},
+		},
+	})
+
+	stream, err := p.CreateChatCompletionStream(context.Background(), ark.ChatCompletionRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	chunks := readStream(t, stream)
+	if len(chunks) != 3 {
+		t.Fatalf("应为文本、工具调用、结束三块, 得到 %d 块", len(chunks))
+	}
+	if chunks[0].Choices[0].Delta.Content != "我查一下" {
+		t.Errorf("文本块 %+v", chunks[0].Choices[0].Delta)
+	}
+	toolCalls := chunks[1].Choices[0].Delta.ToolCalls
+	if len(toolCalls) != 2 {
+		t.Fatalf("工具调用 %+v", toolCalls)
+	}
+	for i, toolCall := range toolCalls {
+		if toolCall.Index == nil || *toolCall.Index != i {
+			t.Errorf("第 %d 个工具调用的 Index 不对: %+v", i, toolCall.Index)
+		}
+	}
+	if toolCalls[1].ID != "call-2" || toolCalls[1].Function.Arguments != `{"city":"上海"}` {
+		t.Errorf("工具调用 %+v", toolCalls[1])
+	}
+	if reason := chunks[2].Choices[0].FinishReason; reason != ark.FinishReasonToolCalls {
+		t.Errorf("结束原因 %q, 应为 tool_calls", reason)
+	}
+}
+
+func TestScriptedCanceled(t *testing.T) {
+	p := NewScriptedProvider("fake", "不会返回")
+	ctx, cancel := context.WithCancel(context.Background())
+	stream, err := p.CreateChatCompletionStream(ctx, ark.ChatCompletionRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cancel()
+	if _, err := stream.Recv(); !errors.Is(err, context.Canceled) {
+		t.Errorf("取消后应返回 context.Canceled, 得到 %v", err)
+	}
+}
@@ -0,0 +1,103 @@
+package roleModel
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+)
+
+// Handler 角色库的 REST 接口, 挂载在 /api/personas
+//
+//	GET    /api/personas       列出全部角色
+//	POST   /api/personas       新建角色
+//	GET    /api/personas/{id}  查看角色
+//	PUT    /api/personas/{id}  修改角色
+//	DELETE /api/personas/{id}  删除角色
+func Handler(store *Store) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /api/personas", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, store.List())
+	})
+	mux.HandleFunc("POST /api/personas", func(w http.ResponseWriter, r *http.Request) {
+		var role Role
+		if !readJSON(w, r, &role) {
+			return
+		}
+		if err := store.Create(role); err != nil {
+			writeError(w, err)
+			return
+		}
+		log.Printf("新建角色: %s", role.ID)
+		writeJSON(w, http.StatusCreated, role)
+	})
+	mux.HandleFunc("GET /api/personas/{id}", func(w http.ResponseWriter, r *http.Request) {
+		role, err := store.Get(r.PathValue("id"))
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, role)
+	})
+	mux.HandleFunc("PUT /api/personas/{id}", func(w http.ResponseWriter, r *http.Request) {
+		var role Role
+		if !readJSON(w, r, &role) {
+			return
+		}
+		// id 以路径为准, 请求体里可以省略
+		id := r.PathValue("id")
+		if role.ID != "" && role.ID != id {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "请求体中的 id 与路径不一致"})
+			return
+		}
+		role.ID = id
+		if err := store.Update(role); err != nil {
+			writeError(w, err)
+			return
+		}
+		log.Printf("修改角色: %s", role.ID)
+		writeJSON(w, http.StatusOK, role)
+	})
+	mux.HandleFunc("DELETE /api/personas/{id}", func(w http.ResponseWriter, r *http.Request) {
+		id := r.PathValue("id")
+		if err := store.Delete(id); err != nil {
+			writeError(w, err)
+			return
+		}
+		log.Printf("删除角色: %s", id)
+		w.WriteHeader(http.StatusNoContent)
+	})
+	return mux
+}
+
+func readJSON(w http.ResponseWriter, r *http.Request, v any) bool {
+	dec := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<20))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(v); err != nil {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "请求体无效: " + err.Error()})
+		return false
+	}
+	return true
+}
+
+// writeError 按错误类型选择状态码, 其余都是保存文件出错
+func writeError(w http.ResponseWriter, err error) {
+	status := http.StatusInternalServerError
+	switch {
+	case errors.Is(err, ErrInvalid):
+		status = http.StatusBadRequest
+	case errors.Is(err, ErrNotFound):
+		status = http.StatusNotFound
+	case errors.Is(err, ErrExists):
+		status = http.StatusConflict
+	}
+	writeJSON(w, status, map[string]string{"error": err.Error()})
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Printf("写入响应失败: %v", err)
+	}
+}
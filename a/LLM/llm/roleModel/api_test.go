@@ -0,0 +1,71 @@
+package roleModel
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestHandler(t *testing.T) {
+	store, err := NewStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := httptest.NewServer(Handler(store))
+	t.Cleanup(server.Close)
+
+	do := func(method, path, body string) (int, string) {
+		t.Helper()
+		req, err := http.NewRequest(method, server.URL+path, strings.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		data, _ := io.ReadAll(resp.Body)
+		return resp.StatusCode, string(data)
+	}
+
+	teacherJSON := `{"id":"teacher","name":"老师","system":"你是一位耐心的老师"}`
+	for _, tc := range []struct {
+		name, method, path, body string
+		want                     int
+	}{
+		{"新建", "POST", "/api/personas", teacherJSON, http.StatusCreated},
+		{"重复新建", "POST", "/api/personas", teacherJSON, http.StatusConflict},
+		{"新建无效角色", "POST", "/api/personas", `{"id":"Bad Id","system":"设定"}`, http.StatusBadRequest},
+		{"未知字段", "POST", "/api/personas", `{"id":"x","system":"设定","prompt":"?"}`, http.StatusBadRequest},
+		{"请求体不是 JSON", "POST", "/api/personas", `id=x`, http.StatusBadRequest},
+		{"查看", "GET", "/api/personas/teacher", "", http.StatusOK},
+		{"查看不存在的角色", "GET", "/api/personas/nobody", "", http.StatusNotFound},
+		{"修改时 id 不一致", "PUT", "/api/personas/teacher", `{"id":"neko","system":"设定"}`, http.StatusBadRequest},
+		{"修改不存在的角色", "PUT", "/api/personas/nobody", `{"system":"设定"}`, http.StatusNotFound},
+		{"修改时 id 以路径为准", "PUT", "/api/personas/teacher", `{"system":"你是一位严厉的老师"}`, http.StatusOK},
+		{"删除", "DELETE", "/api/personas/teacher", "", http.StatusNoContent},
+		{"删除不存在的角色", "DELETE", "/api/personas/teacher", "", http.StatusNotFound},
+	} {
+		if status, body := do(tc.method, tc.path, tc.body); status != tc.want {
+			t.Errorf("%s: 状态码 %d, 应为 %d: %s", tc.name, status, tc.want, body)
+		}
+		if tc.name == "修改时 id 以路径为准" {
+			if role, _ := store.Get("teacher"); role.System != "你是一位严厉的老师" {
+				t.Errorf("修改没有生效: %+v", role)
+			}
+		}
+	}
+
+	status, body := do("GET", "/api/personas", "")
+	var roles []Role
+	if err := json.Unmarshal([]byte(body), &roles); status != http.StatusOK || err != nil {
+		t.Fatalf("列出角色: %d %s", status, body)
+	}
+	if len(roles) != 1 || roles[0].ID != Neko.ID {
+		t.Errorf("删除后应只剩内置角色, 得到 %+v", roles)
+	}
+}
@@ -1,26 +1,85 @@
 package roleModel
 
-//type Role struct {
-//	Init         string
-//	FirstMessage string
-//	Type         RoleType
-//}
-//
-//type RoleType interface {
-//	ModifyMessage(string) string
-//}
-//
-//func InitRole(init, firstMessage string, typ Type) Role {
-//	return Role{
-//		Init:         init,
-//		FirstMessage: firstMessage,
-//		Type:         typ,
-//	}
-//}
-//
-//func RoleInitMessage(dis string) []ark.ChatCompletionMessage {
-//	select {
-//	case dis == "neko":
-//		return server.InitMessage(r.Init, r.FirstMessage)
-//	}
-//}
+import (
+	"errors"
+	"fmt"
+	"regexp"
+
+	ark "github.com/sashabaranov/go-openai"
+	"main/LLM/llm/tools"
+)
+
+// Role 一个角色设定
+type Role struct {
+	ID       string `json:"id"`
+	Name     string `json:"name"`
+	System   string `json:"system"`             // 系统提示词
+	Greeting string `json:"greeting,omitempty"` // 开场白, 会话开始时说出来
+	// 默认音色、语速、音量, 为空时使用语音合成的默认值
+	Voice  string   `json:"voice,omitempty"`
+	Speed  *float64 `json:"speed,omitempty"`
+	Volume *float64 `json:"volume,omitempty"`
+	// 允许调用的工具名称, 为空时可以使用全部工具
+	Tools []string `json:"tools,omitempty"`
+	// 示例对话, 放在系统提示词之后帮助模型模仿语气
+	Examples []Example `json:"examples,omitempty"`
+}
+
+// Example 一问一答的示例对话
+type Example struct {
+	User      string `json:"user"`
+	Assistant string `json:"assistant"`
+}
+
+// id 同时用作文件名, 只允许小写字母、数字、下划线和短横线
+var idPattern = regexp.MustCompile(`^[a-z0-9_-]{1,64}$`)
+
+// Validate 检查角色设定是否完整
+func (r *Role) Validate() error {
+	var errs []error
+	if !idPattern.MatchString(r.ID) {
+		errs = append(errs, fmt.Errorf("id 无效: %q, 只能包含小写字母、数字、_ 和 -", r.ID))
+	}
+	if r.System == "" {
+		errs = append(errs, errors.New("system 不能为空"))
+	}
+	if r.Speed != nil && (*r.Speed < -2 || *r.Speed > 6) {
+		errs = append(errs, errors.New("speed 必须在 -2~6 之间"))
+	}
+	if r.Volume != nil && (*r.Volume < -10 || *r.Volume > 10) {
+		errs = append(errs, errors.New("volume 必须在 -10~10 之间"))
+	}
+	for _, name := range r.Tools {
+		if !tools.Default.Has(name) {
+			errs = append(errs, fmt.Errorf("未知的工具: %s", name))
+		}
+	}
+	for i, example := range r.Examples {
+		if example.User == "" || example.Assistant == "" {
+			errs = append(errs, fmt.Errorf("第 %d 条示例对话不完整", i+1))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Messages 角色的开场消息: 系统提示词、示例对话和开场白
+func (r *Role) Messages() []ark.ChatCompletionMessage {
+	messages := []ark.ChatCompletionMessage{
+		{Role: ark.ChatMessageRoleSystem, Content: r.System},
+	}
+	for _, example := range r.Examples {
+		messages = append(messages,
+			ark.ChatCompletionMessage{Role: ark.ChatMessageRoleUser, Content: example.User},
+			ark.ChatCompletionMessage{Role: ark.ChatMessageRoleAssistant, Content: example.Assistant},
+		)
+	}
+	if r.Greeting != "" {
+		messages = append(messages, ark.ChatCompletionMessage{Role: ark.ChatMessageRoleAssistant, Content: r.Greeting})
+	}
+	return messages
+}
+
+// Toolset 角色可以使用的工具
+func (r *Role) Toolset() (*tools.Registry, error) {
+	return tools.Default.Subset(r.Tools)
+}
@@ -0,0 +1,145 @@
+package roleModel
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+var (
+	ErrNotFound = errors.New("角色不存在")
+	ErrExists   = errors.New("角色已存在")
+	ErrInvalid  = errors.New("角色设定无效")
+)
+
+// Store 角色库, 每个角色保存为目录下的一个 <id>.json 文件
+type Store struct {
+	dir   string
+	mu    sync.RWMutex
+	roles map[string]Role
+}
+
+// NewStore 读取目录中的全部角色, 目录不存在时创建, 为空时写入内置角色
+func NewStore(dir string) (*Store, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("创建角色目录失败: %v", err)
+	}
+	s := &Store{dir: dir, roles: make(map[string]Role)}
+
+	files, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return nil, fmt.Errorf("读取角色文件失败: %v", err)
+		}
+		var role Role
+		if err := json.Unmarshal(data, &role); err != nil {
+			return nil, fmt.Errorf("解析角色文件 %s 失败: %v", file, err)
+		}
+		if id := strings.TrimSuffix(filepath.Base(file), ".json"); role.ID != id {
+			return nil, fmt.Errorf("角色文件 %s 的 id 与文件名不一致: %q", file, role.ID)
+		}
+		if err := role.Validate(); err != nil {
+			return nil, fmt.Errorf("角色文件 %s 无效: %v", file, err)
+		}
+		s.roles[role.ID] = role
+	}
+
+	if len(s.roles) == 0 {
+		if err := s.Create(Neko); err != nil {
+			return nil, err
+		}
+	}
+	log.Printf("已加载 %d 个角色", len(s.roles))
+	return s, nil
+}
+
+// List 按 id 排序返回全部角色
+func (s *Store) List() []Role {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	roles := make([]Role, 0, len(s.roles))
+	for _, role := range s.roles {
+		roles = append(roles, role)
+	}
+	sort.Slice(roles, func(i, j int) bool { return roles[i].ID < roles[j].ID })
+	return roles
+}
+
+func (s *Store) Get(id string) (Role, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	role, ok := s.roles[id]
+	if !ok {
+		return Role{}, fmt.Errorf("%w: %s", ErrNotFound, id)
+	}
+	return role, nil
+}
+
+func (s *Store) Create(role Role) error {
+	if err := role.Validate(); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalid, err)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.roles[role.ID]; ok {
+		return fmt.Errorf("%w: %s", ErrExists, role.ID)
+	}
+	return s.save(role)
+}
+
+func (s *Store) Update(role Role) error {
+	if err := role.Validate(); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalid, err)
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.roles[role.ID]; !ok {
+		return fmt.Errorf("%w: %s", ErrNotFound, role.ID)
+	}
+	return s.save(role)
+}
+
+func (s *Store) Delete(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.roles[id]; !ok {
+		return fmt.Errorf("%w: %s", ErrNotFound, id)
+	}
+	if err := os.Remove(s.path(id)); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("删除角色文件失败: %v", err)
+	}
+	delete(s.roles, id)
+	return nil
+}
+
+// save 先写临时文件再改名, 避免写到一半留下损坏的文件, 调用时需持有 s.mu
+func (s *Store) save(role Role) error {
+	data, err := json.MarshalIndent(role, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := s.path(role.ID) + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return fmt.Errorf("保存角色失败: %v", err)
+	}
+	if err := os.Rename(tmp, s.path(role.ID)); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("保存角色失败: %v", err)
+	}
+	s.roles[role.ID] = role
+	return nil
+}
+
+func (s *Store) path(id string) string {
+	return filepath.Join(s.dir, id+".json")
+}
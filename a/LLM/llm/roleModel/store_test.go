@@ -0,0 +1,121 @@
+package roleModel
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// teacher 一个合法的测试角色
+func teacher() Role {
+	return Role{ID: "teacher", Name: "老师", System: "你是一位耐心的老师", Tools: []string{"GetWeatherByCity"}}
+}
+
+func TestNewStoreSeedsNeko(t *testing.T) {
+	dir := t.TempDir()
+	store, err := NewStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if roles := store.List(); len(roles) != 1 || roles[0].ID != Neko.ID {
+		t.Fatalf("空的角色库应写入内置角色, 得到 %+v", roles)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "neko.json")); err != nil {
+		t.Fatalf("内置角色应保存成文件: %v", err)
+	}
+
+	// 已经有角色时不再写入内置角色
+	dir = t.TempDir()
+	data, _ := json.Marshal(teacher())
+	os.WriteFile(filepath.Join(dir, "teacher.json"), data, 0o644)
+	store, err = NewStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if roles := store.List(); len(roles) != 1 || roles[0].ID != "teacher" {
+		t.Errorf("应只有目录里的角色, 得到 %+v", roles)
+	}
+}
+
+func TestNewStoreRejectsBadFiles(t *testing.T) {
+	for name, content := range map[string]string{
+		"mismatch.json": `{"id":"other","system":"设定"}`,
+		"broken.json":   `{"id":`,
+		"invalid.json":  `{"id":"invalid"}`,
+	} {
+		dir := t.TempDir()
+		os.WriteFile(filepath.Join(dir, name), []byte(content), 0o644)
+		if _, err := NewStore(dir); err == nil {
+			t.Errorf("%s 无效, 应加载失败", name)
+		}
+	}
+}
+
+func TestRoleValidate(t *testing.T) {
+	speed, volume := 7.0, -11.0
+	for _, tc := range []struct {
+		name string
+		edit func(r *Role)
+		want string // 为空表示合法
+	}{
+		{"合法", func(r *Role) {}, ""},
+		{"大写 id", func(r *Role) { r.ID = "Teacher" }, "id 无效"},
+		{"空 id", func(r *Role) { r.ID = "" }, "id 无效"},
+		{"路径 id", func(r *Role) { r.ID = "../teacher" }, "id 无效"},
+		{"过长 id", func(r *Role) { r.ID = strings.Repeat("a", 65) }, "id 无效"},
+		{"没有设定", func(r *Role) { r.System = "" }, "system"},
+		{"语速超出范围", func(r *Role) { r.Speed = &speed }, "speed"},
+		{"音量超出范围", func(r *Role) { r.Volume = &volume }, "volume"},
+		{"未知的工具", func(r *Role) { r.Tools = []string{"GetWeatherByCity", "RunShell"} }, "未知的工具: RunShell"},
+		{"示例不完整", func(r *Role) { r.Examples = []Example{{User: "你好"}} }, "示例对话"},
+	} {
+		role := teacher()
+		tc.edit(&role)
+		err := role.Validate()
+		switch {
+		case tc.want == "" && err != nil:
+			t.Errorf("%s: 应合法, 得到 %v", tc.name, err)
+		case tc.want != "" && (err == nil || !strings.Contains(err.Error(), tc.want)):
+			t.Errorf("%s: 应报错 %q, 得到 %v", tc.name, tc.want, err)
+		}
+	}
+}
+
+func TestStoreSaveAtomic(t *testing.T) {
+	dir := t.TempDir()
+	store, err := NewStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := store.Create(teacher()); err != nil {
+		t.Fatal(err)
+	}
+	if matches, _ := filepath.Glob(filepath.Join(dir, "*.tmp")); len(matches) != 0 {
+		t.Errorf("保存后不应留下临时文件: %v", matches)
+	}
+
+	// 临时文件写不进去时, 原来的文件和内存里的角色都不变
+	os.Mkdir(filepath.Join(dir, "teacher.json.tmp"), 0o755)
+	changed := teacher()
+	changed.System = "你是一位严厉的老师"
+	if err := store.Update(changed); err == nil {
+		t.Fatal("临时文件写不进去时应报错")
+	}
+	if role, _ := store.Get("teacher"); role.System != teacher().System {
+		t.Errorf("保存失败后内存里的角色被改成了 %q", role.System)
+	}
+	reloaded, err := NewStore(dir)
+	if err != nil {
+		t.Fatalf("保存失败后角色文件应仍然完整: %v", err)
+	}
+	if role, _ := reloaded.Get("teacher"); role.System != teacher().System {
+		t.Errorf("保存失败后文件里的角色被改成了 %q", role.System)
+	}
+
+	if err := store.Create(teacher()); !errors.Is(err, ErrExists) {
+		t.Errorf("重复创建应返回 ErrExists, 得到 %v", err)
+	}
+}
@@ -2,26 +2,29 @@ package server
 
 import (
 	"context"
-	"encoding/json"
-	"fmt"
+	"errors"
 	ark "github.com/sashabaranov/go-openai"
+	"io"
 	"log"
 	"main/LLM/llm/LLMConfigs"
 	"main/LLM/llm/tools"
 	"strings"
 )
 
-var client = LLMConfigs.Config()
+// DeltaFunc 流式回复中每收到一段文本就调用一次
+type DeltaFunc func(delta string)
 
-// GetLLMAnswer 返回大模型本次回复和历史记录
-func GetLLMAnswer(text string, messages []ark.ChatCompletionMessage) (string, []ark.ChatCompletionMessage) {
-	return ContinueConversation(text, messages)
+// GetLLMAnswer 返回大模型本次回复和历史记录, 生成过程中的文本通过 onDelta 实时返回
+// toolset 为本次可用的工具, nil 表示全部内置工具; maxToolRounds 见 ContinueConversation;
+// ctx 取消后停止生成, 返回已经生成的部分
+func GetLLMAnswer(ctx context.Context, provider LLMConfigs.Provider, toolset *tools.Registry, maxToolRounds int, text string, messages []ark.ChatCompletionMessage, onDelta DeltaFunc) (string, []ark.ChatCompletionMessage) {
+	return ContinueConversation(ctx, provider, toolset, maxToolRounds, text, messages, onDelta)
 }
 
-func setRequest(messages []ark.ChatCompletionMessage) ark.ChatCompletionRequest {
-	tool := tools.GetTools()
+func setRequest(toolset *tools.Registry, messages []ark.ChatCompletionMessage) ark.ChatCompletionRequest {
+	tool := toolset.Definitions()
+	// 模型由各个 Provider 自己决定
 	request := ark.ChatCompletionRequest{
-		Model:    LLMConfigs.Model,
 		Messages: messages,
 		Tools:    tool,
 	}
@@ -29,8 +32,10 @@ func setRequest(messages []ark.ChatCompletionMessage) ark.ChatCompletionRequest
 }
 
 // getResponse 接受一个message,{Role, Content}
+// 以流式请求大模型, 文本增量交给 onDelta, 全部收完后拼成完整回复
 // 返回的信息在resp.Choices[0].Message.Content
-func getResponse(messages []ark.ChatCompletionMessage) ark.ChatCompletionResponse {
+// 出错时返回错误和已经收到的部分
+func getResponse(ctx context.Context, provider LLMConfigs.Provider, toolset *tools.Registry, messages []ark.ChatCompletionMessage, onDelta DeltaFunc) (ark.ChatCompletionResponse, error) {
 	// 日志检查是否传入有效content
 	for _, text := range messages {
 		switch text.Role {
@@ -45,16 +50,22 @@ func getResponse(messages []ark.ChatCompletionMessage) ark.ChatCompletionRespons
 		}
 	}
 
-	request := setRequest(messages)
-	resp, err := client.CreateChatCompletion(
-		context.Background(),
+	request := setRequest(toolset, messages)
+	stream, err := provider.CreateChatCompletionStream(
+		ctx,
 		request,
 	)
-
 	if err != nil {
-		log.Printf("ChatCompletion error: %v\n", err)
+		log.Printf("ChatCompletionStream error: %v\n", err)
 		// 出错也返回, 避免panic
-		return resp
+		return ark.ChatCompletionResponse{}, err
+	}
+	defer stream.Close()
+
+	resp, err := collectStream(stream, onDelta)
+	if err != nil {
+		log.Printf("ChatCompletionStream error: %v\n", err)
+		// 已经收到的部分照常返回
 	}
 	// 检查并记录函数调用
 	if len(resp.Choices) > 0 {
@@ -69,7 +80,73 @@ func getResponse(messages []ark.ChatCompletionMessage) ark.ChatCompletionRespons
 			log.Printf("LLM 调用函数: [%s]", strings.Join(calledTools, ", "))
 		}
 	}
-	return resp
+	return resp, err
+}
+
+// collectStream 读完流式回复, 把文本和分段到达的 tool_calls 拼回一条 assistant 消息
+func collectStream(stream LLMConfigs.ChatStream, onDelta DeltaFunc) (ark.ChatCompletionResponse, error) {
+	var content strings.Builder
+	var toolCalls []ark.ToolCall
+	var finishReason ark.FinishReason
+	var err error
+	for {
+		var chunk ark.ChatCompletionStreamResponse
+		chunk, err = stream.Recv()
+		if err != nil {
+			break
+		}
+		if len(chunk.Choices) == 0 {
+			continue
+		}
+		choice := chunk.Choices[0]
+		if choice.FinishReason != "" {
+			finishReason = choice.FinishReason
+		}
+		if choice.Delta.Content != "" {
+			content.WriteString(choice.Delta.Content)
+			if onDelta != nil {
+				onDelta(choice.Delta.Content)
+			}
+		}
+		for _, delta := range choice.Delta.ToolCalls {
+			// 同一个 tool call 的参数会分多块到达, 用 Index 对应
+			index := len(toolCalls)
+			if delta.Index != nil {
+				index = *delta.Index
+			}
+			for len(toolCalls) <= index {
+				toolCalls = append(toolCalls, ark.ToolCall{Type: ark.ToolTypeFunction})
+			}
+			toolCall := &toolCalls[index]
+			if delta.ID != "" {
+				toolCall.ID = delta.ID
+			}
+			if delta.Type != "" {
+				toolCall.Type = delta.Type
+			}
+			if delta.Function.Name != "" {
+				toolCall.Function.Name = delta.Function.Name
+			}
+			toolCall.Function.Arguments += delta.Function.Arguments
+		}
+	}
+	if errors.Is(err, io.EOF) {
+		err = nil
+	}
+
+	message := ark.ChatCompletionMessage{
+		Role:      ark.ChatMessageRoleAssistant,
+		Content:   content.String(),
+		ToolCalls: toolCalls,
+	}
+	if content.Len() == 0 && len(toolCalls) == 0 {
+		return ark.ChatCompletionResponse{}, err
+	}
+	return ark.ChatCompletionResponse{
+		Choices: []ark.ChatCompletionChoice{
+			{Message: message, FinishReason: finishReason},
+		},
+	}, err
 }
 
 func AddUserMessage(text string, messages []ark.ChatCompletionMessage) []ark.ChatCompletionMessage {
@@ -86,134 +163,86 @@ func AddAssistantMessage(answer string, messages []ark.ChatCompletionMessage) []
 	})
 }
 
-func ContinueConversation(text string, messages []ark.ChatCompletionMessage) (string, []ark.ChatCompletionMessage) {
-	messages = AddUserMessage(text, messages)
-	resp := getResponse(messages)
+// DefaultMaxToolRounds 一次提问最多连续调用几轮工具, 调用方没有指定时使用
+const DefaultMaxToolRounds = 5
 
-	// 检查是否有函数调用
-	if len(resp.Choices) > 0 {
-		message := resp.Choices[0].Message
+// 工具轮数用完或接口出错时说给用户听的兜底回复
+const (
+	fallbackToolLimit = "抱歉，这个问题我查了好几次还是没有结果，换个说法再问我吧。"
+	fallbackError     = "抱歉，我这边出了点问题，请稍后再试。"
+)
 
-		// 检查是否有 tool_calls
-		if len(message.ToolCalls) > 0 {
-			var finalMessages []ark.ChatCompletionMessage
-			var toolResponses []ark.ChatCompletionMessage
-			// 开始遍历每个 tool call 并执行
-			for _, toolCall := range message.ToolCalls {
-				toolFunc := toolCall.Function
-				if toolFunc.Arguments == "" {
-					log.Printf("工具调用参数为空: %v", toolFunc.Name)
-					// 即使参数为空，也要返回一个 tool response，避免 LLM 报错
-					toolResponses = append(toolResponses, ark.ChatCompletionMessage{
-						Role:       ark.ChatMessageRoleTool,
-						Name:       toolFunc.Name,
-						Content:    "错误, 工具调用参数为空",
-						ToolCallID: toolCall.ID,
-					})
-					continue
-				}
-				switch toolFunc.Name {
-				case "GetWeatherByCity":
-					var args struct {
-						City string `json:"city"`
-					}
-					// 解析 Arguments JSON 字符串
-					if err := json.Unmarshal([]byte(toolFunc.Arguments), &args); err != nil {
-						log.Printf("未能解组参数: %v", err)
-						toolResponses = append(toolResponses, ark.ChatCompletionMessage{
-							Role:       ark.ChatMessageRoleTool,
-							Name:       toolFunc.Name,
-							Content:    fmt.Sprintf("错误: 参数无效 - %v", err),
-							ToolCallID: toolCall.ID,
-						})
-						continue
-					}
-
-					if args.City == "" {
-						log.Println("缺少参数: city")
-						toolResponses = append(toolResponses, ark.ChatCompletionMessage{
-							Role:       ark.ChatMessageRoleTool,
-							Name:       toolFunc.Name,
-							Content:    "错误 缺少参数: city",
-							ToolCallID: toolCall.ID,
-						})
-						continue
-					}
-
-					result := tools.GetWeatherByCity(args.City) // ← 你已实现的函数，返回字符串
-					// 构造 tool response 消息
-					toolResponse := ark.ChatCompletionMessage{
-						Role:       ark.ChatMessageRoleTool,
-						Name:       toolFunc.Name,
-						Content:    result,
-						ToolCallID: toolCall.ID,
-					}
-					toolResponses = append(toolResponses, toolResponse)
-				case "GetWeatherByCoordinates":
-					var args struct {
-						Lat string `json:"lat"`
-						Lon string `json:"lon"`
-					}
-					// 解析 Arguments JSON 字符串
-					if err := json.Unmarshal([]byte(toolFunc.Arguments), &args); err != nil {
-						log.Printf("未能解组参数: %v", err)
-						toolResponses = append(toolResponses, ark.ChatCompletionMessage{
-							Role:       ark.ChatMessageRoleTool,
-							Name:       toolFunc.Name,
-							Content:    fmt.Sprintf("错误: 参数无效 - %v", err),
-							ToolCallID: toolCall.ID,
-						})
-						continue
-					}
-
-					if args.Lat == "" || args.Lon == "" {
-						log.Println("缺少参数: lat, lon")
-						toolResponses = append(toolResponses, ark.ChatCompletionMessage{
-							Role:       ark.ChatMessageRoleTool,
-							Name:       toolFunc.Name,
-							Content:    "错误 缺少参数: lat, lon",
-							ToolCallID: toolCall.ID,
-						})
-						continue
-					}
-
-					result := tools.GetWeatherByCoordinates(args.Lat, args.Lon) // ← 你已实现的函数，返回字符串
-					// 构造 tool response 消息
-					toolResponse := ark.ChatCompletionMessage{
-						Role:       ark.ChatMessageRoleTool,
-						Name:       toolFunc.Name,
-						Content:    result,
-						ToolCallID: toolCall.ID,
-					}
-					toolResponses = append(toolResponses, toolResponse)
-				}
+// ContinueConversation 反复执行大模型要求的工具调用, 直到它给出不带工具调用的回答
+// 超过 maxToolRounds 轮(不大于 0 时为 DefaultMaxToolRounds)或接口出错时用兜底回复结束本轮,
+// ctx 取消时返回已经生成的部分
+func ContinueConversation(ctx context.Context, provider LLMConfigs.Provider, toolset *tools.Registry, maxToolRounds int, text string, messages []ark.ChatCompletionMessage, onDelta DeltaFunc) (string, []ark.ChatCompletionMessage) {
+	if toolset == nil {
+		toolset = tools.Default
+	}
+	if maxToolRounds <= 0 {
+		maxToolRounds = DefaultMaxToolRounds
+	}
+	messages = AddUserMessage(text, messages)
+	for round := 1; ; round++ {
+		resp, err := getResponse(ctx, provider, toolset, messages, onDelta)
+		var message ark.ChatCompletionMessage
+		if len(resp.Choices) > 0 {
+			message = resp.Choices[0].Message
+		}
+
+		// 被打断: 不再调用工具, 也不说兜底回复
+		if ctx.Err() != nil {
+			if message.Content == "" {
+				return "", messages
 			}
+			return message.Content, AddAssistantMessage(message.Content, messages)
+		}
 
-			// 把原始 assistant 消息 + 所有 tool responses 加入对话
-			assistantMsg := message
-			finalMessages = append(finalMessages, messages...)
-			finalMessages = append(finalMessages, assistantMsg) // 包含 function_call 的 assistant 消息
-			finalMessages = append(finalMessages, toolResponses...)
+		if err != nil || (message.Content == "" && len(message.ToolCalls) == 0) {
+			if err == nil {
+				log.Printf("%s 第 %d 轮没有返回任何回答", provider.Name(), round)
+			}
+			if message.Content != "" {
+				// 已经说出去一部分, 不再补兜底回复
+				log.Println("bot answer: ", message.Content)
+				return message.Content, AddAssistantMessage(message.Content, messages)
+			}
+			return fallback("", fallbackError, messages, onDelta)
+		}
 
-			// 第二次调用 LLM，让它基于 tool 结果生成自然语言回复
-			resp2 := getResponse(finalMessages)
-			if len(resp2.Choices) > 0 && resp2.Choices[0].Message.Content != "" {
-				finalAnswer := resp2.Choices[0].Message.Content
-				log.Println("bot answer: ", finalAnswer)
+		if len(message.ToolCalls) == 0 {
+			log.Println("bot answer: ", message.Content)
+			return message.Content, append(messages, message)
+		}
 
-				// 将最终 assistant 回复也加入对话历史
-				finalMessages = append(finalMessages, resp2.Choices[0].Message)
+		if round > maxToolRounds {
+			log.Printf("工具调用已达 %d 轮上限, 放弃本次回答", maxToolRounds)
+			// 这一轮调用工具前说的话已经发出去了
+			return fallback(message.Content, fallbackToolLimit, messages, onDelta)
+		}
 
-				return finalAnswer, finalMessages
-			}
+		// 开始遍历每个 tool call 并执行, 参数解码和出错时的回复由注册表统一处理
+		var toolResponses []ark.ChatCompletionMessage
+		for _, toolCall := range message.ToolCalls {
+			toolResponses = append(toolResponses, toolset.Call(ctx, toolCall))
 		}
+		log.Printf("第 %d 轮工具调用完成, 共 %d 个结果", round, len(toolResponses))
+
+		// 把包含 tool_calls 的 assistant 消息和所有工具结果加入对话, 让大模型继续
+		messages = append(messages, message)
+		messages = append(messages, toolResponses...)
 	}
+}
 
-	// 如果没有调用直接返回llm回答
-	answer := resp.Choices[0].Message.Content
+// fallback 把兜底回复当作大模型的回答说出去并记入历史
+// spoken 是本轮已经流式发出去的内容, 兜底回复接在它后面, 历史记录里是实际说出的全部内容
+func fallback(spoken, answer string, messages []ark.ChatCompletionMessage, onDelta DeltaFunc) (string, []ark.ChatCompletionMessage) {
+	if onDelta != nil {
+		onDelta(answer)
+	}
+	answer = spoken + answer
 	log.Println("bot answer: ", answer)
-	messages = AddAssistantMessage(answer, messages)
-	return answer, messages
+	return answer, AddAssistantMessage(answer, messages)
 }
 
 func InitMessage(args ...string) []ark.ChatCompletionMessage {
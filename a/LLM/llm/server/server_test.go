@@ -0,0 +1,157 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"io"
+	"main/LLM/llm/LLMConfigs"
+	"main/LLM/llm/tools"
+	"strings"
+	"testing"
+
+	ark "github.com/sashabaranov/go-openai"
+)
+
+// counter 只有一个工具的注册表, 记下工具被调用了几次
+func counter(calls *int) *tools.Registry {
+	toolset := tools.NewRegistry()
+	toolset.Register(tools.New("Lookup", "查询", func(ctx context.Context, args struct{}) (string, error) {
+		*calls++
+		return "没有结果", nil
+	}))
+	return toolset
+}
+
+// lookup 调用一次 Lookup 的 assistant 消息, content 是调用前说的话
+func lookup(id, content string) ark.ChatCompletionMessage {
+	return ark.ChatCompletionMessage{
+		Role:    ark.ChatMessageRoleAssistant,
+		Content: content,
+		ToolCalls: []ark.ToolCall{{ID: id, Type: ark.ToolTypeFunction,
+			Function: ark.FunctionCall{Name: "Lookup", Arguments: `{}`}}},
+	}
+}
+
+// ask 提问并记下流式发出的全部文本
+func ask(provider LLMConfigs.Provider, toolset *tools.Registry, maxToolRounds int) (string, []ark.ChatCompletionMessage, string) {
+	var streamed strings.Builder
+	answer, messages := ContinueConversation(context.Background(), provider, toolset, maxToolRounds, "查一下",
+		[]ark.ChatCompletionMessage{{Role: ark.ChatMessageRoleSystem, Content: "你是助手"}},
+		func(delta string) { streamed.WriteString(delta) })
+	return answer, messages, streamed.String()
+}
+
+func roles(messages []ark.ChatCompletionMessage) string {
+	var out []string
+	for _, m := range messages {
+		out = append(out, m.Role)
+	}
+	return strings.Join(out, ",")
+}
+
+func TestToolRounds(t *testing.T) {
+	var calls int
+	provider := LLMConfigs.NewScriptedProviderWithMessages("fake",
+		lookup("call-1", ""),
+		lookup("call-2", ""),
+		ark.ChatCompletionMessage{Role: ark.ChatMessageRoleAssistant, Content: "查到了。"},
+	)
+	answer, messages, streamed := ask(provider, counter(&calls), 2)
+	if answer != "查到了。" || streamed != answer {
+		t.Errorf("回答 %q, 流式发出 %q", answer, streamed)
+	}
+	if calls != 2 {
+		t.Errorf("工具调用了 %d 次, 应为 2 次", calls)
+	}
+	if got := roles(messages); got != "system,user,assistant,tool,assistant,tool,assistant" {
+		t.Errorf("历史记录 %s", got)
+	}
+}
+
+func TestToolRoundLimit(t *testing.T) {
+	var calls int
+	provider := LLMConfigs.NewScriptedProviderWithMessages("fake",
+		lookup("call-1", ""),
+		lookup("call-2", ""),
+		lookup("call-3", "我再查一下。"),
+	)
+	answer, messages, streamed := ask(provider, counter(&calls), 2)
+	if calls != 2 {
+		t.Errorf("工具调用了 %d 次, 超过上限后不应再调用", calls)
+	}
+	// 超过上限那一轮已经说出去的话保留, 兜底回复接在后面, 历史记录和实际说出的一致
+	if want := "我再查一下。" + fallbackToolLimit; answer != want || streamed != want {
+		t.Errorf("回答 %q, 流式发出 %q, 应为 %q", answer, streamed, want)
+	}
+	last := messages[len(messages)-1]
+	if last.Role != ark.ChatMessageRoleAssistant || last.Content != answer || len(last.ToolCalls) != 0 {
+		t.Errorf("最后一条历史记录 %+v", last)
+	}
+}
+
+func TestToolRoundDefaultLimit(t *testing.T) {
+	var calls int
+	replies := make([]ark.ChatCompletionMessage, DefaultMaxToolRounds+2)
+	for i := range replies {
+		replies[i] = lookup("call", "")
+	}
+	answer, _, _ := ask(LLMConfigs.NewScriptedProviderWithMessages("fake", replies...), counter(&calls), 0)
+	if answer != fallbackToolLimit || calls != DefaultMaxToolRounds {
+		t.Errorf("没有指定上限时应调用 %d 轮, 调用了 %d 轮, 回答 %q", DefaultMaxToolRounds, calls, answer)
+	}
+}
+
+// brokenProvider 先流式返回 partial, 然后出错
+type brokenProvider struct {
+	partial string
+}
+
+func (p brokenProvider) Name() string {
+	return "broken"
+}
+
+func (p brokenProvider) CreateChatCompletion(ctx context.Context, request ark.ChatCompletionRequest) (ark.ChatCompletionResponse, error) {
+	return ark.ChatCompletionResponse{}, errors.New("服务不可用")
+}
+
+func (p brokenProvider) CreateChatCompletionStream(ctx context.Context, request ark.ChatCompletionRequest) (LLMConfigs.ChatStream, error) {
+	if p.partial == "" {
+		return nil, errors.New("服务不可用")
+	}
+	return &brokenStream{partial: p.partial}, nil
+}
+
+type brokenStream struct {
+	partial string
+}
+
+func (s *brokenStream) Recv() (ark.ChatCompletionStreamResponse, error) {
+	if s.partial == "" {
+		return ark.ChatCompletionStreamResponse{}, io.ErrUnexpectedEOF
+	}
+	chunk := ark.ChatCompletionStreamResponse{Choices: []ark.ChatCompletionStreamChoice{
+		{Delta: ark.ChatCompletionStreamChoiceDelta{Content: s.partial}},
+	}}
+	s.partial = ""
+	return chunk, nil
+}
+
+func (s *brokenStream) Close() error {
+	return nil
+}
+
+func TestErrorFallback(t *testing.T) {
+	answer, messages, streamed := ask(brokenProvider{}, counter(new(int)), 2)
+	if answer != fallbackError || streamed != fallbackError {
+		t.Errorf("出错时应说兜底回复, 回答 %q, 流式发出 %q", answer, streamed)
+	}
+	if last := messages[len(messages)-1]; last.Role != ark.ChatMessageRoleAssistant || last.Content != fallbackError {
+		t.Errorf("兜底回复应记入历史, 最后一条 %+v", last)
+	}
+
+	// 已经说出去一部分时不再补兜底回复
+	answer, messages, streamed = ask(brokenProvider{partial: "你好"}, counter(new(int)), 2)
+	if answer != "你好" || streamed != "你好" || messages[len(messages)-1].Content != "你好" {
+		t.Errorf("中途出错时应保留已经说出的部分, 回答 %q, 流式发出 %q", answer, streamed)
+	}
+}
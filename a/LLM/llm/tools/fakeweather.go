@@ -0,0 +1,204 @@
+package tools
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// FakeWeatherServer 本地假天气服务, 接口和 OpenWeatherMap 的 weather、forecast 相同, 不需要 api key
+// 数据按当前时间生成, 方便离线测试预报的汇总: 今天上午晴下午多云, 明天下午有雨, 大后天阴, 其余晴
+// 城市名为"不存在"时和真实接口一样返回 404
+type FakeWeatherServer struct {
+	// 为 nil 时使用 time.Now
+	Now func() time.Time
+}
+
+// fakeCity 假天气服务认识的城市
+type fakeCity struct {
+	name     string
+	lat, lon float64
+}
+
+var fakeCities = []fakeCity{
+	{"北京", 39.9042, 116.4074},
+	{"上海", 31.2304, 121.4737},
+	{"广州", 23.1291, 113.2644},
+	{"深圳", 22.5431, 114.0579},
+}
+
+// 假数据都按北京时间生成
+const fakeTimezone = 8 * 3600
+
+func NewFakeWeatherServer() *FakeWeatherServer {
+	return &FakeWeatherServer{}
+}
+
+// StartFakeWeatherServer 在本机随机端口启动假天气服务, 返回可以填到 WeatherClientConfig.BaseURL 的地址
+func StartFakeWeatherServer() (string, error) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return "", fmt.Errorf("启动假天气服务失败: %v", err)
+	}
+	go func() {
+		if err := http.Serve(listener, NewFakeWeatherServer()); err != nil {
+			log.Printf("假天气服务已退出: %v", err)
+		}
+	}()
+	return "http://" + listener.Addr().String(), nil
+}
+
+func (s *FakeWeatherServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	city, ok := s.lookup(r)
+	if !ok {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(map[string]string{"cod": "404", "message": "city not found"})
+		return
+	}
+	now := time.Now()
+	if s.Now != nil {
+		now = s.Now()
+	}
+
+	var body any
+	switch r.URL.Path {
+	case "/data/2.5/weather":
+		body = s.current(city, now)
+	case "/data/2.5/forecast":
+		body = s.forecast(city, now)
+	default:
+		http.NotFound(w, r)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(body)
+}
+
+// lookup 按 q 或 lat/lon 找城市, 经纬度附近没有认识的城市时城市名为空
+func (s *FakeWeatherServer) lookup(r *http.Request) (fakeCity, bool) {
+	query := r.URL.Query()
+	if q := query.Get("q"); q != "" {
+		name, _, _ := strings.Cut(q, ",")
+		name = strings.TrimSuffix(name, "市")
+		if name == "不存在" {
+			return fakeCity{}, false
+		}
+		for _, c := range fakeCities {
+			if c.name == name {
+				return c, true
+			}
+		}
+		return fakeCity{name: name}, true
+	}
+	lat, err1 := strconv.ParseFloat(query.Get("lat"), 64)
+	lon, err2 := strconv.ParseFloat(query.Get("lon"), 64)
+	if err1 != nil || err2 != nil {
+		return fakeCity{}, false
+	}
+	for _, c := range fakeCities {
+		if math.Abs(c.lat-lat) < 1 && math.Abs(c.lon-lon) < 1 {
+			return c, true
+		}
+	}
+	return fakeCity{lat: lat, lon: lon}, true
+}
+
+// fakeSlot 某个时刻的假天气
+type fakeSlot struct {
+	id          int
+	main        string
+	description string
+	temp        float64
+	humidity    int
+	pop         float64
+	rain        float64
+}
+
+func (s *FakeWeatherServer) slot(at, now time.Time) fakeSlot {
+	zone := time.FixedZone("", fakeTimezone)
+	local := at.In(zone)
+	day := int(startOfDay(local).Sub(startOfDay(now.In(zone))).Hours()+0.5) / 24
+	hour := local.Hour()
+	// 下午两点最热
+	temp := 14 + 5*math.Cos(float64(hour-14)/24*2*math.Pi)
+	slot := fakeSlot{id: 800, main: "Clear", description: "晴", temp: temp, humidity: 45}
+	switch {
+	case day == 0 && hour >= 12:
+		slot.id, slot.main, slot.description = 802, "Clouds", "多云"
+	case day == 1 && hour >= 12 && hour < 18:
+		slot = fakeSlot{id: 500, main: "Rain", description: "小雨", temp: temp - 3, humidity: 85, pop: 0.8, rain: 1.2}
+	case day == 1:
+		slot.id, slot.main, slot.description = 803, "Clouds", "多云"
+		slot.pop = 0.2
+	case day == 3:
+		slot.id, slot.main, slot.description = 804, "Clouds", "阴"
+	}
+	return slot
+}
+
+func (s *FakeWeatherServer) current(city fakeCity, now time.Time) map[string]any {
+	slot := s.slot(now, now)
+	return map[string]any{
+		"cod":  200,
+		"name": city.name,
+		"main": map[string]any{
+			"temp":       round1(slot.temp),
+			"feels_like": round1(slot.temp - 1),
+			"temp_min":   round1(slot.temp - 2),
+			"temp_max":   round1(slot.temp + 2),
+			"pressure":   1013,
+			"humidity":   slot.humidity,
+		},
+		"weather": []map[string]any{{"id": slot.id, "main": slot.main, "description": slot.description}},
+		"clouds":  map[string]any{"all": 20},
+		"sys":     map[string]any{"country": "CN"},
+	}
+}
+
+// forecast 从下一个整 3 小时开始的 40 个时段, 和真实接口一样不包含正在进行的时段
+func (s *FakeWeatherServer) forecast(city fakeCity, now time.Time) map[string]any {
+	start := now.UTC().Truncate(3 * time.Hour).Add(3 * time.Hour)
+	list := make([]map[string]any, 0, 40)
+	for i := 0; i < 40; i++ {
+		at := start.Add(time.Duration(i) * 3 * time.Hour)
+		slot := s.slot(at, now)
+		entry := map[string]any{
+			"dt": at.Unix(),
+			"main": map[string]any{
+				"temp":     round1(slot.temp),
+				"temp_min": round1(slot.temp - 1),
+				"temp_max": round1(slot.temp + 1),
+				"humidity": slot.humidity,
+			},
+			"weather": []map[string]any{{"id": slot.id, "main": slot.main, "description": slot.description}},
+			"pop":     slot.pop,
+			"dt_txt":  at.Format(time.DateTime),
+		}
+		if slot.rain > 0 {
+			entry["rain"] = map[string]any{"3h": slot.rain}
+		}
+		list = append(list, entry)
+	}
+	return map[string]any{
+		"cod":  "200",
+		"cnt":  len(list),
+		"list": list,
+		"city": map[string]any{
+			"name":     city.name,
+			"country":  "CN",
+			"timezone": fakeTimezone,
+			"coord":    map[string]any{"lat": city.lat, "lon": city.lon},
+		},
+	}
+}
+
+func round1(v float64) float64 {
+	return math.Round(v*10) / 10
+}
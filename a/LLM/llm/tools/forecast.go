@@ -0,0 +1,432 @@
+package tools
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// ForecastResponse OpenWeatherMap 5 天逐 3 小时预报
+type ForecastResponse struct {
+	Cod  string          `json:"cod"`
+	List []ForecastEntry `json:"list"`
+	City struct {
+		Name     string `json:"name"`
+		Country  string `json:"country"`
+		Timezone int    `json:"timezone"` // 与 UTC 相差的秒数
+	} `json:"city"`
+}
+
+// ForecastEntry 一个 3 小时时段
+type ForecastEntry struct {
+	Dt   int64 `json:"dt"`
+	Main struct {
+		Temp     float64 `json:"temp"`
+		TempMin  float64 `json:"temp_min"`
+		TempMax  float64 `json:"temp_max"`
+		Humidity int     `json:"humidity"`
+	} `json:"main"`
+	Weather []struct {
+		ID          int    `json:"id"`
+		Main        string `json:"main"`
+		Description string `json:"description"`
+	} `json:"weather"`
+	Pop  float64 `json:"pop"` // 降水概率 0~1
+	Rain struct {
+		ThreeHours float64 `json:"3h"`
+	} `json:"rain"`
+	Snow struct {
+		ThreeHours float64 `json:"3h"`
+	} `json:"snow"`
+}
+
+// 预报最多 5 天, 逐 3 小时共 40 个时段
+const (
+	maxForecastDays  = 5
+	minForecastHours = 3
+	maxForecastHours = 120
+)
+
+// now 当前时间, 决定哪天算今天, 测试时替换成固定的时间
+var now = time.Now
+
+// 降水概率达到多少就提醒带伞
+const umbrellaPop = 0.5
+
+// 城市预报查询参数
+type forecastByCityArgs struct {
+	City string `json:"city" desc:"城市名称，如：北京市"`
+	Days int    `json:"days,omitempty" desc:"从今天起预报几天, 1 到 5, 默认 3; 只问明天时填 2"`
+}
+
+func (a *forecastByCityArgs) Validate() error {
+	return validateDays(a.Days)
+}
+
+// 经纬度预报查询参数, 都不填时使用用户当前的位置
+type forecastByCoordinatesArgs struct {
+	Lat  *float64 `json:"lat,omitempty" desc:"纬度，例如：39.9042，查询用户所在地时不填"`
+	Lon  *float64 `json:"lon,omitempty" desc:"经度，例如：116.4074，查询用户所在地时不填"`
+	Days int      `json:"days,omitempty" desc:"从今天起预报几天, 1 到 5, 默认 3; 只问明天时填 2"`
+}
+
+func (a *forecastByCoordinatesArgs) Validate() error {
+	if err := validateCoordinates(a.Lat, a.Lon); err != nil {
+		return err
+	}
+	return validateDays(a.Days)
+}
+
+// 城市逐小时预报查询参数
+type hourlyByCityArgs struct {
+	City  string `json:"city" desc:"城市名称，如：北京市"`
+	Hours int    `json:"hours,omitempty" desc:"预报接下来多少小时, 3 到 120, 默认 12"`
+}
+
+func (a *hourlyByCityArgs) Validate() error {
+	return validateHours(a.Hours)
+}
+
+// 经纬度逐小时预报查询参数, 都不填时使用用户当前的位置
+type hourlyByCoordinatesArgs struct {
+	Lat   *float64 `json:"lat,omitempty" desc:"纬度，例如：39.9042，查询用户所在地时不填"`
+	Lon   *float64 `json:"lon,omitempty" desc:"经度，例如：116.4074，查询用户所在地时不填"`
+	Hours int      `json:"hours,omitempty" desc:"预报接下来多少小时, 3 到 120, 默认 12"`
+}
+
+func (a *hourlyByCoordinatesArgs) Validate() error {
+	if err := validateCoordinates(a.Lat, a.Lon); err != nil {
+		return err
+	}
+	return validateHours(a.Hours)
+}
+
+func validateDays(days int) error {
+	if days < 0 || days > maxForecastDays {
+		return fmt.Errorf("days 应在 1 到 %d 之间: %d", maxForecastDays, days)
+	}
+	return nil
+}
+
+// 预报按 3 小时一个时段, 不到 3 小时可能一个时段都没有; 0 表示使用默认值
+func validateHours(hours int) error {
+	if hours != 0 && (hours < minForecastHours || hours > maxForecastHours) {
+		return fmt.Errorf("hours 应在 %d 到 %d 之间: %d", minForecastHours, maxForecastHours, hours)
+	}
+	return nil
+}
+
+// 注册天气预报工具
+func init() {
+	Register(New("GetForecastByCity", "通过城市名称查询未来几天的天气预报, 按天汇总, 包括哪个时段有雨和要不要带伞",
+		func(ctx context.Context, args forecastByCityArgs) (string, error) {
+			return GetForecastByCity(ctx, args.City, args.Days)
+		}))
+	Register(New("GetForecastByCoordinates", "通过经纬度查询未来几天的天气预报, 按天汇总, 包括哪个时段有雨和要不要带伞; 用户问这里、本地明天的天气而没有说城市时不填经纬度, 使用用户当前的位置",
+		func(ctx context.Context, args forecastByCoordinatesArgs) (string, error) {
+			lat, lon, err := coordinates(ctx, args.Lat, args.Lon)
+			if err != nil {
+				return "", err
+			}
+			return GetForecastByCoordinates(ctx, lat, lon, args.Days)
+		}))
+	Register(New("GetHourlyForecastByCity", "通过城市名称查询接下来几个小时的逐 3 小时天气",
+		func(ctx context.Context, args hourlyByCityArgs) (string, error) {
+			return GetHourlyForecastByCity(ctx, args.City, args.Hours)
+		}))
+	Register(New("GetHourlyForecastByCoordinates", "通过经纬度查询接下来几个小时的逐 3 小时天气; 用户问这里、本地的天气而没有说城市时不填经纬度, 使用用户当前的位置",
+		func(ctx context.Context, args hourlyByCoordinatesArgs) (string, error) {
+			lat, lon, err := coordinates(ctx, args.Lat, args.Lon)
+			if err != nil {
+				return "", err
+			}
+			return GetHourlyForecastByCoordinates(ctx, lat, lon, args.Hours)
+		}))
+}
+
+func GetForecastByCity(ctx context.Context, city string, days int) (string, error) {
+	resp, err := getForecast(ctx, cityPlace(city))
+	if err != nil {
+		return "", err
+	}
+	return getForecastText(resp, days, now()), nil
+}
+
+func GetForecastByCoordinates(ctx context.Context, lat, lon float64, days int) (string, error) {
+	resp, err := getForecast(ctx, coordinatesPlace(lat, lon))
+	if err != nil {
+		return "", err
+	}
+	return getForecastText(resp, days, now()), nil
+}
+
+func GetHourlyForecastByCity(ctx context.Context, city string, hours int) (string, error) {
+	resp, err := getForecast(ctx, cityPlace(city))
+	if err != nil {
+		return "", err
+	}
+	return getHourlyText(resp, hours, now()), nil
+}
+
+func GetHourlyForecastByCoordinates(ctx context.Context, lat, lon float64, hours int) (string, error) {
+	resp, err := getForecast(ctx, coordinatesPlace(lat, lon))
+	if err != nil {
+		return "", err
+	}
+	return getHourlyText(resp, hours, now()), nil
+}
+
+func getForecast(ctx context.Context, place weatherPlace) (*ForecastResponse, error) {
+	var forecast ForecastResponse
+	if err := Weather.get(ctx, "forecast", place, &forecast); err != nil {
+		return nil, err
+	}
+	if forecast.Cod != "200" {
+		return nil, fmt.Errorf("API 返回错误: %s", forecast.Cod)
+	}
+	if len(forecast.List) == 0 {
+		return nil, fmt.Errorf("API 没有返回预报数据")
+	}
+	return &forecast, nil
+}
+
+// 一天分成四个时段, 用于描述"下午有雨"
+var dayParts = []struct {
+	name       string
+	start, end int // 当地时间的小时, 左闭右开
+}{
+	{"凌晨", 0, 6},
+	{"上午", 6, 12},
+	{"下午", 12, 18},
+	{"晚上", 18, 24},
+}
+
+// dayForecast 一天的汇总
+type dayForecast struct {
+	date         time.Time
+	tempMin      float64
+	tempMax      float64
+	maxPop       float64
+	rain, snow   float64           // 降水量, 毫米
+	descriptions map[string]int    // 天气描述出现的时段数
+	order        []string          // 天气描述第一次出现的顺序
+	wetParts     map[string]string // 有降水的时段和降水类型
+}
+
+// getForecastText 把逐 3 小时预报按当地日期汇总成每天一行
+func getForecastText(forecast *ForecastResponse, days int, now time.Time) string {
+	if days <= 0 {
+		days = 3
+	}
+	zone := forecastZone(forecast)
+	today := startOfDay(now.In(zone))
+
+	var summaries []*dayForecast
+	byDate := map[string]*dayForecast{}
+	for _, entry := range forecast.List {
+		at := time.Unix(entry.Dt, 0).In(zone)
+		date := startOfDay(at)
+		if date.Before(today) || date.Sub(today) >= time.Duration(days)*24*time.Hour {
+			continue
+		}
+		day, ok := byDate[date.Format(time.DateOnly)]
+		if !ok {
+			day = &dayForecast{
+				date:         date,
+				tempMin:      entry.Main.TempMin,
+				tempMax:      entry.Main.TempMax,
+				descriptions: map[string]int{},
+				wetParts:     map[string]string{},
+			}
+			byDate[date.Format(time.DateOnly)] = day
+			summaries = append(summaries, day)
+		}
+		day.add(entry, at.Hour())
+	}
+	if len(summaries) == 0 {
+		return "没有查到这几天的天气预报"
+	}
+
+	var b strings.Builder
+	if forecast.City.Name != "" {
+		fmt.Fprintf(&b, "为您播报%s的天气预报：\n", forecast.City.Name)
+	} else {
+		b.WriteString("为您播报的天气预报：\n")
+	}
+	for _, day := range summaries {
+		b.WriteString(day.text(today))
+		b.WriteString("\n")
+	}
+	return b.String()
+}
+
+func (d *dayForecast) add(entry ForecastEntry, hour int) {
+	d.tempMin = min(d.tempMin, entry.Main.TempMin)
+	d.tempMax = max(d.tempMax, entry.Main.TempMax)
+	d.maxPop = max(d.maxPop, entry.Pop)
+	d.rain += entry.Rain.ThreeHours
+	d.snow += entry.Snow.ThreeHours
+	if len(entry.Weather) > 0 {
+		description := entry.Weather[0].Description
+		if d.descriptions[description] == 0 {
+			d.order = append(d.order, description)
+		}
+		d.descriptions[description]++
+	}
+	if kind := precipitation(entry); kind != "" {
+		for _, part := range dayParts {
+			if hour >= part.start && hour < part.end {
+				if _, ok := d.wetParts[part.name]; !ok {
+					d.wetParts[part.name] = kind
+				}
+			}
+		}
+	}
+}
+
+// text 例如: 明天(10月19日 周日): 多云转小雨, 12~18摄氏度, 下午有雨, 降水概率80%, 建议带伞
+func (d *dayForecast) text(today time.Time) string {
+	var b strings.Builder
+	weekday := weekdayNames[d.date.Weekday()]
+	if name := dayName(d.date, today); name != weekday {
+		fmt.Fprintf(&b, "%s(%d月%d日 %s): ", name, d.date.Month(), d.date.Day(), weekday)
+	} else {
+		fmt.Fprintf(&b, "%d月%d日 %s: ", d.date.Month(), d.date.Day(), weekday)
+	}
+	b.WriteString(d.mainDescription())
+	fmt.Fprintf(&b, ", %.0f~%.0f摄氏度", d.tempMin, d.tempMax)
+
+	var wet []string
+	for _, part := range dayParts {
+		if kind, ok := d.wetParts[part.name]; ok {
+			wet = append(wet, part.name+"有"+kind)
+		}
+	}
+	if len(wet) > 0 {
+		b.WriteString(", " + strings.Join(wet, ", "))
+	}
+	if d.maxPop > 0 {
+		fmt.Fprintf(&b, ", 降水概率%.0f%%", d.maxPop*100)
+	}
+	if d.rain+d.snow > 0 {
+		fmt.Fprintf(&b, ", 降水量约%.1f毫米", d.rain+d.snow)
+	}
+	if d.needUmbrella() {
+		b.WriteString(", 建议带伞")
+	} else {
+		b.WriteString(", 不用带伞")
+	}
+	return b.String()
+}
+
+// mainDescription 出现最多的两种天气, 按一天里出现的先后用"转"连起来
+func (d *dayForecast) mainDescription() string {
+	if len(d.order) == 0 {
+		return "暂无天气描述"
+	}
+	top := append([]string(nil), d.order...)
+	sort.SliceStable(top, func(i, j int) bool {
+		return d.descriptions[top[i]] > d.descriptions[top[j]]
+	})
+	if len(top) == 1 {
+		return top[0]
+	}
+	for _, description := range d.order {
+		if description == top[0] {
+			return top[0] + "转" + top[1]
+		}
+		if description == top[1] {
+			return top[1] + "转" + top[0]
+		}
+	}
+	return top[0]
+}
+
+func (d *dayForecast) needUmbrella() bool {
+	return len(d.wetParts) > 0 || d.maxPop >= umbrellaPop
+}
+
+// precipitation 这个时段有没有雨雪, 返回"雨"、"雪"或空
+func precipitation(entry ForecastEntry) string {
+	if entry.Snow.ThreeHours > 0 {
+		return "雪"
+	}
+	if entry.Rain.ThreeHours > 0 {
+		return "雨"
+	}
+	if len(entry.Weather) > 0 {
+		switch entry.Weather[0].Main {
+		case "Rain", "Drizzle", "Thunderstorm":
+			return "雨"
+		case "Snow":
+			return "雪"
+		}
+	}
+	return ""
+}
+
+// getHourlyText 接下来几小时的逐 3 小时天气, 每个时段一行
+func getHourlyText(forecast *ForecastResponse, hours int, now time.Time) string {
+	if hours <= 0 {
+		hours = 12
+	}
+	zone := forecastZone(forecast)
+	today := startOfDay(now.In(zone))
+	end := now.Add(time.Duration(hours) * time.Hour)
+
+	var b strings.Builder
+	if forecast.City.Name != "" {
+		fmt.Fprintf(&b, "为您播报%s接下来%d小时的天气：\n", forecast.City.Name, hours)
+	} else {
+		fmt.Fprintf(&b, "为您播报接下来%d小时的天气：\n", hours)
+	}
+	count := 0
+	for _, entry := range forecast.List {
+		at := time.Unix(entry.Dt, 0)
+		// 包含正在进行的时段
+		if at.Add(3*time.Hour).Before(now) || at.After(end) {
+			continue
+		}
+		local := at.In(zone)
+		fmt.Fprintf(&b, "%s%d点: ", dayName(startOfDay(local), today), local.Hour())
+		if len(entry.Weather) > 0 {
+			b.WriteString(entry.Weather[0].Description + ", ")
+		}
+		fmt.Fprintf(&b, "%.0f摄氏度, 湿度%d%%", entry.Main.Temp, entry.Main.Humidity)
+		if entry.Pop > 0 {
+			fmt.Fprintf(&b, ", 降水概率%.0f%%", entry.Pop*100)
+		}
+		b.WriteString("\n")
+		count++
+	}
+	if count == 0 {
+		return "没有查到接下来几小时的天气预报"
+	}
+	return b.String()
+}
+
+var weekdayNames = [...]string{"周日", "周一", "周二", "周三", "周四", "周五", "周六"}
+
+// dayName 今天、明天、后天, 再往后用星期
+func dayName(date, today time.Time) string {
+	switch int(date.Sub(today).Hours()+0.5) / 24 {
+	case 0:
+		return "今天"
+	case 1:
+		return "明天"
+	case 2:
+		return "后天"
+	}
+	return weekdayNames[date.Weekday()]
+}
+
+// forecastZone 预报所在城市的时区, 按当地日期汇总
+func forecastZone(forecast *ForecastResponse) *time.Location {
+	return time.FixedZone("", forecast.City.Timezone)
+}
+
+func startOfDay(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+}
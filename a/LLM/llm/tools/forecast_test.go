@@ -0,0 +1,135 @@
+package tools
+
+import (
+	"context"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+// 2026-10-18 周日 08:00 北京时间
+var fixedNow = time.Date(2026, 10, 18, 8, 0, 0, 0, time.FixedZone("", fakeTimezone))
+
+// withFakeWeather 把天气客户端指向固定时间的假天气服务
+func withFakeWeather(t *testing.T) {
+	t.Helper()
+	server := httptest.NewServer(&FakeWeatherServer{Now: func() time.Time { return fixedNow }})
+	oldWeather, oldNow := Weather, now
+	cfg := DefaultWeatherClientConfig()
+	cfg.BaseURL = server.URL
+	cfg.Retries = 0
+	Weather = NewWeatherClient(cfg)
+	now = func() time.Time { return fixedNow }
+	t.Cleanup(func() {
+		Weather, now = oldWeather, oldNow
+		server.Close()
+	})
+}
+
+// callTool 和大模型一样通过默认注册表调用工具
+func callTool(t *testing.T, ctx context.Context, name, arguments string) string {
+	t.Helper()
+	msg := Default.Call(ctx, openai.ToolCall{ID: "call-1", Function: openai.FunctionCall{Name: name, Arguments: arguments}})
+	if strings.HasPrefix(msg.Content, "错误") {
+		t.Fatalf("%s(%s) 失败: %s", name, arguments, msg.Content)
+	}
+	return msg.Content
+}
+
+// dayLine 找出某一天的那一行
+func dayLine(t *testing.T, text, prefix string) string {
+	t.Helper()
+	for _, line := range strings.Split(text, "\n") {
+		if strings.HasPrefix(line, prefix) {
+			return line
+		}
+	}
+	t.Fatalf("没有 %s 开头的一行:\n%s", prefix, text)
+	return ""
+}
+
+func TestForecastByCity(t *testing.T) {
+	withFakeWeather(t)
+	text := callTool(t, context.Background(), "GetForecastByCity", `{"city":"北京市","days":3}`)
+
+	if !strings.HasPrefix(text, "为您播报北京的天气预报") {
+		t.Errorf("城市名不对:\n%s", text)
+	}
+	today := dayLine(t, text, "今天(10月18日 周日)")
+	for _, want := range []string{"晴转多云", "不用带伞"} {
+		if !strings.Contains(today, want) {
+			t.Errorf("今天应包含 %q: %s", want, today)
+		}
+	}
+	tomorrow := dayLine(t, text, "明天(10月19日 周一)")
+	for _, want := range []string{"下午有雨", "降水概率80%", "建议带伞"} {
+		if !strings.Contains(tomorrow, want) {
+			t.Errorf("明天应包含 %q: %s", want, tomorrow)
+		}
+	}
+	if strings.Contains(tomorrow, "上午有雨") || strings.Contains(tomorrow, "晚上有雨") {
+		t.Errorf("明天只有下午有雨: %s", tomorrow)
+	}
+	dayLine(t, text, "后天(10月20日 周二)")
+	if strings.Contains(text, "10月21日") {
+		t.Errorf("days=3 不应包含第四天:\n%s", text)
+	}
+}
+
+func TestForecastByCoordinates(t *testing.T) {
+	withFakeWeather(t)
+	text := callTool(t, context.Background(), "GetForecastByCoordinates", `{"lat":31.2304,"lon":121.4737,"days":5}`)
+	if !strings.HasPrefix(text, "为您播报上海的天气预报") {
+		t.Errorf("经纬度应查到上海:\n%s", text)
+	}
+	if line := dayLine(t, text, "明天"); !strings.Contains(line, "下午有雨") || !strings.Contains(line, "建议带伞") {
+		t.Errorf("明天下午有雨, 应建议带伞: %s", line)
+	}
+	if line := dayLine(t, text, "10月21日 周三"); !strings.HasPrefix(line, "10月21日 周三: 阴") || !strings.Contains(line, "不用带伞") {
+		t.Errorf("大后天阴, 不用带伞: %s", line)
+	}
+
+	// 不填经纬度时使用用户当前的位置
+	ctx := WithLocation(context.Background(), Location{Latitude: 39.9, Longitude: 116.4})
+	text = callTool(t, ctx, "GetForecastByCoordinates", `{"days":2}`)
+	if !strings.HasPrefix(text, "为您播报北京的天气预报") {
+		t.Errorf("应使用用户当前的位置:\n%s", text)
+	}
+}
+
+func TestHourlyForecast(t *testing.T) {
+	withFakeWeather(t)
+	text := callTool(t, context.Background(), "GetHourlyForecastByCity", `{"city":"北京","hours":6}`)
+	// 假服务从 11 点的时段开始, 6 小时内是 11 点和 14 点
+	for _, want := range []string{"今天11点: 晴", "今天14点: 多云"} {
+		if !strings.Contains(text, want) {
+			t.Errorf("应包含 %q:\n%s", want, text)
+		}
+	}
+	if strings.Contains(text, "17点") {
+		t.Errorf("超出 6 小时:\n%s", text)
+	}
+
+	// 最短 3 小时, 保证至少有一个时段
+	text = callTool(t, context.Background(), "GetHourlyForecastByCoordinates", `{"lat":39.9042,"lon":116.4074,"hours":3}`)
+	if !strings.Contains(text, "今天11点") {
+		t.Errorf("3 小时内应返回最近的时段:\n%s", text)
+	}
+}
+
+func TestForecastArgs(t *testing.T) {
+	withFakeWeather(t)
+	for _, args := range []string{`{"city":"北京","hours":121}`, `{"city":"北京","hours":2}`, `{"city":"北京","hours":-1}`} {
+		msg := Default.Call(context.Background(), openai.ToolCall{Function: openai.FunctionCall{Name: "GetHourlyForecastByCity", Arguments: args}})
+		if !strings.Contains(msg.Content, "hours 应在 3 到 120 之间") {
+			t.Errorf("%s 应报参数错误: %s", args, msg.Content)
+		}
+	}
+	msg := Default.Call(context.Background(), openai.ToolCall{Function: openai.FunctionCall{Name: "GetForecastByCity", Arguments: `{"city":"不存在"}`}})
+	if !strings.HasPrefix(msg.Content, "错误") {
+		t.Errorf("不存在的城市应报错: %s", msg.Content)
+	}
+}
@@ -0,0 +1,23 @@
+package tools
+
+import "context"
+
+// Location 用户的位置, 由前端上报
+type Location struct {
+	Latitude  float64
+	Longitude float64
+	Accuracy  float64 // 精度, 单位米
+}
+
+type locationKey struct{}
+
+// WithLocation 把用户当前的位置交给本次请求中调用的工具
+func WithLocation(ctx context.Context, loc Location) context.Context {
+	return context.WithValue(ctx, locationKey{}, loc)
+}
+
+// LocationFrom 取出用户当前的位置, 前端没有上报时 ok 为 false
+func LocationFrom(ctx context.Context) (loc Location, ok bool) {
+	loc, ok = ctx.Value(locationKey{}).(Location)
+	return loc, ok
+}
@@ -0,0 +1,244 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"reflect"
+	"strings"
+	"sync"
+
+	"github.com/sashabaranov/go-openai"
+)
+
+// Tool 一个可供大模型调用的工具, 用 New 创建
+type Tool struct {
+	Name        string
+	Description string
+	Parameters  map[string]interface{} // JSON schema
+	required    []string
+	call        func(ctx context.Context, arguments []byte) (string, error)
+}
+
+// Validator 参数结构体可以实现它做额外校验
+type Validator interface {
+	Validate() error
+}
+
+// New 用参数结构体 T 描述一个工具
+// T 的字段用 json 标签命名, desc 标签写说明, 没有 omitempty 的字段为必填,
+// 大模型传来的参数会自动解码、校验后交给 handler
+func New[T any](name, description string, handler func(ctx context.Context, args T) (string, error)) Tool {
+	var zero T
+	schema, required := objectSchema(reflect.TypeOf(zero))
+	return Tool{
+		Name:        name,
+		Description: description,
+		Parameters:  schema,
+		required:    required,
+		call: func(ctx context.Context, arguments []byte) (string, error) {
+			var args T
+			if err := json.Unmarshal(arguments, &args); err != nil {
+				return "", fmt.Errorf("参数无效 - %v", err)
+			}
+			if v, ok := any(&args).(Validator); ok {
+				if err := v.Validate(); err != nil {
+					return "", fmt.Errorf("参数无效 - %v", err)
+				}
+			}
+			return handler(ctx, args)
+		},
+	}
+}
+
+// Definition 转换为请求里的工具声明
+func (t Tool) Definition() openai.Tool {
+	return openai.Tool{
+		Type: openai.ToolTypeFunction,
+		Function: &openai.FunctionDefinition{
+			Name:        t.Name,
+			Description: t.Description,
+			Parameters:  t.Parameters,
+		},
+	}
+}
+
+// Registry 工具注册表
+type Registry struct {
+	mu    sync.RWMutex
+	tools map[string]Tool
+	order []string
+}
+
+func NewRegistry() *Registry {
+	return &Registry{tools: make(map[string]Tool)}
+}
+
+// Default 内置工具在各自文件的 init 里注册到这里
+var Default = NewRegistry()
+
+// Register 注册到默认注册表
+func Register(t Tool) {
+	Default.Register(t)
+}
+
+// Register 重名时覆盖旧的工具
+func (r *Registry) Register(t Tool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.tools[t.Name]; !ok {
+		r.order = append(r.order, t.Name)
+	}
+	r.tools[t.Name] = t
+}
+
+// Definitions 按注册顺序返回所有工具声明
+func (r *Registry) Definitions() []openai.Tool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	definitions := make([]openai.Tool, 0, len(r.order))
+	for _, name := range r.order {
+		definitions = append(definitions, r.tools[name].Definition())
+	}
+	return definitions
+}
+
+// Has 是否注册了这个工具
+func (r *Registry) Has(name string) bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	_, ok := r.tools[name]
+	return ok
+}
+
+// Subset 只包含指定工具的新注册表, names 为空时返回 r 本身
+func (r *Registry) Subset(names []string) (*Registry, error) {
+	if len(names) == 0 {
+		return r, nil
+	}
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	subset := NewRegistry()
+	for _, name := range names {
+		t, ok := r.tools[name]
+		if !ok {
+			return nil, fmt.Errorf("未知的工具: %s", name)
+		}
+		if _, dup := subset.tools[name]; dup {
+			continue
+		}
+		subset.tools[name] = t
+		subset.order = append(subset.order, name)
+	}
+	return subset, nil
+}
+
+// Call 执行一次工具调用, 出错时也返回 tool 消息, 避免大模型报错
+func (r *Registry) Call(ctx context.Context, toolCall openai.ToolCall) openai.ChatCompletionMessage {
+	name := toolCall.Function.Name
+	content, err := r.call(ctx, name, toolCall.Function.Arguments)
+	if err != nil {
+		log.Printf("工具 %s 调用失败: %v", name, err)
+		content = fmt.Sprintf("错误: %v", err)
+	}
+	return openai.ChatCompletionMessage{
+		Role:       openai.ChatMessageRoleTool,
+		Name:       name,
+		Content:    content,
+		ToolCallID: toolCall.ID,
+	}
+}
+
+func (r *Registry) call(ctx context.Context, name, arguments string) (string, error) {
+	r.mu.RLock()
+	t, ok := r.tools[name]
+	r.mu.RUnlock()
+	if !ok {
+		return "", fmt.Errorf("未知的工具: %s", name)
+	}
+
+	if strings.TrimSpace(arguments) == "" {
+		arguments = "{}"
+	}
+	var raw map[string]json.RawMessage
+	if err := json.Unmarshal([]byte(arguments), &raw); err != nil {
+		return "", fmt.Errorf("参数无效 - %v", err)
+	}
+	var missing []string
+	for _, field := range t.required {
+		if v, ok := raw[field]; !ok || isEmptyJSON(v) {
+			missing = append(missing, field)
+		}
+	}
+	if len(missing) > 0 {
+		return "", fmt.Errorf("缺少参数: %s", strings.Join(missing, ", "))
+	}
+	return t.call(ctx, []byte(arguments))
+}
+
+func isEmptyJSON(v json.RawMessage) bool {
+	s := strings.TrimSpace(string(v))
+	return s == "" || s == "null" || s == `""`
+}
+
+// objectSchema 由结构体生成 JSON schema 和必填字段列表
+func objectSchema(t reflect.Type) (map[string]interface{}, []string) {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	properties := map[string]interface{}{}
+	required := []string{}
+	if t.Kind() == reflect.Struct {
+		for i := 0; i < t.NumField(); i++ {
+			field := t.Field(i)
+			if !field.IsExported() {
+				continue
+			}
+			name, opts, _ := strings.Cut(field.Tag.Get("json"), ",")
+			if name == "-" {
+				continue
+			}
+			if name == "" {
+				name = field.Name
+			}
+			property := typeSchema(field.Type)
+			if desc := field.Tag.Get("desc"); desc != "" {
+				property["description"] = desc
+			}
+			properties[name] = property
+			if !strings.Contains(opts, "omitempty") {
+				required = append(required, name)
+			}
+		}
+	}
+	return map[string]interface{}{
+		"type":       "object",
+		"properties": properties,
+		"required":   required,
+	}, required
+}
+
+func typeSchema(t reflect.Type) map[string]interface{} {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	switch t.Kind() {
+	case reflect.String:
+		return map[string]interface{}{"type": "string"}
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]interface{}{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]interface{}{"type": "number"}
+	case reflect.Slice, reflect.Array:
+		return map[string]interface{}{"type": "array", "items": typeSchema(t.Elem())}
+	case reflect.Struct:
+		schema, _ := objectSchema(t)
+		return schema
+	default:
+		return map[string]interface{}{}
+	}
+}
@@ -1,15 +1,4 @@
 package tools
 
-import (
-	"github.com/sashabaranov/go-openai"
-	"main/client"
-)
-
-var Tools = []openai.Tool{}
-var WeatherAPIKey = client.WeatherAPIKey
-
-func GetTools() []openai.Tool {
-	Tools = append(Tools, getWeatherByCoordinatesFunction())
-	Tools = append(Tools, getWeatherByCityFunction())
-	return Tools
-}
+// Weather 天气工具使用的客户端, 启动时由 main 按配置替换
+var Weather = NewWeatherClient(DefaultWeatherClientConfig())
@@ -2,12 +2,8 @@
 package tools
 
 import (
-	"encoding/json"
+	"context"
 	"fmt"
-	"github.com/sashabaranov/go-openai"
-	"io"
-	"log"
-	"net/http"
 )
 
 type WeatherResponse struct {
@@ -34,57 +30,84 @@ type WeatherResponse struct {
 	Cod  int    `json:"cod"`
 }
 
-func GetWeatherByCoordinates(lat, lon string) string {
-	url := fmt.Sprintf("https://api.openweathermap.org/data/2.5/weather?lat=%s&lon=%s&appid=%s&units=metric", lat, lon, WeatherAPIKey)
-	resp, err := getWeatherByUrl(url)
-	if err != nil {
-		log.Println(err)
-		return ""
-	}
-	return getWeatherText(resp)
+// 城市天气查询参数
+type weatherByCityArgs struct {
+	City string `json:"city" desc:"城市名称，如：北京市"`
 }
 
-func GetWeatherByCity(city string) string {
-	url := fmt.Sprintf("https://api.openweathermap.org/data/2.5/weather?q=%s,cn&APPID=%s&units=metric", city, WeatherAPIKey)
-	resp, err := getWeatherByUrl(url)
-	if err != nil {
-		log.Println(err)
-		return ""
-	}
-	return getWeatherText(resp)
+// 经纬度天气查询参数, 都不填时使用用户当前的位置
+type weatherByCoordinatesArgs struct {
+	Lat *float64 `json:"lat,omitempty" desc:"纬度，例如：39.9042，查询用户所在地时不填"`
+	Lon *float64 `json:"lon,omitempty" desc:"经度，例如：116.4074，查询用户所在地时不填"`
 }
 
-func getWeatherByUrl(url string) (*WeatherResponse, error) {
-	if url == "" {
-		return nil, fmt.Errorf("url is empty")
-	}
+func (a *weatherByCoordinatesArgs) Validate() error {
+	return validateCoordinates(a.Lat, a.Lon)
+}
 
-	resp, err := http.Get(url)
-	if err != nil {
-		return nil, fmt.Errorf("发送请求失败: %v", err)
+// validateCoordinates 经纬度要么都填要么都不填
+func validateCoordinates(lat, lon *float64) error {
+	if (lat == nil) != (lon == nil) {
+		return fmt.Errorf("经纬度需要同时提供")
 	}
-	defer resp.Body.Close()
+	if lat != nil && (*lat < -90 || *lat > 90 || *lon < -180 || *lon > 180) {
+		return fmt.Errorf("经纬度超出范围: lat=%v, lon=%v", *lat, *lon)
+	}
+	return nil
+}
 
-	if resp.StatusCode != http.StatusOK {
-		body, _ := io.ReadAll(resp.Body)
-		return nil, fmt.Errorf("API 请求失败，状态码: %d, 响应: %s", resp.StatusCode, string(body))
+// coordinates 没有填经纬度时使用用户当前的位置
+func coordinates(ctx context.Context, lat, lon *float64) (float64, float64, error) {
+	if lat != nil {
+		return *lat, *lon, nil
+	}
+	loc, ok := LocationFrom(ctx)
+	if !ok {
+		return 0, 0, fmt.Errorf("不知道用户当前的位置, 请询问用户所在的城市")
 	}
+	return loc.Latitude, loc.Longitude, nil
+}
+
+// 注册天气查询工具
+func init() {
+	Register(New("GetWeatherByCity", "通过城市名称查询当前天气",
+		func(ctx context.Context, args weatherByCityArgs) (string, error) {
+			return GetWeatherByCity(ctx, args.City)
+		}))
+	Register(New("GetWeatherByCoordinates", "通过经纬度查询当前天气, 用户问这里、本地的天气而没有说城市时不填经纬度, 使用用户当前的位置",
+		func(ctx context.Context, args weatherByCoordinatesArgs) (string, error) {
+			lat, lon, err := coordinates(ctx, args.Lat, args.Lon)
+			if err != nil {
+				return "", err
+			}
+			return GetWeatherByCoordinates(ctx, lat, lon)
+		}))
+}
 
-	body, err := io.ReadAll(resp.Body)
+func GetWeatherByCoordinates(ctx context.Context, lat, lon float64) (string, error) {
+	resp, err := getWeather(ctx, coordinatesPlace(lat, lon))
 	if err != nil {
-		return nil, fmt.Errorf("读取响应体失败: %v", err)
+		return "", err
 	}
+	return getWeatherText(resp), nil
+}
 
-	var weatherResp WeatherResponse
-	err = json.Unmarshal(body, &weatherResp)
+func GetWeatherByCity(ctx context.Context, city string) (string, error) {
+	resp, err := getWeather(ctx, cityPlace(city))
 	if err != nil {
-		return nil, fmt.Errorf("解析 JSON 失败: %v", err)
+		return "", err
 	}
+	return getWeatherText(resp), nil
+}
 
+func getWeather(ctx context.Context, place weatherPlace) (*WeatherResponse, error) {
+	var weatherResp WeatherResponse
+	if err := Weather.get(ctx, "weather", place, &weatherResp); err != nil {
+		return nil, err
+	}
 	if weatherResp.Cod != 200 {
 		return nil, fmt.Errorf("API 返回错误: %d, %v", weatherResp.Cod, weatherResp)
 	}
-
 	return &weatherResp, nil
 }
 
@@ -104,56 +127,10 @@ func getWeatherText(weather *WeatherResponse) string {
 		answer += fmt.Sprintf("今天天气%s，", weather.Weather[0].Description)
 	}
 	answer += fmt.Sprintf("当前温度%.1f摄氏度, 体感: %.1f摄氏度\n", weather.Main.Temp, weather.Main.FeelsLike)
-	//answer += fmt.Sprintf("最高%.1f摄氏度, 最低:  %.1f摄氏度\n", weather.Main.TempMax, weather.Main.TempMin)
-	//answer += fmt.Sprintf("空气湿度 %d%%\n", weather.Main.Humidity)
-	//answer += fmt.Sprintf("大气气压 %d 百帕\n", weather.Main.Pressure)
+	answer += fmt.Sprintf("最高%.1f摄氏度, 最低:  %.1f摄氏度\n", weather.Main.TempMax, weather.Main.TempMin)
+	answer += fmt.Sprintf("空气湿度 %d%%\n", weather.Main.Humidity)
+	answer += fmt.Sprintf("大气气压 %d 百帕\n", weather.Main.Pressure)
 	//answer += fmt.Sprintf("云量 %d%%\n", weather.Clouds.All)
 	//answer += "以上就是今天的天气情况"
 	return answer
 }
-
-// getWeatherByCityFunction 注册城市天气查询函数到 Tool 调用系统
-func getWeatherByCityFunction() openai.Tool {
-	return openai.Tool{
-		Type: "function",
-		Function: &openai.FunctionDefinition{
-			Name:        "GetWeatherByCity",
-			Description: "通过城市名称查询当前天气",
-			Parameters: map[string]interface{}{
-				"type": "object",
-				"properties": map[string]interface{}{
-					"city": map[string]interface{}{
-						"type":        "string",
-						"description": "城市名称，如：北京市",
-					},
-				},
-				"required": []string{"city"},
-			},
-		},
-	}
-}
-
-// getWeatherByCoordinatesFunction 注册经纬度天气查询函数到 Tool 调用系统
-func getWeatherByCoordinatesFunction() openai.Tool {
-	return openai.Tool{
-		Type: "function",
-		Function: &openai.FunctionDefinition{
-			Name:        "GetWeatherByCoordinates",
-			Description: "通过经纬度查询当前天气",
-			Parameters: map[string]interface{}{
-				"type": "object",
-				"properties": map[string]interface{}{
-					"lat": map[string]interface{}{
-						"type":        "number",
-						"description": "纬度，例如：39.9042",
-					},
-					"lon": map[string]interface{}{
-						"type":        "number",
-						"description": "经度，例如：116.4074",
-					},
-				},
-				"required": []string{"lat", "lon"},
-			},
-		},
-	}
-}
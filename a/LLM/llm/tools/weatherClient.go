@@ -0,0 +1,252 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"net/http"
+	neturl "net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// WeatherClientConfig 天气接口客户端配置
+type WeatherClientConfig struct {
+	BaseURL  string        // OpenWeatherMap 的地址
+	APIKey   string        // OpenWeatherMap 的 key
+	Timeout  time.Duration // 单次请求超时
+	Retries  int           // 网络错误、限流或服务端错误时最多重试几次
+	Backoff  time.Duration // 第一次重试前等待的时间, 之后每次翻倍
+	CacheTTL time.Duration // 同一地点的结果缓存多久, 0 表示不缓存
+}
+
+// DefaultWeatherClientConfig 默认配置, 和 config 的默认值一致
+func DefaultWeatherClientConfig() WeatherClientConfig {
+	return WeatherClientConfig{
+		BaseURL:  "https://api.openweathermap.org",
+		Timeout:  5 * time.Second,
+		Retries:  2,
+		Backoff:  300 * time.Millisecond,
+		CacheTTL: 10 * time.Minute,
+	}
+}
+
+// 缓存最多保存多少个地点, 超过后先清掉过期的, 仍然超过就清空
+const maxWeatherCacheEntries = 1000
+
+// WeatherClient 带超时、重试和缓存的 OpenWeatherMap 客户端
+type WeatherClient struct {
+	cfg  WeatherClientConfig
+	http *http.Client
+
+	mu    sync.Mutex
+	cache map[string]weatherCacheEntry
+	stats WeatherStats
+}
+
+type weatherCacheEntry struct {
+	body    []byte
+	expires time.Time
+}
+
+// WeatherStats 缓存命中和接口调用统计
+type WeatherStats struct {
+	Hits     int64 `json:"hits"`     // 直接用缓存回答
+	Misses   int64 `json:"misses"`   // 缓存里没有或已过期
+	Requests int64 `json:"requests"` // 实际发出的请求数, 包括重试
+	Retries  int64 `json:"retries"`
+	Errors   int64 `json:"errors"`  // 重试后仍然失败
+	Entries  int   `json:"entries"` // 当前缓存的地点数
+}
+
+func NewWeatherClient(cfg WeatherClientConfig) *WeatherClient {
+	return &WeatherClient{
+		cfg:   cfg,
+		http:  &http.Client{Timeout: cfg.Timeout},
+		cache: make(map[string]weatherCacheEntry),
+	}
+}
+
+// Stats 当前的统计
+func (c *WeatherClient) Stats() WeatherStats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	stats := c.stats
+	stats.Entries = len(c.cache)
+	return stats
+}
+
+// StatsHandler 以 JSON 返回统计, 用于观察缓存效果
+func (c *WeatherClient) StatsHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(c.Stats())
+	})
+}
+
+// weatherPlace 查询的地点, 城市名或经纬度
+type weatherPlace struct {
+	city     string
+	lat, lon float64
+}
+
+func cityPlace(city string) weatherPlace {
+	return weatherPlace{city: normalizeCity(city)}
+}
+
+// coordinatesPlace 经纬度保留两位小数, 约 1 公里, 附近的查询共用缓存
+func coordinatesPlace(lat, lon float64) weatherPlace {
+	return weatherPlace{lat: roundCoordinate(lat), lon: roundCoordinate(lon)}
+}
+
+// normalizeCity "北京市"、" 北京 " 都按 "北京" 查询
+func normalizeCity(city string) string {
+	city = strings.ToLower(strings.TrimSpace(city))
+	if trimmed := strings.TrimSuffix(city, "市"); trimmed != "" {
+		city = trimmed
+	}
+	return city
+}
+
+func roundCoordinate(v float64) float64 {
+	return math.Round(v*100) / 100
+}
+
+func (p weatherPlace) query() neturl.Values {
+	if p.city != "" {
+		return neturl.Values{"q": {p.city + ",cn"}}
+	}
+	return neturl.Values{
+		"lat": {strconv.FormatFloat(p.lat, 'f', 2, 64)},
+		"lon": {strconv.FormatFloat(p.lon, 'f', 2, 64)},
+	}
+}
+
+func (p weatherPlace) key() string {
+	if p.city != "" {
+		return "city:" + p.city
+	}
+	return fmt.Sprintf("coord:%.2f,%.2f", p.lat, p.lon)
+}
+
+// get 查询 endpoint(weather 或 forecast) 并把响应解析到 v, 缓存没过期时不再请求
+func (c *WeatherClient) get(ctx context.Context, endpoint string, place weatherPlace, v any) error {
+	key := endpoint + "|" + place.key()
+	body, ok := c.cached(key)
+	if !ok {
+		var err error
+		body, err = c.fetch(ctx, endpoint, place.query())
+		if err != nil {
+			return err
+		}
+	}
+	if err := json.Unmarshal(body, v); err != nil {
+		return fmt.Errorf("解析 JSON 失败: %v", err)
+	}
+	if !ok {
+		c.store(key, body)
+	}
+	return nil
+}
+
+func (c *WeatherClient) cached(key string) ([]byte, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entry, ok := c.cache[key]
+	if ok && time.Now().Before(entry.expires) {
+		c.stats.Hits++
+		return entry.body, true
+	}
+	c.stats.Misses++
+	return nil, false
+}
+
+func (c *WeatherClient) store(key string, body []byte) {
+	if c.cfg.CacheTTL <= 0 {
+		return
+	}
+	now := time.Now()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(c.cache) >= maxWeatherCacheEntries {
+		for k, entry := range c.cache {
+			if now.After(entry.expires) {
+				delete(c.cache, k)
+			}
+		}
+		if len(c.cache) >= maxWeatherCacheEntries {
+			c.cache = make(map[string]weatherCacheEntry)
+		}
+	}
+	c.cache[key] = weatherCacheEntry{body: body, expires: now.Add(c.cfg.CacheTTL)}
+}
+
+// fetch 请求接口, 网络错误、429 和 5xx 按指数退避重试
+func (c *WeatherClient) fetch(ctx context.Context, endpoint string, query neturl.Values) ([]byte, error) {
+	query.Set("appid", c.cfg.APIKey)
+	query.Set("units", "metric")
+	query.Set("lang", "zh_cn")
+	url := strings.TrimSuffix(c.cfg.BaseURL, "/") + "/data/2.5/" + endpoint + "?" + query.Encode()
+
+	backoff := c.cfg.Backoff
+	for attempt := 0; ; attempt++ {
+		body, retry, err := c.do(ctx, url)
+		if err == nil {
+			return body, nil
+		}
+		if !retry || attempt >= c.cfg.Retries || ctx.Err() != nil {
+			c.mu.Lock()
+			c.stats.Errors++
+			c.mu.Unlock()
+			return nil, err
+		}
+		log.Printf("天气接口请求失败, %v 后第 %d 次重试: %v", backoff, attempt+1, err)
+		select {
+		case <-time.After(backoff):
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+		backoff *= 2
+		c.mu.Lock()
+		c.stats.Retries++
+		c.mu.Unlock()
+	}
+}
+
+// do 发出一次请求, retry 表示失败后值得重试
+func (c *WeatherClient) do(ctx context.Context, url string) (body []byte, retry bool, err error) {
+	c.mu.Lock()
+	c.stats.Requests++
+	c.mu.Unlock()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, false, fmt.Errorf("创建请求失败: %v", err)
+	}
+	resp, err := c.http.Do(req)
+	if err != nil {
+		// 地址里带着 appid, 错误信息只保留原因, 免得 key 出现在日志和工具结果里
+		var urlErr *neturl.Error
+		if errors.As(err, &urlErr) {
+			err = urlErr.Err
+		}
+		return nil, true, fmt.Errorf("发送请求失败: %v", err)
+	}
+	defer resp.Body.Close()
+
+	body, err = io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, true, fmt.Errorf("读取响应体失败: %v", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		retry = resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500
+		return nil, retry, fmt.Errorf("API 请求失败，状态码: %d, 响应: %s", resp.StatusCode, string(body))
+	}
+	return body, false, nil
+}
@@ -0,0 +1,109 @@
+package LLM
+
+import (
+	"context"
+	"main/LLM/llm/LLMConfigs"
+	"main/LLM/llm/tools"
+	"strings"
+	"testing"
+
+	ark "github.com/sashabaranov/go-openai"
+)
+
+// collect 读完一次回复, 返回显示的文本和合成的句子
+func collect(reply *Reply) (string, []string) {
+	var text strings.Builder
+	var sentences []string
+	for chunk := range reply.Chunks {
+		text.WriteString(chunk.Delta)
+		if chunk.Sentence != "" {
+			sentences = append(sentences, chunk.Sentence)
+		}
+	}
+	return text.String(), sentences
+}
+
+func TestAskScripted(t *testing.T) {
+	provider := LLMConfigs.NewScriptedProvider("fake", "[开心]你好呀。今天想聊什么？")
+	c := NewLLMContext(provider, "你是一只猫娘", "", DefaultOptions())
+
+	text, sentences := collect(c.Ask(context.Background(), "你好"))
+	if text != "你好呀。今天想聊什么？" {
+		t.Errorf("显示的文本应去掉情感标签: %q", text)
+	}
+	if strings.Join(sentences, "|") != "你好呀。|今天想聊什么？" {
+		t.Errorf("句子 %q", sentences)
+	}
+
+	// 预设回复用完后复述, 历史记录里保留情感标签
+	text, _ = collect(c.Ask(context.Background(), "再见"))
+	if text != "你说的是: 再见" {
+		t.Errorf("复述 %q", text)
+	}
+	messages := c.Messages()
+	if got := messages[len(messages)-3].Content; got != "[开心]你好呀。今天想聊什么？" {
+		t.Errorf("历史记录 %q", got)
+	}
+}
+
+func TestAskToolCall(t *testing.T) {
+	var asked string
+	toolset := tools.NewRegistry()
+	toolset.Register(tools.New("GetWeatherByCity", "查询天气", func(ctx context.Context, args struct {
+		City string `json:"city"`
+	}) (string, error) {
+		asked = args.City
+		return args.City + "晴, 25度", nil
+	}))
+	provider := LLMConfigs.NewScriptedProviderWithMessages("fake",
+		ark.ChatCompletionMessage{
+			Role: ark.ChatMessageRoleAssistant,
+			ToolCalls: []ark.ToolCall{{ID: "call-1", Type: ark.ToolTypeFunction,
+				Function: ark.FunctionCall{Name: "GetWeatherByCity", Arguments: `{"city":"北京"}`}}},
+		},
+		ark.ChatCompletionMessage{Role: ark.ChatMessageRoleAssistant, Content: "北京今天晴, 25度。"},
+	)
+	c := NewLLMContextWithMessages(provider, []ark.ChatCompletionMessage{
+		{Role: ark.ChatMessageRoleSystem, Content: "你是天气助手"},
+	}, toolset, DefaultOptions())
+
+	text, _ := collect(c.Ask(context.Background(), "北京天气怎么样"))
+	if asked != "北京" {
+		t.Errorf("工具收到的城市 %q", asked)
+	}
+	if text != "北京今天晴, 25度。" {
+		t.Errorf("回答 %q", text)
+	}
+
+	// 用户问题、工具调用、工具结果、回答按顺序记入历史
+	messages := c.Messages()[1:]
+	roles := make([]string, len(messages))
+	for i, m := range messages {
+		roles[i] = m.Role
+	}
+	if strings.Join(roles, ",") != "user,assistant,tool,assistant" {
+		t.Fatalf("历史记录的角色 %v", roles)
+	}
+	if messages[2].ToolCallID != "call-1" || messages[2].Content != "北京晴, 25度" {
+		t.Errorf("工具结果 %+v", messages[2])
+	}
+}
+
+func TestEmotionTagsOption(t *testing.T) {
+	opening := []ark.ChatCompletionMessage{{Role: ark.ChatMessageRoleSystem, Content: "你是助手"}}
+	for _, tags := range []bool{true, false} {
+		opts := DefaultOptions()
+		opts.EmotionTags = tags
+		c := NewLLMContextWithMessages(LLMConfigs.NewScriptedProvider("fake"), opening, nil, opts)
+		c.mu.Lock()
+		prompt := c.prompt()
+		c.mu.Unlock()
+		found := false
+		for _, message := range prompt {
+			found = found || message.Content == emotionPrompt
+		}
+		if found != tags {
+			t.Errorf("EmotionTags 为 %v 时上下文里有没有情感标签的说明: %v", tags, found)
+		}
+	}
+}
@@ -0,0 +1,59 @@
+package LLM
+
+import (
+	"fmt"
+	"main/LLM/llm/LLMConfigs"
+	"sort"
+)
+
+// Provider 大模型后端, 见 LLMConfigs.Provider
+type Provider = LLMConfigs.Provider
+
+// Providers 可供会话选择的大模型后端
+type Providers struct {
+	providers   map[string]Provider
+	defaultName string
+}
+
+func NewProviders() *Providers {
+	return &Providers{providers: make(map[string]Provider)}
+}
+
+// Add 按名称注册后端, 第一个注册的后端作为默认后端
+func (p *Providers) Add(name string, provider Provider) {
+	if p.defaultName == "" {
+		p.defaultName = name
+	}
+	p.providers[name] = provider
+}
+
+// Get 按名称查找后端, 名称为空时返回默认后端
+func (p *Providers) Get(name string) (Provider, error) {
+	if name == "" {
+		name = p.defaultName
+	}
+	provider, ok := p.providers[name]
+	if !ok {
+		return nil, fmt.Errorf("未知的大模型后端: %s", name)
+	}
+	return provider, nil
+}
+
+// SetDefault 修改默认后端
+func (p *Providers) SetDefault(name string) error {
+	if _, ok := p.providers[name]; !ok {
+		return fmt.Errorf("未知的大模型后端: %s", name)
+	}
+	p.defaultName = name
+	return nil
+}
+
+// Names 所有后端名称
+func (p *Providers) Names() []string {
+	names := make([]string, 0, len(p.providers))
+	for name := range p.providers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
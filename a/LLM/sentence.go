@@ -0,0 +1,60 @@
+package LLM
+
+import (
+	"strings"
+	"unicode/utf8"
+)
+
+// 句子结束的标点, 遇到就可以把前面的内容送去合成
+const sentenceEnds = "。！？；!?;\n"
+
+// 紧跟在句末标点后面, 应当归到同一句的字符
+const sentenceTrailers = "。！？；!?;\n”’\"')）】~～"
+
+// SentenceSplitter 把流式文本增量按句切分
+type SentenceSplitter struct {
+	buf strings.Builder
+}
+
+// Feed 追加一段增量, 返回已经完整的句子
+// 句末标点在缓冲区末尾时先不切, 等下一段确认后面没有紧跟的标点或引号
+func (s *SentenceSplitter) Feed(delta string) []string {
+	s.buf.WriteString(delta)
+	text := s.buf.String()
+
+	var sentences []string
+	start := 0
+	for i := 0; i < len(text); {
+		r, size := utf8.DecodeRuneInString(text[i:])
+		i += size
+		if !strings.ContainsRune(sentenceEnds, r) {
+			continue
+		}
+		// 吃掉后面紧跟的标点和引号
+		for i < len(text) {
+			next, nextSize := utf8.DecodeRuneInString(text[i:])
+			if !strings.ContainsRune(sentenceTrailers, next) {
+				break
+			}
+			i += nextSize
+		}
+		if i == len(text) {
+			break
+		}
+		if sentence := strings.TrimSpace(text[start:i]); sentence != "" {
+			sentences = append(sentences, sentence)
+		}
+		start = i
+	}
+
+	s.buf.Reset()
+	s.buf.WriteString(text[start:])
+	return sentences
+}
+
+// Flush 返回剩下的内容, 回复结束时调用
+func (s *SentenceSplitter) Flush() string {
+	rest := strings.TrimSpace(s.buf.String())
+	s.buf.Reset()
+	return rest
+}
@@ -4,16 +4,25 @@ import (
 	asr "github.com/tencentcloud/tencentcloud-sdk-go/tencentcloud/asr/v20190614"
 	"github.com/tencentcloud/tencentcloud-sdk-go/tencentcloud/common"
 	"github.com/tencentcloud/tencentcloud-sdk-go/tencentcloud/common/profile"
-	"main/client"
 )
 
 type ASRClient struct {
-	client *asr.Client
+	client    *asr.Client
+	appId     string
+	secretId  string
+	secretKey string
+	// 实时识别的 WebSocket 地址, 测试时换成本地的假服务
+	endpoint string
 }
+
+// 腾讯云实时语音识别的地址
+const tencentASREndpoint = "wss://asr.cloud.tencent.com"
+
 type ASRResponse struct {
 	Code      int    `json:"code"`
 	Message   string `json:"message"`
 	MessageID string `json:"message_id"`
+	Final     int    `json:"final"` // 1 表示整个识别流结束
 	Result    struct {
 		SliceType    int         `json:"slice_type"`
 		Index        int         `json:"index"`
@@ -29,10 +38,10 @@ type ASRStreamer struct {
 	audioChan chan []byte
 }
 
-func NewASRClient() (*ASRClient, error) {
+func NewASRClient(appId, secretId, secretKey string) (*ASRClient, error) {
 	credential := common.NewCredential(
-		client.SecretId,
-		client.SecretKey,
+		secretId,
+		secretKey,
 	)
 	cpf := profile.NewClientProfile()
 	cpf.HttpProfile.Endpoint = "asr.tencentcloudapi.com" // 设置接口地址
@@ -41,5 +50,11 @@ func NewASRClient() (*ASRClient, error) {
 		return nil, err
 	}
 
-	return &ASRClient{client: client}, nil
+	return &ASRClient{
+		client:    client,
+		appId:     appId,
+		secretId:  secretId,
+		secretKey: secretKey,
+		endpoint:  tencentASREndpoint,
+	}, nil
 }
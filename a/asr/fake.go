@@ -0,0 +1,73 @@
+package asr
+
+import (
+	"context"
+	"log"
+)
+
+// 16k 16bit 单声道, 每秒 32000 字节
+const bytesPerSecond = 16000 * 2
+
+// ScriptedRecognizer 本地假识别后端, 不需要云端凭证
+// 每收到 BytesPerUtterance 字节音频就按顺序吐出一句预设文本,
+// 先给出半句中间结果, 再给出整句最终结果, 文本用完后循环
+type ScriptedRecognizer struct {
+	Transcripts       []string
+	BytesPerUtterance int
+}
+
+func NewScriptedRecognizer(transcripts ...string) *ScriptedRecognizer {
+	if len(transcripts) == 0 {
+		transcripts = []string{"你好", "今天北京天气怎么样", "谢谢你"}
+	}
+	return &ScriptedRecognizer{
+		Transcripts:       transcripts,
+		BytesPerUtterance: 2 * bytesPerSecond,
+	}
+}
+
+// Recognize 实现 Recognizer
+func (s *ScriptedRecognizer) Recognize(ctx context.Context, audioStream <-chan []byte, resultChan chan<- Result) error {
+	log.Printf("使用本地假识别后端, 共 %d 句预设文本", len(s.Transcripts))
+	var received, next int
+	var sentInterim bool
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case data, ok := <-audioStream:
+			if !ok {
+				return nil
+			}
+			if len(s.Transcripts) == 0 {
+				continue
+			}
+			received += len(data)
+			text := []rune(s.Transcripts[next%len(s.Transcripts)])
+
+			if !sentInterim && received >= s.BytesPerUtterance/2 {
+				sentInterim = true
+				if !s.send(ctx, resultChan, Result{Text: string(text[:(len(text)+1)/2]), Index: next, SliceType: 1}) {
+					return nil
+				}
+			}
+			if received >= s.BytesPerUtterance {
+				if !s.send(ctx, resultChan, Result{Text: string(text), Index: next, SliceType: 2, Final: true}) {
+					return nil
+				}
+				received = 0
+				sentInterim = false
+				next++
+			}
+		}
+	}
+}
+
+func (s *ScriptedRecognizer) send(ctx context.Context, resultChan chan<- Result, result Result) bool {
+	select {
+	case resultChan <- result:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
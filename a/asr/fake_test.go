@@ -0,0 +1,45 @@
+package asr
+
+import (
+	"context"
+	"testing"
+)
+
+func TestScriptedRecognizer(t *testing.T) {
+	s := NewScriptedRecognizer("你好", "再见")
+	s.BytesPerUtterance = 100
+	audioStream := make(chan []byte)
+	resultChan := make(chan Result, 10)
+	done := make(chan error)
+	go func() { done <- s.Recognize(context.Background(), audioStream, resultChan) }()
+
+	for range 6 {
+		audioStream <- make([]byte, 50)
+	}
+	close(audioStream)
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	close(resultChan)
+
+	want := []Result{
+		{Text: "你", Index: 0, SliceType: 1},
+		{Text: "你好", Index: 0, SliceType: 2, Final: true},
+		{Text: "再", Index: 1, SliceType: 1},
+		{Text: "再见", Index: 1, SliceType: 2, Final: true},
+		{Text: "你", Index: 2, SliceType: 1},
+		{Text: "你好", Index: 2, SliceType: 2, Final: true},
+	}
+	var got []Result
+	for r := range resultChan {
+		got = append(got, r)
+	}
+	if len(got) != len(want) {
+		t.Fatalf("得到 %d 个结果, 应为 %d: %+v", len(got), len(want), got)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("第 %d 个结果 %+v, 应为 %+v", i, got[i], want[i])
+		}
+	}
+}
@@ -0,0 +1,35 @@
+package asr
+
+import (
+	"context"
+	"fmt"
+)
+
+// Result 一次识别返回的结果
+// 一段话会被切成多句, 每句有自己的 Index, 同一句会先后返回多次中间结果, 最后一次 Final 为 true
+type Result struct {
+	Text      string // 本句当前的识别文本
+	Index     int    // 句子序号, 在一次识别流中递增
+	SliceType int    // 0 一句开始, 1 识别中, 2 一句结束
+	Final     bool   // 是否为一句话的最终结果, false 为中间结果
+	StreamEnd bool   // 整个识别流结束, 之后不会再有结果
+}
+
+// Recognizer 语音识别后端
+// 从 audioStream 读取 16k 16bit 单声道 PCM, 识别结果写入 resultChan,
+// ctx 结束或音频流关闭时返回 nil, 后端出错时返回原因, 由调用方告诉前端
+type Recognizer interface {
+	Recognize(ctx context.Context, audioStream <-chan []byte, resultChan chan<- Result) error
+}
+
+// NewRecognizer 按名称创建识别后端, 可选 tencent(默认) 和 fake
+func NewRecognizer(provider, appId, secretId, secretKey string) (Recognizer, error) {
+	switch provider {
+	case "", "tencent":
+		return NewASRClient(appId, secretId, secretKey)
+	case "fake":
+		return NewScriptedRecognizer(), nil
+	default:
+		return nil, fmt.Errorf("未知的ASR后端: %s", provider)
+	}
+}
@@ -2,23 +2,30 @@ package asr
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"github.com/gorilla/websocket"
 	"log"
-	"main/client"
+	"sync"
 	"time"
 )
 
+// Recognize 实现 Recognizer, 使用腾讯云实时语音识别
+func (c *ASRClient) Recognize(ctx context.Context, audioStream <-chan []byte, resultChan chan<- Result) error {
+	return c.StartWebSocketStream(ctx, audioStream, resultChan)
+}
+
 // 流式连接实现实时转文字
-func (c *ASRClient) StartWebSocketStream(ctx context.Context, audioStream <-chan []byte, resultChan chan<- string) error {
+// 音频流关闭或 ctx 结束时返回 nil; 连接失败、识别服务返回错误或连接中途断开时返回原因
+func (c *ASRClient) StartWebSocketStream(ctx context.Context, audioStream <-chan []byte, resultChan chan<- Result) error {
 	voiceId := fmt.Sprintf("voice-%d", time.Now().UnixNano())
-	wsURL := buildASRWebSocketURL(client.AppId, client.SecretId, client.SecretKey, voiceId)
+	wsURL := buildASRWebSocketURL(c.endpoint, c.appId, c.secretId, c.secretKey, voiceId)
 
 	// 2. 建立 WebSocket 连接
 	//log.Printf("连接地址: %s", wsURL)
 	conn, _, err := websocket.DefaultDialer.Dial(wsURL, nil)
 	if err != nil {
-		log.Fatalf("WebSocket连接失败: %v", err)
+		return fmt.Errorf("WebSocket连接失败: %v", err)
 	}
 	log.Printf("websocket连接成功")
 	defer conn.Close()
@@ -27,6 +34,20 @@ func (c *ASRClient) StartWebSocketStream(ctx context.Context, audioStream <-chan
 	innerCtx, cancel := context.WithCancel(ctx)
 	defer cancel()
 
+	// 识别中途出错的原因, 只记第一个, 两个协程都可能出错
+	var (
+		errMu     sync.Mutex
+		streamErr error
+	)
+	fail := func(err error) {
+		errMu.Lock()
+		if streamErr == nil && innerCtx.Err() == nil {
+			streamErr = err
+		}
+		errMu.Unlock()
+		cancel()
+	}
+
 	// 4 实时处理音频流
 	go func() {
 		defer func() {
@@ -41,7 +62,13 @@ func (c *ASRClient) StartWebSocketStream(ctx context.Context, audioStream <-chan
 		for {
 
 			select {
-			case data := <-audioStream:
+			case data, ok := <-audioStream:
+				if !ok {
+					// 音频结束, 下一轮发送剩余数据和结束消息
+					audioStream = nil
+					cancel()
+					continue
+				}
 				buffer = append(buffer, data...)
 			case <-ticker.C:
 				if len(buffer) >= 1280 {
@@ -50,8 +77,7 @@ func (c *ASRClient) StartWebSocketStream(ctx context.Context, audioStream <-chan
 					buffer = buffer[1280:] // 剩余数据保留
 					//log.Printf("发送给腾讯云的数据: %v", chunk[:10])
 					if err := conn.WriteMessage(websocket.BinaryMessage, chunk); err != nil {
-						log.Printf("发送音频数据失败: %v", err)
-						cancel()
+						fail(fmt.Errorf("发送音频数据失败: %v", err))
 						return
 					}
 				}
@@ -80,6 +106,8 @@ func (c *ASRClient) StartWebSocketStream(ctx context.Context, audioStream <-chan
 			conn.Close()
 			cancel()
 		}()
+		// 收到 final 之后服务端断开是正常结束
+		ended := false
 		for {
 			select {
 			case <-innerCtx.Done():
@@ -87,18 +115,29 @@ func (c *ASRClient) StartWebSocketStream(ctx context.Context, audioStream <-chan
 			default:
 				_, msg, err := conn.ReadMessage()
 				if err != nil {
-					log.Printf("读取识别结果失败: %v", err)
-					//cancel() // 前端WebSocket关闭时，取消上下文
+					if !ended {
+						fail(fmt.Errorf("读取识别结果失败: %v", err))
+					}
 					return
 				}
 				//log.Printf("收到识别结果: %s", string(msg)) // 打印原始响应
-				text, err := extractVoiceText(msg)
+				result, err := extractResult(msg)
+				if errors.Is(err, ErrService) {
+					fail(err)
+					return
+				}
 				if err != nil {
 					log.Println("错误:", err)
 				} else {
-					//log.Println("识别文本:", text)
+					ended = result.StreamEnd
+					//log.Println("识别文本:", result.Text)
 					//log.Printf("将文本输入到chan")
-					resultChan <- text
+					select {
+					case resultChan <- result:
+					case <-innerCtx.Done():
+						// 会话已经结束, 没有人再读结果
+						return
+					}
 				}
 
 			}
@@ -106,5 +145,10 @@ func (c *ASRClient) StartWebSocketStream(ctx context.Context, audioStream <-chan
 	}()
 
 	<-innerCtx.Done()
-	return nil
+	errMu.Lock()
+	defer errMu.Unlock()
+	if ctx.Err() != nil {
+		return nil
+	}
+	return streamErr
 }
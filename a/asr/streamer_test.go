@@ -0,0 +1,117 @@
+package asr
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// fakeTencent 本地假实时识别服务, handle 决定连上之后怎么回复
+func fakeTencent(t *testing.T, handle func(conn *websocket.Conn)) *ASRClient {
+	t.Helper()
+	upgrader := websocket.Upgrader{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		handle(conn)
+	}))
+	t.Cleanup(server.Close)
+	return &ASRClient{appId: "1250000000", endpoint: "ws://" + strings.TrimPrefix(server.URL, "http://")}
+}
+
+// recognize 送入 audio 后等待 Recognize 返回, 返回收到的结果和错误
+func recognize(t *testing.T, c *ASRClient, audio [][]byte, closeAudio bool) ([]Result, error) {
+	t.Helper()
+	audioStream := make(chan []byte, len(audio))
+	for _, a := range audio {
+		audioStream <- a
+	}
+	if closeAudio {
+		close(audioStream)
+	}
+	resultChan := make(chan Result, 10)
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	err := c.Recognize(ctx, audioStream, resultChan)
+	if ctx.Err() != nil {
+		t.Fatal("Recognize 没有按时返回")
+	}
+	close(resultChan)
+	var results []Result
+	for r := range resultChan {
+		results = append(results, r)
+	}
+	return results, err
+}
+
+func TestStreamServiceError(t *testing.T) {
+	c := fakeTencent(t, func(conn *websocket.Conn) {
+		conn.WriteMessage(websocket.TextMessage, []byte(`{"code":4002,"message":"鉴权失败"}`))
+		conn.ReadMessage()
+	})
+	_, err := recognize(t, c, nil, false)
+	if !errors.Is(err, ErrService) || !strings.Contains(err.Error(), "4002") {
+		t.Fatalf("应返回识别服务的错误, 得到 %v", err)
+	}
+}
+
+func TestStreamDropped(t *testing.T) {
+	c := fakeTencent(t, func(conn *websocket.Conn) {
+		conn.WriteMessage(websocket.TextMessage, []byte(`{"code":0,"result":{"slice_type":1,"index":0,"voice_text_str":"你"}}`))
+		// 没有 final 就断开
+	})
+	results, err := recognize(t, c, nil, false)
+	if err == nil || !strings.Contains(err.Error(), "读取识别结果失败") {
+		t.Fatalf("连接中途断开应返回错误, 得到 %v", err)
+	}
+	if len(results) != 1 || results[0].Text != "你" {
+		t.Errorf("断开前的结果应照常交给调用方: %+v", results)
+	}
+}
+
+func TestStreamEnd(t *testing.T) {
+	c := fakeTencent(t, func(conn *websocket.Conn) {
+		conn.WriteMessage(websocket.TextMessage, []byte(`{"code":0,"result":{"slice_type":2,"index":0,"voice_text_str":"你好"}}`))
+		conn.WriteMessage(websocket.TextMessage, []byte(`{"code":0,"final":1}`))
+	})
+	results, err := recognize(t, c, nil, false)
+	if err != nil {
+		t.Fatalf("收到 final 后断开是正常结束, 得到 %v", err)
+	}
+	if len(results) != 2 || !results[0].Final || results[0].Text != "你好" || !results[1].StreamEnd {
+		t.Errorf("结果不对: %+v", results)
+	}
+}
+
+func TestStreamAudioClosed(t *testing.T) {
+	received := make(chan string, 1)
+	c := fakeTencent(t, func(conn *websocket.Conn) {
+		for {
+			_, msg, err := conn.ReadMessage()
+			if err != nil {
+				return
+			}
+			if strings.Contains(string(msg), `"end"`) {
+				received <- string(msg)
+				return
+			}
+		}
+	})
+	if _, err := recognize(t, c, [][]byte{make([]byte, 640)}, true); err != nil {
+		t.Fatalf("音频流关闭应返回 nil, 得到 %v", err)
+	}
+	select {
+	case <-received:
+	case <-time.After(time.Second):
+		t.Error("音频流关闭后应发送结束消息")
+	}
+}
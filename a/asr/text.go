@@ -6,22 +6,25 @@ import (
 	"crypto/sha1"
 	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
 	"math/rand"
 	"net/url"
+	"strings"
 	"time"
 )
 
-// 构建带签名的 ASR WebSocket URL
-func buildASRWebSocketURL(appid, secretID, secretKey, voiceID string) string {
-	host := "asr.cloud.tencent.com"
+// 构建带签名的 ASR WebSocket URL, endpoint 如 wss://asr.cloud.tencent.com
+func buildASRWebSocketURL(endpoint, appid, secretID, secretKey, voiceID string) string {
+	host := strings.TrimPrefix(strings.TrimPrefix(endpoint, "wss://"), "ws://")
 
 	params := url.Values{}
 	params.Add("secretid", secretID)
 	params.Add("timestamp", fmt.Sprintf("%d", time.Now().Unix()))
 	params.Add("expired", fmt.Sprintf("%d", time.Now().Add(24*time.Hour).Unix()))
 	params.Add("nonce", fmt.Sprintf("%d", rand.Int63n(10000000000)))
+	// 前端发来的其他格式在 link 里先转成 16k 单声道 16 位 PCM, 见 audio.RecognizerFormat
 	params.Add("engine_model_type", "16k_zh")
 	params.Add("voice_id", voiceID)
 	params.Add("voice_format", "1") // PCM
@@ -32,8 +35,8 @@ func buildASRWebSocketURL(appid, secretID, secretKey, voiceID string) string {
 
 	// 拼接最终 URL（避免双重编码）
 	wsURL := fmt.Sprintf(
-		"wss://%s/asr/v2/%s?%s&signature=%s",
-		host, appid, params.Encode(), signature,
+		"%s/asr/v2/%s?%s&signature=%s",
+		endpoint, appid, params.Encode(), signature,
 	)
 
 	return wsURL
@@ -60,26 +63,39 @@ func generateSignature(secretKey, appid, host string, params url.Values) string
 	return encodedSignature
 }
 
+// ErrService 识别服务返回了非 0 的 code, 服务端随后会断开, 这次识别不能继续
+var ErrService = errors.New("识别服务返回错误")
+
 // 处理asr返回的json数据
-func extractVoiceText(jsonData []byte) (string, error) {
+func extractResult(jsonData []byte) (Result, error) {
 	var resp ASRResponse
 	if err := json.Unmarshal(jsonData, &resp); err != nil {
-		return "", fmt.Errorf("解析JSON失败: %v", err)
+		return Result{}, fmt.Errorf("解析JSON失败: %v", err)
+	}
+	if resp.Code != 0 {
+		return Result{}, fmt.Errorf("%w: %d, %s", ErrService, resp.Code, resp.Message)
 	}
-	return resp.Result.VoiceTextStr, nil
+	// slice_type: 0 一句话开始, 1 识别中, 2 一句话结束
+	return Result{
+		Text:      resp.Result.VoiceTextStr,
+		Index:     resp.Result.Index,
+		SliceType: resp.Result.SliceType,
+		Final:     resp.Result.SliceType == 2,
+		StreamEnd: resp.Final == 1,
+	}, nil
 }
 
 // 测试用,接收识别结果并打印
-func PrintASRResults(resultChan <-chan string, ctx context.Context) {
+func PrintASRResults(resultChan <-chan Result, ctx context.Context) {
 
 	for {
 		select {
-		case text, ok := <-resultChan:
+		case result, ok := <-resultChan:
 			if !ok {
 				log.Println("【识别结果通道关闭】")
 				return
 			}
-			log.Printf("【实时识别结果】: %s", text)
+			log.Printf("【实时识别结果】: %s", result.Text)
 		case <-ctx.Done():
 			log.Println("【上下文取消，停止打印识别结果】")
 			return
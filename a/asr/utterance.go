@@ -0,0 +1,108 @@
+package asr
+
+import (
+	"sort"
+	"strings"
+)
+
+// Utterance 把一段话的多句识别结果按序号拼起来
+// 同一句的中间结果会被后来的结果覆盖, 已经交给大模型的句子不会再被计入
+type Utterance struct {
+	sentences map[int]string
+	final     map[int]bool
+	// 已经提交过的最大句子序号, 迟到的旧句子直接丢弃
+	committed int
+}
+
+func NewUtterance() *Utterance {
+	return &Utterance{
+		sentences: make(map[int]string),
+		final:     make(map[int]bool),
+		committed: -1,
+	}
+}
+
+// Add 记录一次识别结果, 属于已提交句子的结果返回 false
+func (u *Utterance) Add(result Result) bool {
+	if result.Index <= u.committed {
+		return false
+	}
+	if result.Text == "" && !result.Final {
+		return true
+	}
+	if u.final[result.Index] && !result.Final {
+		// 已经结束的句子不会再被中间结果覆盖
+		return true
+	}
+	u.sentences[result.Index] = result.Text
+	if result.Final {
+		u.final[result.Index] = true
+	}
+	return true
+}
+
+// Empty 还没有任何识别内容
+func (u *Utterance) Empty() bool {
+	for _, text := range u.sentences {
+		if text != "" {
+			return false
+		}
+	}
+	return true
+}
+
+// Pending 是否还有句子只有中间结果
+func (u *Utterance) Pending() bool {
+	for index := range u.sentences {
+		if !u.final[index] {
+			return true
+		}
+	}
+	return false
+}
+
+// Text 按顺序拼接所有句子, 包括还没结束的句子的中间结果
+func (u *Utterance) Text() string {
+	return u.join(false)
+}
+
+// FinalText 只拼接已经结束的句子
+func (u *Utterance) FinalText() string {
+	return u.join(true)
+}
+
+func (u *Utterance) join(finalOnly bool) string {
+	indexes := make([]int, 0, len(u.sentences))
+	for index := range u.sentences {
+		if finalOnly && !u.final[index] {
+			continue
+		}
+		indexes = append(indexes, index)
+	}
+	sort.Ints(indexes)
+	var b strings.Builder
+	for _, index := range indexes {
+		b.WriteString(u.sentences[index])
+	}
+	return b.String()
+}
+
+// Commit 取出整段话并清空, 之后到达的这些句子的结果会被丢弃
+// 有句子还没结束时用它的中间结果
+func (u *Utterance) Commit() string {
+	text := u.Text()
+	for index := range u.sentences {
+		if index > u.committed {
+			u.committed = index
+		}
+	}
+	u.sentences = make(map[int]string)
+	u.final = make(map[int]bool)
+	return text
+}
+
+// Reset 丢弃当前内容, 不影响已提交的序号
+func (u *Utterance) Reset() {
+	u.sentences = make(map[int]string)
+	u.final = make(map[int]bool)
+}
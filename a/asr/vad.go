@@ -0,0 +1,136 @@
+package asr
+
+import (
+	"encoding/binary"
+	"math"
+	"time"
+)
+
+// VADConfig 语音活动检测参数
+type VADConfig struct {
+	Hangover  time.Duration // 静音持续多久算说完
+	MinSpeech time.Duration // 连续说话多久才算开口, 过滤咳嗽和短促噪声
+	// MinEnergy 能量阈值下限(RMS, 0~1), 实际阈值还会随背景噪声自适应提高
+	MinEnergy float64
+	// MaxZCR 过零率上限, 超过的帧视为嘶嘶声一类的噪声, 除非能量足够大
+	MaxZCR float64
+}
+
+// DefaultVADConfig 说完后约 400ms 判定结束
+func DefaultVADConfig() VADConfig {
+	return VADConfig{
+		Hangover:  400 * time.Millisecond,
+		MinSpeech: 200 * time.Millisecond,
+		MinEnergy: 0.01,
+		MaxZCR:    0.4,
+	}
+}
+
+// VADEvent 说话状态变化
+type VADEvent int
+
+const (
+	SpeechStart VADEvent = iota + 1
+	SpeechEnd
+)
+
+const (
+	vadSampleRate = 16000
+	vadFrameSize  = vadSampleRate / 50 // 20ms 一帧
+	vadFrameTime  = 20 * time.Millisecond
+	// 背景噪声估计的平滑系数和阈值倍数
+	noiseSmoothing = 0.05
+	noiseRatio     = 3.0
+	// 说话时背景噪声估计上升的平滑系数, 一直不停的噪声几秒后就不再算作说话
+	noiseRise = 0.002
+)
+
+// VAD 基于短时能量和过零率的语音活动检测, 输入 16k 16bit 单声道 PCM
+// 不是并发安全的, 同一路音频在一个协程里调用
+type VAD struct {
+	cfg        VADConfig
+	pending    []byte
+	noiseFloor float64
+	speaking   bool
+	speechRun  time.Duration // 未开口时连续的说话时长
+	silenceRun time.Duration // 开口后连续的静音时长
+}
+
+func NewVAD(cfg VADConfig) *VAD {
+	return &VAD{cfg: cfg, noiseFloor: cfg.MinEnergy / noiseRatio}
+}
+
+// Speaking 当前是否在说话
+func (v *VAD) Speaking() bool {
+	return v.speaking
+}
+
+// Process 输入任意长度的 PCM, 返回这段音频中发生的状态变化
+func (v *VAD) Process(pcm []byte) []VADEvent {
+	v.pending = append(v.pending, pcm...)
+	var events []VADEvent
+	for len(v.pending) >= vadFrameSize*2 {
+		if event := v.processFrame(v.pending[:vadFrameSize*2]); event != 0 {
+			events = append(events, event)
+		}
+		v.pending = v.pending[vadFrameSize*2:]
+	}
+	return events
+}
+
+func (v *VAD) processFrame(frame []byte) VADEvent {
+	rms, zcr := frameFeatures(frame)
+	threshold := math.Max(v.cfg.MinEnergy, v.noiseFloor*noiseRatio)
+	isSpeech := rms > threshold && (zcr <= v.cfg.MaxZCR || rms > 4*threshold)
+	if !isSpeech && !v.speaking || rms < v.noiseFloor {
+		v.noiseFloor += noiseSmoothing * (rms - v.noiseFloor)
+	} else {
+		// 说话时跟踪能量的最小值: 字与字之间的停顿会把估计拉下来,
+		// 持续高于阈值的噪声则会让估计慢慢追上去
+		v.noiseFloor += noiseRise * (rms - v.noiseFloor)
+	}
+
+	if !v.speaking {
+		if !isSpeech {
+			v.speechRun = 0
+			return 0
+		}
+		v.speechRun += vadFrameTime
+		if v.speechRun >= v.cfg.MinSpeech {
+			v.speaking = true
+			v.silenceRun = 0
+			return SpeechStart
+		}
+		return 0
+	}
+
+	if isSpeech {
+		v.silenceRun = 0
+		return 0
+	}
+	v.silenceRun += vadFrameTime
+	if v.silenceRun >= v.cfg.Hangover {
+		v.speaking = false
+		v.speechRun = 0
+		return SpeechEnd
+	}
+	return 0
+}
+
+// frameFeatures 计算一帧的均方根能量(归一化到 0~1)和过零率
+func frameFeatures(frame []byte) (rms, zcr float64) {
+	n := len(frame) / 2
+	var sum float64
+	var crossings int
+	var prev int16
+	for i := 0; i < n; i++ {
+		sample := int16(binary.LittleEndian.Uint16(frame[i*2:]))
+		x := float64(sample) / math.MaxInt16
+		sum += x * x
+		if i > 0 && (sample >= 0) != (prev >= 0) {
+			crossings++
+		}
+		prev = sample
+	}
+	return math.Sqrt(sum / float64(n)), float64(crossings) / float64(n)
+}
@@ -0,0 +1,111 @@
+package asr
+
+import (
+	"encoding/binary"
+	"math"
+	"slices"
+	"testing"
+	"time"
+)
+
+// tone 生成 16k 16bit 的正弦波, amplitude 为 0 时是静音
+func tone(freq, amplitude float64, d time.Duration) []byte {
+	n := int(d.Seconds() * vadSampleRate)
+	pcm := make([]byte, 0, n*2)
+	for i := range n {
+		v := amplitude * math.Sin(2*math.Pi*freq*float64(i)/vadSampleRate)
+		pcm = binary.LittleEndian.AppendUint16(pcm, uint16(int16(v*math.MaxInt16)))
+	}
+	return pcm
+}
+
+// vadEvent 状态变化和它发生在第几毫秒
+type vadEvent struct {
+	event VADEvent
+	at    time.Duration
+}
+
+// runVAD 按 20ms 一块送入 pcm, 记下每次状态变化的时间
+func runVAD(v *VAD, pcm []byte) []vadEvent {
+	var events []vadEvent
+	const chunk = vadFrameSize * 2
+	for i := 0; i < len(pcm); i += chunk {
+		for _, e := range v.Process(pcm[i:min(i+chunk, len(pcm))]) {
+			events = append(events, vadEvent{e, time.Duration(i/chunk+1) * vadFrameTime})
+		}
+	}
+	return events
+}
+
+func kinds(events []vadEvent) []VADEvent {
+	var out []VADEvent
+	for _, e := range events {
+		out = append(out, e.event)
+	}
+	return out
+}
+
+func TestVADSpeechThenSilence(t *testing.T) {
+	v := NewVAD(DefaultVADConfig())
+	speech := time.Second
+	pcm := append(tone(220, 0.3, speech), tone(0, 0, time.Second)...)
+	events := runVAD(v, pcm)
+	if !slices.Equal(kinds(events), []VADEvent{SpeechStart, SpeechEnd}) {
+		t.Fatalf("状态变化 %v, 应为开口后说完", events)
+	}
+	if end := events[1].at - speech; end > 600*time.Millisecond {
+		t.Errorf("停止说话 %v 后才判定说完", end)
+	}
+	if v.Speaking() {
+		t.Error("说完后不应仍在说话")
+	}
+}
+
+func TestVADMinSpeech(t *testing.T) {
+	v := NewVAD(DefaultVADConfig())
+	// 比 MinSpeech 短的咔哒声
+	pcm := append(tone(0, 0, 200*time.Millisecond), tone(220, 0.3, 100*time.Millisecond)...)
+	pcm = append(pcm, tone(0, 0, time.Second)...)
+	if events := runVAD(v, pcm); len(events) != 0 {
+		t.Errorf("短促的声音不应算作开口, 得到 %v", events)
+	}
+}
+
+func TestVADHangover(t *testing.T) {
+	v := NewVAD(DefaultVADConfig())
+	// 中间停顿比 Hangover 短, 仍是同一句话
+	pcm := append(tone(220, 0.3, 500*time.Millisecond), tone(0, 0, 200*time.Millisecond)...)
+	pcm = append(pcm, tone(220, 0.3, 500*time.Millisecond)...)
+	pcm = append(pcm, tone(0, 0, time.Second)...)
+	if events := runVAD(v, pcm); !slices.Equal(kinds(events), []VADEvent{SpeechStart, SpeechEnd}) {
+		t.Errorf("状态变化 %v, 短停顿不应切断一句话", events)
+	}
+}
+
+func TestVADSteadyNoise(t *testing.T) {
+	v := NewVAD(DefaultVADConfig())
+	// 远高于 MinEnergy 的持续嗡嗡声, 一开始会被当成说话, 之后应判定说完且不再开口
+	events := runVAD(v, tone(100, 0.07, 10*time.Second))
+	if !slices.Equal(kinds(events), []VADEvent{SpeechStart, SpeechEnd}) {
+		t.Fatalf("状态变化 %v, 持续噪声应只在开始时误判一次", events)
+	}
+	if events[1].at > 6*time.Second {
+		t.Errorf("持续噪声 %v 后才判定说完", events[1].at)
+	}
+	if v.Speaking() {
+		t.Error("持续噪声不应一直算作说话")
+	}
+}
+
+func TestVADLongSpeech(t *testing.T) {
+	v := NewVAD(DefaultVADConfig())
+	// 十秒连续说话, 字与字之间有短停顿, 不应被背景噪声估计追上而中途判定说完
+	var pcm []byte
+	for range 40 {
+		pcm = append(pcm, tone(220, 0.3, 200*time.Millisecond)...)
+		pcm = append(pcm, tone(220, 0.002, 50*time.Millisecond)...)
+	}
+	if events := runVAD(v, pcm); !slices.Equal(kinds(events), []VADEvent{SpeechStart}) {
+		t.Errorf("状态变化 %v, 连续说话中不应判定说完", events)
+	}
+}
@@ -0,0 +1,61 @@
+package audio
+
+import (
+	"bytes"
+	"fmt"
+	"os/exec"
+	"strconv"
+	"strings"
+)
+
+// FFmpeg ffmpeg 可执行文件, 为空表示不使用. 用于编码 Go 里没有现成实现的压缩格式
+var FFmpeg = "ffmpeg"
+
+// FFmpegAvailable 能否找到 ffmpeg
+func FFmpegAvailable() bool {
+	if FFmpeg == "" {
+		return false
+	}
+	_, err := exec.LookPath(FFmpeg)
+	return err == nil
+}
+
+// 压缩格式的码率, 语音用不了太高
+const (
+	mp3Bitrate  = "48k"
+	opusBitrate = "24k"
+)
+
+// EncodePCM 用 ffmpeg 把 16bit 单声道 PCM 编码成 mp3 或 ogg 封装的 opus
+func EncodePCM(pcm []byte, sampleRate int, format string) ([]byte, error) {
+	var codec []string
+	switch format {
+	case "mp3":
+		codec = []string{"-c:a", "libmp3lame", "-b:a", mp3Bitrate, "-f", "mp3"}
+	case "opus":
+		codec = []string{"-c:a", "libopus", "-b:a", opusBitrate, "-application", "voip", "-f", "ogg"}
+	default:
+		return nil, fmt.Errorf("ffmpeg 不支持编码为 %s", format)
+	}
+	args := []string{"-hide_banner", "-loglevel", "error",
+		"-f", "s16le", "-ar", strconv.Itoa(sampleRate), "-ac", "1", "-i", "pipe:0"}
+	args = append(args, codec...)
+	args = append(args, "pipe:1")
+	return runFFmpeg(pcm, args)
+}
+
+// runFFmpeg 从标准输入送入 input, 返回标准输出
+func runFFmpeg(input []byte, args []string) ([]byte, error) {
+	if FFmpeg == "" {
+		return nil, fmt.Errorf("没有配置 ffmpeg")
+	}
+	cmd := exec.Command(FFmpeg, args...)
+	cmd.Stdin = bytes.NewReader(input)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("ffmpeg 执行失败: %v: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	return stdout.Bytes(), nil
+}
@@ -0,0 +1,82 @@
+package audio
+
+import "math"
+
+// 降采样前先低通滤波, 去掉新采样率表示不了的高频, 否则会折叠回来变成杂音(混叠)
+// 用 Blackman 窗的 sinc 做 FIR 滤波器, 不依赖任何库
+
+// 截止频率取新采样率奈奎斯特频率的这个比例, 留出过渡带
+const lowpassCutoff = 0.9
+
+// 每降一倍采样率用多少个抽头, 越多过渡带越窄, 计算量也越大
+const lowpassTapsPerRatio = 16
+
+// lowpassTaps 从 from Hz 降到 to Hz 用的滤波器系数, 抽头数为奇数, 系数之和为 1; 不是降采样时返回 nil
+func lowpassTaps(from, to int) []float64 {
+	if to >= from || to <= 0 {
+		return nil
+	}
+	ratio := float64(from) / float64(to)
+	n := int(math.Ceil(ratio*lowpassTapsPerRatio)) | 1
+	// 截止频率, 以输入采样率为 1
+	cutoff := lowpassCutoff * 0.5 / ratio
+	taps := make([]float64, n)
+	center := float64(n-1) / 2
+	var sum float64
+	for i := range taps {
+		x := float64(i) - center
+		v := 2 * cutoff
+		if x != 0 {
+			v = math.Sin(2*math.Pi*cutoff*x) / (math.Pi * x)
+		}
+		w := 0.42 - 0.5*math.Cos(2*math.Pi*float64(i)/float64(n-1)) + 0.08*math.Cos(4*math.Pi*float64(i)/float64(n-1))
+		taps[i] = v * w
+		sum += taps[i]
+	}
+	for i := range taps {
+		taps[i] /= sum
+	}
+	return taps
+}
+
+// lowpass 对一整段音频滤波, 以每个采样为中心, 不产生延迟; 两端之外按 0 算
+func lowpass(samples, taps []float64) []float64 {
+	half := len(taps) / 2
+	out := make([]float64, len(samples))
+	for i := range out {
+		var v float64
+		for k, tap := range taps {
+			if j := i + k - half; j >= 0 && j < len(samples) {
+				v += tap * samples[j]
+			}
+		}
+		out[i] = v
+	}
+	return out
+}
+
+// firFilter 对连续的音频流滤波, 记住上个包末尾的采样, 包和包之间接得上
+// 输出比输入晚 len(taps)/2 个采样, 48k 时不到 1ms
+type firFilter struct {
+	taps    []float64
+	history []float64 // 上个包最后 len(taps)-1 个采样, 开始时为 0
+}
+
+func newFIRFilter(taps []float64) *firFilter {
+	return &firFilter{taps: taps, history: make([]float64, len(taps)-1)}
+}
+
+// process 返回和输入一样多的滤波后的采样
+func (f *firFilter) process(samples []float64) []float64 {
+	buf := append(f.history, samples...)
+	out := make([]float64, len(samples))
+	for i := range out {
+		var v float64
+		for k, tap := range f.taps {
+			v += tap * buf[i+k]
+		}
+		out[i] = v
+	}
+	f.history = append(f.history[:0:0], buf[len(buf)-len(f.history):]...)
+	return out
+}
@@ -0,0 +1,94 @@
+package audio
+
+import (
+	"encoding/binary"
+	"math"
+	"testing"
+)
+
+// sine 一段 16 位单声道正弦波, 幅度为满量程的一半
+func sine(freq float64, sampleRate int, seconds float64) []byte {
+	n := int(float64(sampleRate) * seconds)
+	pcm := make([]byte, n*2)
+	for i := 0; i < n; i++ {
+		v := 0.5 * math.MaxInt16 * math.Sin(2*math.Pi*freq*float64(i)/float64(sampleRate))
+		binary.LittleEndian.PutUint16(pcm[i*2:], uint16(int16(v)))
+	}
+	return pcm
+}
+
+// rms 去掉开头和结尾各 10% 后的均方根, 避开滤波器两端的过渡
+func rms(pcm []byte) float64 {
+	n := len(pcm) / 2
+	var sum float64
+	count := 0
+	for i := n / 10; i < n-n/10; i++ {
+		v := float64(sample(pcm, i))
+		sum += v * v
+		count++
+	}
+	return math.Sqrt(sum / float64(count))
+}
+
+// gainDB 输出相对输入的增益
+func gainDB(in, out []byte) float64 {
+	return 20 * math.Log10(rms(out)/rms(in))
+}
+
+func TestResampleAntiAlias(t *testing.T) {
+	for _, from := range []int{44100, 48000} {
+		// 语音范围内的频率基本不衰减
+		pass := sine(1000, from, 0.5)
+		if g := gainDB(pass, Resample(pass, from, 16000)); g < -1 || g > 1 {
+			t.Errorf("%dHz 降到 16k, 1kHz 的增益 %.1fdB, 应接近 0", from, g)
+		}
+		// 12kHz 超出 16k 的奈奎斯特频率, 不滤波会折叠成 4kHz 左右的杂音
+		stop := sine(12000, from, 0.5)
+		if g := gainDB(stop, Resample(stop, from, 16000)); g > -40 {
+			t.Errorf("%dHz 降到 16k, 12kHz 只衰减了 %.1fdB", from, -g)
+		}
+	}
+}
+
+func TestInputConverterAntiAlias(t *testing.T) {
+	format := InputFormat{Encoding: EncodingS16LE, SampleRate: 48000, Channels: 1}
+	for _, tc := range []struct {
+		freq    float64
+		min     float64
+		max     float64
+		comment string
+	}{
+		{1000, -1, 1, "语音范围内基本不衰减"},
+		{12000, math.Inf(-1), -40, "超出奈奎斯特频率的要滤掉"},
+	} {
+		in := sine(tc.freq, 48000, 0.5)
+		c := NewInputConverter(format)
+		// 按不整齐的大小分包, 滤波和插值都要跨包接上
+		var out []byte
+		for rest := in; len(rest) > 0; {
+			n := min(len(rest), 1234)
+			out = append(out, c.Convert(rest[:n])...)
+			rest = rest[n:]
+		}
+		if g := gainDB(in, out); g < tc.min || g > tc.max {
+			t.Errorf("%.0fHz 增益 %.1fdB: %s", tc.freq, g, tc.comment)
+		}
+	}
+}
+
+func TestLowpassTaps(t *testing.T) {
+	if lowpassTaps(16000, 16000) != nil || lowpassTaps(8000, 16000) != nil {
+		t.Error("不是降采样时不需要滤波")
+	}
+	taps := lowpassTaps(48000, 16000)
+	if len(taps)%2 != 1 {
+		t.Errorf("抽头数应为奇数: %d", len(taps))
+	}
+	var sum float64
+	for _, tap := range taps {
+		sum += tap
+	}
+	if math.Abs(sum-1) > 1e-9 {
+		t.Errorf("系数之和应为 1: %v", sum)
+	}
+}
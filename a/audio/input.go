@@ -0,0 +1,237 @@
+package audio
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"slices"
+)
+
+// 前端发来的音频编码
+const (
+	EncodingS16LE = "s16le" // 16 位有符号整数, 小端
+	EncodingF32LE = "f32le" // 32 位浮点数, 小端, 取值 [-1,1], 浏览器 AudioWorklet 里拿到的就是这种
+	// 以下是 opus 压缩格式, 流量只有 PCM 的十分之一左右, 用 ffmpeg 解码
+	EncodingOpus = "opus" // 裸 opus 包, 每个二进制帧一个包
+	EncodingOgg  = "ogg"  // ogg 封装的 opus 流, 二进制帧按顺序拼起来是一个完整的文件
+	EncodingWebM = "webm" // webm 封装的 opus 流, 浏览器 MediaRecorder 默认录出来的就是这种
+)
+
+// InputFormat 前端发来的麦克风音频的格式, 多声道时按采样交错排列
+type InputFormat struct {
+	Encoding   string `json:"encoding"`
+	SampleRate int    `json:"sampleRate"`
+	Channels   int    `json:"channels"`
+}
+
+// RecognizerFormat 语音识别、VAD 和录音使用的格式, 其他格式的输入都先转换成这种
+var RecognizerFormat = InputFormat{Encoding: EncodingS16LE, SampleRate: 16000, Channels: 1}
+
+// 支持的输入采样率
+var inputSampleRates = []int{8000, 11025, 16000, 22050, 24000, 32000, 44100, 48000}
+
+// opus 编码器支持的采样率, 只用来填 ogg 头, 解码时都是 48k
+var opusSampleRates = []int{8000, 12000, 16000, 24000, 48000}
+
+// Compressed 是否是需要解码的压缩格式
+func (f InputFormat) Compressed() bool {
+	return f.Encoding == EncodingOpus || f.Encoding == EncodingOgg || f.Encoding == EncodingWebM
+}
+
+// Normalize 补上省略的字段, 检查格式是否支持
+func (f InputFormat) Normalize() (InputFormat, error) {
+	if f.Encoding == "" {
+		f.Encoding = RecognizerFormat.Encoding
+	}
+	if f.Channels == 0 {
+		f.Channels = RecognizerFormat.Channels
+	}
+	if f.Compressed() {
+		if f.SampleRate == 0 {
+			f.SampleRate = 48000
+		}
+		if !slices.Contains(opusSampleRates, f.SampleRate) {
+			return f, fmt.Errorf("opus 不支持的采样率: %dHz, 可选 %v", f.SampleRate, opusSampleRates)
+		}
+	} else if f.SampleRate == 0 {
+		f.SampleRate = RecognizerFormat.SampleRate
+	}
+	switch f.Encoding {
+	case EncodingS16LE, EncodingF32LE, EncodingOpus, EncodingOgg, EncodingWebM:
+	default:
+		return f, fmt.Errorf("不支持的输入编码: %s, 可选 %s、%s、%s、%s、%s",
+			f.Encoding, EncodingS16LE, EncodingF32LE, EncodingOpus, EncodingOgg, EncodingWebM)
+	}
+	if !f.Compressed() && !slices.Contains(inputSampleRates, f.SampleRate) {
+		return f, fmt.Errorf("不支持的输入采样率: %dHz, 可选 %v", f.SampleRate, inputSampleRates)
+	}
+	if f.Channels != 1 && f.Channels != 2 {
+		return f, fmt.Errorf("不支持的声道数: %d, 只支持单声道和立体声", f.Channels)
+	}
+	return f, nil
+}
+
+// frameSize 一个采样点所有声道的字节数
+func (f InputFormat) frameSize() int {
+	size := 2
+	if f.Encoding == EncodingF32LE {
+		size = 4
+	}
+	return size * f.Channels
+}
+
+// InputStream 一条连接上前端发来的音频, 转成 RecognizerFormat
+// PCM 在 Write 里直接转换; 压缩格式在后台解码, Write 返回空, 解码出来的音频从 Output 取
+type InputStream interface {
+	Format() InputFormat
+	Write(data []byte) ([]byte, error)
+	// Output 后台解码的结果, 解码结束后关闭; 同步转换时为 nil
+	Output() <-chan []byte
+	// Err Output 关闭后返回解码结束的原因
+	Err() error
+	// Close 结束这条音频流, 不等待后台解码退出
+	Close()
+}
+
+// NewInputStream format 应当已经 Normalize 过
+func NewInputStream(format InputFormat) (InputStream, error) {
+	if format.Compressed() {
+		return NewOpusDecoder(format)
+	}
+	return NewInputConverter(format), nil
+}
+
+// InputConverter 把前端按 InputFormat 发来的 PCM 流转成 RecognizerFormat
+// 一帧可能被拆在两个数据包里, 重采样的位置也接着上一个包算, 所以每条音频流用一个
+type InputConverter struct {
+	format InputFormat
+	step   float64    // 每个输出采样在输入中前进多少个采样
+	rest   []byte     // 上个包末尾不满一帧的字节
+	filter *firFilter // 降采样前的低通滤波, 不是降采样时为 nil
+
+	started bool
+	prev    float64 // 上个包的最后一个采样, 插值时作为第 0 个
+	pos     float64 // 下一个输出采样相对 prev 的位置
+}
+
+// NewInputConverter format 应当已经 Normalize 过
+func NewInputConverter(format InputFormat) *InputConverter {
+	c := &InputConverter{
+		format: format,
+		step:   float64(format.SampleRate) / float64(RecognizerFormat.SampleRate),
+	}
+	if taps := lowpassTaps(format.SampleRate, RecognizerFormat.SampleRate); taps != nil {
+		c.filter = newFIRFilter(taps)
+	}
+	return c
+}
+
+// Format 转换前的格式
+func (c *InputConverter) Format() InputFormat {
+	return c.format
+}
+
+// Write 实现 InputStream
+func (c *InputConverter) Write(data []byte) ([]byte, error) {
+	return c.Convert(data), nil
+}
+
+// Output 实现 InputStream, 同步转换没有后台输出
+func (c *InputConverter) Output() <-chan []byte {
+	return nil
+}
+
+// Err 实现 InputStream, 同步转换不会在后台出错
+func (c *InputConverter) Err() error {
+	return nil
+}
+
+// Close 实现 InputStream
+func (c *InputConverter) Close() {}
+
+// Convert 转换一个数据包, 返回 16k 单声道 16 位 PCM; 输入已经是这种格式时原样返回
+func (c *InputConverter) Convert(data []byte) []byte {
+	if c.format == RecognizerFormat {
+		return data
+	}
+	if len(c.rest) > 0 {
+		data = append(c.rest, data...)
+		c.rest = nil
+	}
+	frame := c.format.frameSize()
+	n := len(data) / frame
+	if tail := data[n*frame:]; len(tail) > 0 {
+		c.rest = append([]byte(nil), tail...)
+	}
+
+	// 先混成单声道, 取值范围和 16 位整数相同
+	mono := make([]float64, n)
+	for i := range mono {
+		var sum float64
+		for ch := 0; ch < c.format.Channels; ch++ {
+			sum += c.decode(data, i*c.format.Channels+ch)
+		}
+		mono[i] = sum / float64(c.format.Channels)
+	}
+	if c.format.SampleRate == RecognizerFormat.SampleRate {
+		return encodeS16(mono)
+	}
+	if c.filter != nil {
+		mono = c.filter.process(mono)
+	}
+	return encodeS16(c.resample(mono))
+}
+
+func (c *InputConverter) decode(data []byte, i int) float64 {
+	if c.format.Encoding == EncodingF32LE {
+		v := float64(math.Float32frombits(binary.LittleEndian.Uint32(data[i*4:])))
+		if math.IsNaN(v) {
+			return 0
+		}
+		return max(-1, min(v, 1)) * math.MaxInt16
+	}
+	return float64(int16(binary.LittleEndian.Uint16(data[i*2:])))
+}
+
+// resample 线性插值, 降采样时 Convert 已经先做过低通滤波
+// 输入看作 prev 后面接上 samples, 输出位置超出最后一个采样时留到下一个包
+func (c *InputConverter) resample(samples []float64) []float64 {
+	if len(samples) == 0 {
+		return nil
+	}
+	if !c.started {
+		c.started = true
+		c.prev = samples[0]
+		samples = samples[1:]
+	}
+	at := func(i int) float64 {
+		if i == 0 {
+			return c.prev
+		}
+		return samples[i-1]
+	}
+	var out []float64
+	for {
+		i := int(c.pos)
+		if i+1 > len(samples) {
+			break
+		}
+		frac := c.pos - float64(i)
+		out = append(out, at(i)+(at(i+1)-at(i))*frac)
+		c.pos += c.step
+	}
+	if len(samples) > 0 {
+		c.prev = samples[len(samples)-1]
+		c.pos -= float64(len(samples))
+	}
+	return out
+}
+
+func encodeS16(samples []float64) []byte {
+	out := make([]byte, len(samples)*2)
+	for i, v := range samples {
+		v = math.Round(max(math.MinInt16, min(v, math.MaxInt16)))
+		binary.LittleEndian.PutUint16(out[i*2:], uint16(int16(v)))
+	}
+	return out
+}
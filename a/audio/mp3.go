@@ -0,0 +1,80 @@
+package audio
+
+import (
+	"encoding/binary"
+	"time"
+)
+
+// 腾讯云等后端直接合成的 mp3 没有别的地方能拿到时长, 按帧头把每帧的采样数加起来
+
+// mp3 帧头里的码率表, 单位 kbps, 下标为码率编号; 0 和 15 无效
+var (
+	mp3Bitrates1 = [3][16]int{ // MPEG-1 的第 I、II、III 层
+		{0, 32, 64, 96, 128, 160, 192, 224, 256, 288, 320, 352, 384, 416, 448},
+		{0, 32, 48, 56, 64, 80, 96, 112, 128, 160, 192, 224, 256, 320, 384},
+		{0, 32, 40, 48, 56, 64, 80, 96, 112, 128, 160, 192, 224, 256, 320},
+	}
+	mp3Bitrates2 = [3][16]int{ // MPEG-2 和 2.5
+		{0, 32, 48, 56, 64, 80, 96, 112, 128, 144, 160, 176, 192, 224, 256},
+		{0, 8, 16, 24, 32, 40, 48, 56, 64, 80, 96, 112, 128, 144, 160},
+		{0, 8, 16, 24, 32, 40, 48, 56, 64, 80, 96, 112, 128, 144, 160},
+	}
+	mp3SampleRates = [3]int{44100, 48000, 32000} // MPEG-1, MPEG-2 减半, MPEG-2.5 再减半
+)
+
+// mp3Frame 解析一个帧头, 返回这一帧的字节数、采样数和采样率, 不是合法的帧头时 size 为 0
+func mp3Frame(header uint32) (size, samples, sampleRate int) {
+	if header>>21 != 0x7ff {
+		return 0, 0, 0
+	}
+	version := header >> 19 & 3 // 0: 2.5, 2: 2, 3: 1
+	layer := 4 - int(header>>17&3)
+	bitrateIndex := header >> 12 & 15
+	rateIndex := header >> 10 & 3
+	padding := int(header >> 9 & 1)
+	if version == 1 || layer == 4 || bitrateIndex == 0 || bitrateIndex == 15 || rateIndex == 3 {
+		return 0, 0, 0
+	}
+
+	sampleRate = mp3SampleRates[rateIndex]
+	bitrate := mp3Bitrates1[layer-1][bitrateIndex]
+	switch version {
+	case 2:
+		sampleRate /= 2
+		bitrate = mp3Bitrates2[layer-1][bitrateIndex]
+	case 0:
+		sampleRate /= 4
+		bitrate = mp3Bitrates2[layer-1][bitrateIndex]
+	}
+	bitrate *= 1000
+
+	switch {
+	case layer == 1:
+		return (12*bitrate/sampleRate + padding) * 4, 384, sampleRate
+	case layer == 3 && version != 3:
+		return 72*bitrate/sampleRate + padding, 576, sampleRate
+	default:
+		return 144*bitrate/sampleRate + padding, 1152, sampleRate
+	}
+}
+
+// MP3Duration 把所有帧的时长加起来, 跳过开头的 ID3v2 标签、无法识别的字节和结尾不完整的帧
+func MP3Duration(data []byte) time.Duration {
+	pos := 0
+	// ID3v2 标签: "ID3", 版本 2 字节, 标志 1 字节, 4 字节每字节 7 位的长度
+	if len(data) >= 10 && string(data[:3]) == "ID3" {
+		size := int(data[6])<<21 | int(data[7])<<14 | int(data[8])<<7 | int(data[9])
+		pos = 10 + size
+	}
+	var total time.Duration
+	for pos+4 <= len(data) {
+		size, samples, sampleRate := mp3Frame(binary.BigEndian.Uint32(data[pos:]))
+		if size == 0 || pos+size > len(data) {
+			pos++
+			continue
+		}
+		total += time.Duration(samples) * time.Second / time.Duration(sampleRate)
+		pos += size
+	}
+	return total
+}
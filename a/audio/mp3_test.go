@@ -0,0 +1,52 @@
+package audio
+
+import (
+	"encoding/binary"
+	"testing"
+	"time"
+)
+
+// mp3Frames 拼出 n 个第 III 层的帧, 只有帧头, 内容为 0
+func mp3Frames(header uint32, n int) []byte {
+	size, _, _ := mp3Frame(header)
+	var data []byte
+	for range n {
+		frame := make([]byte, size)
+		binary.BigEndian.PutUint32(frame, header)
+		data = append(data, frame...)
+	}
+	return data
+}
+
+func TestMP3Duration(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		header uint32
+		want   time.Duration // 每帧的时长
+	}{
+		{"MPEG-1 44.1k 128kbps", 0xFFFB9000, time.Second * 1152 / 44100},
+		{"MPEG-2 24k 48kbps", 0xFFF36400, time.Second * 576 / 24000},
+		{"MPEG-2 16k 32kbps", 0xFFF34800, time.Second * 576 / 16000},
+		{"MPEG-2.5 8k 16kbps", 0xFFE32800, time.Second * 576 / 8000},
+	} {
+		data := mp3Frames(tc.header, 50)
+		if got := MP3Duration(data); got != 50*tc.want {
+			t.Errorf("%s: 时长 %v, 应为 %v", tc.name, got, 50*tc.want)
+		}
+	}
+}
+
+func TestMP3DurationSkipsTag(t *testing.T) {
+	frames := mp3Frames(0xFFF36400, 10)
+	// 10 字节的 ID3v2 头加 20 字节的标签内容, 内容里故意放一个像帧头的字节
+	tag := append([]byte("ID3\x03\x00\x00\x00\x00\x00\x14"), make([]byte, 20)...)
+	tag[12] = 0xFF
+	// 结尾有半个帧
+	data := append(append(tag, frames...), frames[:100]...)
+	if got, want := MP3Duration(data), 10*time.Second*576/24000; got != want {
+		t.Errorf("时长 %v, 应为 %v", got, want)
+	}
+	if MP3Duration([]byte("not mp3")) != 0 {
+		t.Error("不是 mp3 时时长应为 0")
+	}
+}
@@ -0,0 +1,129 @@
+package audio
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+// 裸 opus 包没有封装, ffmpeg 读不了, 先按 RFC 7845 封装成 ogg 流再交给它
+// 每个包一页, 收到就能解码, 不增加延迟
+
+// oggCRCTable ogg 页校验用的 CRC-32, 多项式 0x04c11db7, 不反转, 初值为 0
+var oggCRCTable = func() [256]uint32 {
+	var table [256]uint32
+	for i := range table {
+		crc := uint32(i) << 24
+		for range 8 {
+			if crc&0x80000000 != 0 {
+				crc = crc<<1 ^ 0x04c11db7
+			} else {
+				crc <<= 1
+			}
+		}
+		table[i] = crc
+	}
+	return table
+}()
+
+const (
+	oggBOS = 0x02 // 流的第一页
+	// 一页最多 255 个分段, 每段最多 255 字节
+	oggMaxPacket = 255*255 - 1
+)
+
+// oggOpusWriter 把裸 opus 包一个一个封装成 ogg 页
+type oggOpusWriter struct {
+	serial  uint32
+	seq     uint32
+	granule int64 // 已经写入的采样数, 按 48k 计
+}
+
+// header 流开头的 OpusHead 和 OpusTags 两页
+func (w *oggOpusWriter) header(channels, sampleRate int) []byte {
+	head := []byte("OpusHead")
+	head = append(head, 1, byte(channels))
+	head = binary.LittleEndian.AppendUint16(head, 0) // pre-skip, 不知道编码器的延迟, 不跳过
+	head = binary.LittleEndian.AppendUint32(head, uint32(sampleRate))
+	head = binary.LittleEndian.AppendUint16(head, 0) // 输出增益
+	head = append(head, 0)                           // 单声道或立体声
+
+	vendor := "voice"
+	tags := []byte("OpusTags")
+	tags = binary.LittleEndian.AppendUint32(tags, uint32(len(vendor)))
+	tags = append(tags, vendor...)
+	tags = binary.LittleEndian.AppendUint32(tags, 0)
+
+	return append(w.page(oggBOS, 0, head), w.page(0, 0, tags)...)
+}
+
+// packet 封装一个 opus 包
+func (w *oggOpusWriter) packet(p []byte) ([]byte, error) {
+	if len(p) > oggMaxPacket {
+		return nil, fmt.Errorf("opus 包太大: %d 字节", len(p))
+	}
+	samples, err := opusPacketSamples(p)
+	if err != nil {
+		return nil, err
+	}
+	w.granule += int64(samples)
+	return w.page(0, w.granule, p), nil
+}
+
+func (w *oggOpusWriter) page(headerType byte, granule int64, packet []byte) []byte {
+	// 包长度按 255 分段, 最后一段小于 255, 正好是 255 的倍数时补一个 0
+	lacing := make([]byte, 0, len(packet)/255+1)
+	for n := len(packet); ; n -= 255 {
+		if n < 255 {
+			lacing = append(lacing, byte(n))
+			break
+		}
+		lacing = append(lacing, 255)
+	}
+
+	page := []byte("OggS")
+	page = append(page, 0, headerType)
+	page = binary.LittleEndian.AppendUint64(page, uint64(granule))
+	page = binary.LittleEndian.AppendUint32(page, w.serial)
+	page = binary.LittleEndian.AppendUint32(page, w.seq)
+	page = binary.LittleEndian.AppendUint32(page, 0) // 校验和, 算好后填上
+	page = append(page, byte(len(lacing)))
+	page = append(page, lacing...)
+	page = append(page, packet...)
+	w.seq++
+
+	var crc uint32
+	for _, b := range page {
+		crc = crc<<8 ^ oggCRCTable[byte(crc>>24)^b]
+	}
+	binary.LittleEndian.PutUint32(page[22:], crc)
+	return page
+}
+
+// opusPacketSamples 按 RFC 6716 3.1 节的 TOC 字节算出一个包有多少个 48k 的采样
+func opusPacketSamples(p []byte) (int, error) {
+	if len(p) == 0 {
+		return 0, errors.New("opus 包为空")
+	}
+	config := int(p[0] >> 3)
+	var frame int
+	switch {
+	case config < 12: // SILK: 10/20/40/60ms
+		frame = []int{480, 960, 1920, 2880}[config%4]
+	case config < 16: // 混合: 10/20ms
+		frame = []int{480, 960}[config%2]
+	default: // CELT: 2.5/5/10/20ms
+		frame = []int{120, 240, 480, 960}[config%4]
+	}
+	frames := 1
+	switch p[0] & 0x03 {
+	case 1, 2:
+		frames = 2
+	case 3:
+		if len(p) < 2 {
+			return 0, errors.New("opus 包不完整")
+		}
+		frames = int(p[1] & 0x3f)
+	}
+	return frame * frames, nil
+}
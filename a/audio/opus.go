@@ -0,0 +1,207 @@
+package audio
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// OpusDecoder 用一个常驻的 ffmpeg 把前端发来的 opus 流解码成 RecognizerFormat
+// 一条连接一个, 前端发来的数据按顺序写进 ffmpeg, 解码出来的音频从 Output 取
+type OpusDecoder struct {
+	format InputFormat
+	cmd    *exec.Cmd
+	ogg    *oggOpusWriter // 裸 opus 包先封装成 ogg, 其他格式为 nil
+
+	in  chan []byte
+	out chan []byte
+	// Close 后关闭, 之后解码出来的音频不再交给 Output
+	stop chan struct{}
+
+	// ffmpeg 退出后关闭, err 为退出的原因
+	done chan struct{}
+	err  error
+
+	closed bool
+}
+
+// 等待 ffmpeg 的输入缓冲, 20ms 一个包时约 2 秒; 满了说明解码跟不上, 这条音频流作废
+const opusInputBuffer = 100
+
+// 解码输出的缓冲, 满了之后 ffmpeg 等处理消息的循环取走再继续解码
+const opusOutputBuffer = 100
+
+// ErrInputOverflow 压缩音频来得比解码快, 缓冲已满; 丢掉一部分后流就接不上了, 前端要重新开始发
+var ErrInputOverflow = errors.New("音频解码跟不上, 输入缓冲已满")
+
+// 关闭输入后最多等 ffmpeg 这么久, 超时强制结束
+const opusCloseTimeout = 5 * time.Second
+
+// 每次最多读出多少解码后的音频, 100ms
+const opusReadSize = 3200
+
+// NewOpusDecoder 启动 ffmpeg, format 应当已经 Normalize 过
+func NewOpusDecoder(format InputFormat) (*OpusDecoder, error) {
+	if !FFmpegAvailable() {
+		return nil, errors.New("解码 opus 需要 ffmpeg, 没有找到")
+	}
+	demuxer := map[string]string{EncodingOpus: "ogg", EncodingOgg: "ogg", EncodingWebM: "matroska"}[format.Encoding]
+	if demuxer == "" {
+		return nil, fmt.Errorf("%s 不是 opus 格式", format.Encoding)
+	}
+	// 不探测、不缓冲, 收到一个包就解码一个包
+	args := []string{"-hide_banner", "-loglevel", "error",
+		"-fflags", "nobuffer", "-probesize", "32", "-analyzeduration", "0",
+		"-f", demuxer, "-i", "pipe:0",
+		"-f", "s16le", "-ar", strconv.Itoa(RecognizerFormat.SampleRate), "-ac", strconv.Itoa(RecognizerFormat.Channels),
+		"-flush_packets", "1", "pipe:1"}
+	cmd := exec.Command(FFmpeg, args...)
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("启动 ffmpeg 失败: %v", err)
+	}
+
+	d := &OpusDecoder{
+		format: format,
+		cmd:    cmd,
+		in:     make(chan []byte, opusInputBuffer),
+		out:    make(chan []byte, opusOutputBuffer),
+		stop:   make(chan struct{}),
+		done:   make(chan struct{}),
+	}
+	if format.Encoding == EncodingOpus {
+		d.ogg = &oggOpusWriter{serial: uint32(time.Now().UnixNano())}
+		d.in <- d.ogg.header(format.Channels, format.SampleRate)
+	}
+
+	go d.writeLoop(stdin)
+	go func() {
+		d.readLoop(stdout)
+		if err := cmd.Wait(); err != nil {
+			d.err = fmt.Errorf("ffmpeg 解码失败: %v: %s", err, strings.TrimSpace(stderr.String()))
+		} else {
+			d.err = errors.New("ffmpeg 已退出")
+		}
+		close(d.done)
+		close(d.out)
+	}()
+	return d, nil
+}
+
+// Format 实现 InputStream
+func (d *OpusDecoder) Format() InputFormat {
+	return d.format
+}
+
+// Write 实现 InputStream, 把一个二进制帧交给 ffmpeg, 解码结果稍后从 Output 取
+// 不会阻塞, ffmpeg 已经退出时返回原因, 输入缓冲满时返回 ErrInputOverflow
+func (d *OpusDecoder) Write(data []byte) ([]byte, error) {
+	if d.closed {
+		return nil, errors.New("解码已结束")
+	}
+	if d.ogg != nil {
+		page, err := d.ogg.packet(data)
+		if err != nil {
+			return nil, err
+		}
+		data = page
+	}
+	select {
+	case <-d.done:
+		return nil, d.err
+	default:
+	}
+	select {
+	case d.in <- data:
+		return nil, nil
+	default:
+		return nil, ErrInputOverflow
+	}
+}
+
+// Output 实现 InputStream, ffmpeg 退出后关闭
+func (d *OpusDecoder) Output() <-chan []byte {
+	return d.out
+}
+
+// Err 实现 InputStream, Output 关闭后返回 ffmpeg 退出的原因
+func (d *OpusDecoder) Err() error {
+	select {
+	case <-d.done:
+		return d.err
+	default:
+		return nil
+	}
+}
+
+// Close 实现 InputStream, 关闭 ffmpeg 的输入让它退出
+func (d *OpusDecoder) Close() {
+	if d.closed {
+		return
+	}
+	d.closed = true
+	close(d.in)
+	close(d.stop)
+	go func() {
+		select {
+		case <-d.done:
+		case <-time.After(opusCloseTimeout):
+			log.Printf("ffmpeg 没有按时退出, 强制结束")
+			d.cmd.Process.Kill()
+		}
+	}()
+}
+
+// writeLoop 把收到的数据按顺序写进 ffmpeg, 写失败后丢弃剩下的, 直到 Close
+func (d *OpusDecoder) writeLoop(stdin io.WriteCloser) {
+	failed := false
+	for data := range d.in {
+		if failed {
+			continue
+		}
+		if _, err := stdin.Write(data); err != nil {
+			failed = true
+		}
+	}
+	stdin.Close()
+}
+
+// readLoop 读出解码后的音频, 直到 ffmpeg 关闭输出
+// Output 满时等着, ffmpeg 的输出跟着停下, 输入积压在 d.in; Close 之后读出来的直接丢弃, 让 ffmpeg 能写完退出
+func (d *OpusDecoder) readLoop(stdout io.ReadCloser) {
+	buf := make([]byte, opusReadSize)
+	var odd []byte // 上次读到半个采样
+	for {
+		n, err := stdout.Read(buf)
+		if n > 0 {
+			pcm := append(odd, buf[:n]...)
+			odd = nil
+			if len(pcm)%2 == 1 {
+				odd = []byte{pcm[len(pcm)-1]}
+				pcm = pcm[:len(pcm)-1]
+			}
+			select {
+			case d.out <- pcm:
+			case <-d.stop:
+			}
+		}
+		if err != nil {
+			return
+		}
+	}
+}
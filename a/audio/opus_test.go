@@ -0,0 +1,117 @@
+package audio
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fakeFFmpeg 用 shell 脚本代替 ffmpeg, 不依赖本机装没装
+func fakeFFmpeg(t *testing.T, script string) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "ffmpeg")
+	if err := os.WriteFile(path, []byte("#!/bin/sh\n"+script+"\n"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	old := FFmpeg
+	FFmpeg = path
+	t.Cleanup(func() { FFmpeg = old })
+}
+
+// drain 读完 Output 直到关闭, 返回读到的字节数
+func drain(t *testing.T, d *OpusDecoder) int {
+	t.Helper()
+	total := 0
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case pcm, ok := <-d.Output():
+			if !ok {
+				return total
+			}
+			total += len(pcm)
+		case <-timeout:
+			t.Fatal("ffmpeg 退出后 Output 应关闭")
+		}
+	}
+}
+
+func TestOpusDecoderExit(t *testing.T) {
+	fakeFFmpeg(t, `echo "Invalid data found" >&2; exit 1`)
+	d, err := NewOpusDecoder(InputFormat{Encoding: EncodingOgg, SampleRate: 48000, Channels: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer d.Close()
+
+	drain(t, d)
+	if err := d.Err(); err == nil || !strings.Contains(err.Error(), "Invalid data found") {
+		t.Errorf("应返回 ffmpeg 的错误输出, 得到 %v", err)
+	}
+	if _, err := d.Write([]byte("OggS")); err == nil {
+		t.Error("ffmpeg 退出后 Write 应返回错误")
+	}
+}
+
+func TestOpusDecoderBackpressure(t *testing.T) {
+	// 原样输出, 解码出来的字节数应和写进去的一样
+	fakeFFmpeg(t, `exec cat`)
+	d, err := NewOpusDecoder(InputFormat{Encoding: EncodingOgg, SampleRate: 48000, Channels: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 不取 Output, 一直写到缓冲满
+	packet := make([]byte, opusReadSize)
+	written := 0
+	var overflow error
+	for range 1000 {
+		if _, err := d.Write(packet); err != nil {
+			overflow = err
+			break
+		}
+		written += len(packet)
+	}
+	if !errors.Is(overflow, ErrInputOverflow) {
+		t.Fatalf("缓冲满时应返回 ErrInputOverflow, 得到 %v", overflow)
+	}
+
+	// 写进去的音频一个字节都不丢
+	defer d.Close()
+	got := 0
+	timeout := time.After(5 * time.Second)
+	for got < written {
+		select {
+		case pcm := <-d.Output():
+			got += len(pcm)
+		case <-timeout:
+			t.Fatalf("写入 %d 字节, 解码输出 %d 字节", written, got)
+		}
+	}
+	if got != written {
+		t.Errorf("写入 %d 字节, 解码输出 %d 字节", written, got)
+	}
+}
+
+func TestOpusDecoderCloseUnread(t *testing.T) {
+	fakeFFmpeg(t, `exec cat`)
+	d, err := NewOpusDecoder(InputFormat{Encoding: EncodingOgg, SampleRate: 48000, Channels: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for range 300 {
+		if _, err := d.Write(make([]byte, opusReadSize)); err != nil {
+			break
+		}
+	}
+	// 没人取 Output 时 Close 也能让 ffmpeg 退出
+	d.Close()
+	select {
+	case <-d.done:
+	case <-time.After(opusCloseTimeout / 2):
+		t.Fatal("Close 之后 ffmpeg 应能写完退出")
+	}
+}
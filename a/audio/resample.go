@@ -0,0 +1,42 @@
+package audio
+
+import (
+	"encoding/binary"
+	"math"
+)
+
+// Resample 把 16bit 单声道 PCM 从 from Hz 线性插值到 to Hz
+// 降采样时先低通滤波去掉新采样率表示不了的高频, 见 lowpassTaps
+func Resample(pcm []byte, from, to int) []byte {
+	if from == to || from <= 0 || to <= 0 || len(pcm) < 4 {
+		return pcm
+	}
+	in := len(pcm) / 2
+	samples := make([]float64, in)
+	for i := range samples {
+		samples[i] = float64(sample(pcm, i))
+	}
+	if taps := lowpassTaps(from, to); taps != nil {
+		samples = lowpass(samples, taps)
+	}
+	out := int(int64(in) * int64(to) / int64(from))
+	result := make([]byte, out*2)
+	for i := 0; i < out; i++ {
+		// 输出第 i 个采样在输入中的位置
+		pos := float64(i) * float64(from) / float64(to)
+		j := int(pos)
+		frac := pos - float64(j)
+		a := samples[j]
+		b := a
+		if j+1 < in {
+			b = samples[j+1]
+		}
+		v := math.Round(max(math.MinInt16, min(a+(b-a)*frac, math.MaxInt16)))
+		binary.LittleEndian.PutUint16(result[i*2:], uint16(int16(v)))
+	}
+	return result
+}
+
+func sample(pcm []byte, i int) int16 {
+	return int16(binary.LittleEndian.Uint16(pcm[i*2:]))
+}
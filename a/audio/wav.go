@@ -0,0 +1,164 @@
+package audio
+
+import (
+	"encoding/binary"
+	"fmt"
+	"os"
+)
+
+const wavHeaderSize = 44
+
+// EncodeWAV 给 PCM 数据加上 WAV 文件头
+func EncodeWAV(pcm []byte, sampleRate, channels, bitsPerSample int) []byte {
+	out := make([]byte, wavHeaderSize+len(pcm))
+	putWAVHeader(out, len(pcm), sampleRate, channels, bitsPerSample)
+	copy(out[wavHeaderSize:], pcm)
+	return out
+}
+
+// putWAVHeader 写入 44 字节的 PCM WAV 文件头
+func putWAVHeader(header []byte, dataSize, sampleRate, channels, bitsPerSample int) {
+	blockAlign := channels * bitsPerSample / 8
+
+	// RIFF header
+	copy(header[0:], "RIFF")
+	binary.LittleEndian.PutUint32(header[4:], uint32(dataSize+36))
+	copy(header[8:], "WAVE")
+
+	// fmt subchunk
+	copy(header[12:], "fmt ")
+	binary.LittleEndian.PutUint32(header[16:], 16) // subchunk1Size
+	binary.LittleEndian.PutUint16(header[20:], 1)  // audioFormat = PCM
+	binary.LittleEndian.PutUint16(header[22:], uint16(channels))
+	binary.LittleEndian.PutUint32(header[24:], uint32(sampleRate))
+	binary.LittleEndian.PutUint32(header[28:], uint32(sampleRate*blockAlign)) // byteRate
+	binary.LittleEndian.PutUint16(header[32:], uint16(blockAlign))
+	binary.LittleEndian.PutUint16(header[34:], uint16(bitsPerSample))
+
+	// data subchunk
+	copy(header[36:], "data")
+	binary.LittleEndian.PutUint32(header[40:], uint32(dataSize))
+}
+
+// WAV 一段解析后的 PCM WAV
+type WAV struct {
+	SampleRate    int
+	Channels      int
+	BitsPerSample int
+	PCM           []byte
+}
+
+// DecodeWAV 解析 PCM WAV, 跳过 fmt 和 data 之外的块, 不要求文件头正好 44 字节
+func DecodeWAV(data []byte) (*WAV, error) {
+	if len(data) < 12 || string(data[0:4]) != "RIFF" || string(data[8:12]) != "WAVE" {
+		return nil, fmt.Errorf("不是 WAV 文件")
+	}
+	var w WAV
+	haveFormat := false
+	for pos := 12; pos+8 <= len(data); {
+		id := string(data[pos : pos+4])
+		size := int(binary.LittleEndian.Uint32(data[pos+4:]))
+		body := data[pos+8:]
+		switch id {
+		case "fmt ":
+			if size < 16 || len(body) < 16 {
+				return nil, fmt.Errorf("WAV 的 fmt 块不完整")
+			}
+			if format := binary.LittleEndian.Uint16(body[0:]); format != 1 {
+				return nil, fmt.Errorf("不支持的 WAV 编码: %d", format)
+			}
+			w.Channels = int(binary.LittleEndian.Uint16(body[2:]))
+			w.SampleRate = int(binary.LittleEndian.Uint32(body[4:]))
+			w.BitsPerSample = int(binary.LittleEndian.Uint16(body[14:]))
+			haveFormat = true
+		case "data":
+			if !haveFormat {
+				return nil, fmt.Errorf("WAV 的 data 块在 fmt 块之前")
+			}
+			// 流式写出的 WAV 长度可能是占位的大数, 以实际数据为准
+			if size > len(body) {
+				size = len(body)
+			}
+			w.PCM = body[:size]
+			return &w, nil
+		}
+		// 块按偶数字节对齐
+		pos += 8 + size + size%2
+	}
+	return nil, fmt.Errorf("WAV 中没有 data 块")
+}
+
+// ConcatWAV 把参数相同的几段 WAV 拼成一个
+func ConcatWAV(parts ...[]byte) ([]byte, error) {
+	if len(parts) == 0 {
+		return nil, fmt.Errorf("没有要拼接的 WAV")
+	}
+	var first *WAV
+	var pcm []byte
+	for i, part := range parts {
+		w, err := DecodeWAV(part)
+		if err != nil {
+			return nil, fmt.Errorf("第 %d 段: %v", i+1, err)
+		}
+		if first == nil {
+			first = w
+		} else if w.SampleRate != first.SampleRate || w.Channels != first.Channels || w.BitsPerSample != first.BitsPerSample {
+			return nil, fmt.Errorf("第 %d 段的格式 %dHz/%d声道/%dbit 和第 1 段不同", i+1, w.SampleRate, w.Channels, w.BitsPerSample)
+		}
+		pcm = append(pcm, w.PCM...)
+	}
+	return EncodeWAV(pcm, first.SampleRate, first.Channels, first.BitsPerSample), nil
+}
+
+// WAVWriter 边收边写的 WAV 文件, 文件头里的长度在 Close 时补上
+type WAVWriter struct {
+	file          *os.File
+	size          int
+	sampleRate    int
+	channels      int
+	bitsPerSample int
+}
+
+// CreateWAV 创建 WAV 文件并先写入长度为 0 的文件头
+func CreateWAV(path string, sampleRate, channels, bitsPerSample int) (*WAVWriter, error) {
+	file, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	w := &WAVWriter{file: file, sampleRate: sampleRate, channels: channels, bitsPerSample: bitsPerSample}
+	header := make([]byte, wavHeaderSize)
+	putWAVHeader(header, 0, sampleRate, channels, bitsPerSample)
+	if _, err := file.Write(header); err != nil {
+		file.Close()
+		return nil, err
+	}
+	return w, nil
+}
+
+// SampleRate 创建时指定的采样率
+func (w *WAVWriter) SampleRate() int {
+	return w.sampleRate
+}
+
+// Size 已写入的 PCM 字节数
+func (w *WAVWriter) Size() int {
+	return w.size
+}
+
+// Write 追加 PCM 数据
+func (w *WAVWriter) Write(pcm []byte) (int, error) {
+	n, err := w.file.Write(pcm)
+	w.size += n
+	return n, err
+}
+
+// Close 按实际写入的长度改写文件头后关闭
+func (w *WAVWriter) Close() error {
+	header := make([]byte, wavHeaderSize)
+	putWAVHeader(header, w.size, w.sampleRate, w.channels, w.bitsPerSample)
+	_, err := w.file.WriteAt(header, 0)
+	if closeErr := w.file.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
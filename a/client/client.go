@@ -1,11 +0,0 @@
-package client
-
-const (
-	SecretId      string = "your-tencentcloud-secret-id"
-	SecretKey     string = "your-tencentcloud-secret-key"
-	AppId         string = "your-tencentcloud-app-id"
-	DoubaoAPIKey  string = "your-doubao-api-key"
-	Model         string = "your-doubao-model"
-	BaseURL       string = "https://ark.cn-beijing.volces.com/api/v3" //一个例子
-	WeatherAPIKey string = "your-openweathermap-api-key"
-)
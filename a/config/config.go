@@ -0,0 +1,177 @@
+package config
+
+import (
+	"time"
+)
+
+// Secret 密钥类字段, 打印时自动打码, 避免出现在日志里
+// 只能看出有没有填写, 不透露任何字符
+type Secret string
+
+func (s Secret) String() string {
+	if s == "" {
+		return ""
+	}
+	return "******"
+}
+
+func (s Secret) GoString() string {
+	return `"` + s.String() + `"`
+}
+
+type Config struct {
+	Server    ServerConfig    `yaml:"server" toml:"server"`
+	Tencent   TencentConfig   `yaml:"tencent" toml:"tencent"`
+	ASR       ASRConfig       `yaml:"asr" toml:"asr"`
+	TTS       TTSConfig       `yaml:"tts" toml:"tts"`
+	LLM       LLMConfig       `yaml:"llm" toml:"llm"`
+	Weather   WeatherConfig   `yaml:"weather" toml:"weather"`
+	Persona   PersonaConfig   `yaml:"persona" toml:"persona"`
+	History   HistoryConfig   `yaml:"history" toml:"history"`
+	Recording RecordingConfig `yaml:"recording" toml:"recording"`
+	Session   SessionConfig   `yaml:"session" toml:"session"`
+}
+
+type ServerConfig struct {
+	Addr      string `yaml:"addr" toml:"addr"`             // 监听地址
+	StaticDir string `yaml:"static_dir" toml:"static_dir"` // 前端静态文件目录
+}
+
+// TencentConfig 腾讯云凭证, 语音识别和语音合成共用
+type TencentConfig struct {
+	AppId     string `yaml:"app_id" toml:"app_id"`
+	SecretId  Secret `yaml:"secret_id" toml:"secret_id"`
+	SecretKey Secret `yaml:"secret_key" toml:"secret_key"`
+}
+
+type ASRConfig struct {
+	Provider string `yaml:"provider" toml:"provider"` // tencent, fake
+}
+
+type TTSConfig struct {
+	Provider string `yaml:"provider" toml:"provider"` // tencent, offline
+	FFmpeg   string `yaml:"ffmpeg" toml:"ffmpeg"`     // 用于转码 mp3/opus 和解码 opus 麦克风音频的 ffmpeg, 为空时不支持
+}
+
+type LLMConfig struct {
+	Default       string           `yaml:"default" toml:"default"`                 // 默认后端名称
+	MaxToolRounds int              `yaml:"max_tool_rounds" toml:"max_tool_rounds"` // 一次提问最多连续调用几轮工具
+	EmotionTags   bool             `yaml:"emotion_tags" toml:"emotion_tags"`       // 让大模型用 [happy] 这样的标签标出语气, 用于多情感音色
+	Context       ContextConfig    `yaml:"context" toml:"context"`
+	Providers     []ProviderConfig `yaml:"providers" toml:"providers"`
+}
+
+// ContextConfig 上下文的 token 预算, 超过后把较早的对话总结成摘要
+type ContextConfig struct {
+	MaxTokens        int `yaml:"max_tokens" toml:"max_tokens"`                 // 0 表示不限制
+	KeepRecentTokens int `yaml:"keep_recent_tokens" toml:"keep_recent_tokens"` // 至少原样保留的最近对话
+}
+
+// ProviderConfig 一个大模型后端
+type ProviderConfig struct {
+	Name    string `yaml:"name" toml:"name"`
+	Type    string `yaml:"type" toml:"type"` // openai(任何兼容 OpenAI 接口的服务), fake
+	BaseURL string `yaml:"base_url" toml:"base_url"`
+	APIKey  Secret `yaml:"api_key" toml:"api_key"`
+	Model   string `yaml:"model" toml:"model"`
+}
+
+type WeatherConfig struct {
+	Provider     string        `yaml:"provider" toml:"provider"`           // openweathermap, fake(本地假服务, 不需要 api_key)
+	APIKey       Secret        `yaml:"api_key" toml:"api_key"`             // OpenWeatherMap
+	BaseURL      string        `yaml:"base_url" toml:"base_url"`           // 使用 fake 时忽略
+	Timeout      time.Duration `yaml:"timeout" toml:"timeout"`             // 单次请求超时
+	Retries      int           `yaml:"retries" toml:"retries"`             // 网络错误、限流或服务端错误时最多重试几次
+	RetryBackoff time.Duration `yaml:"retry_backoff" toml:"retry_backoff"` // 第一次重试前等待的时间, 之后每次翻倍
+	CacheTTL     time.Duration `yaml:"cache_ttl" toml:"cache_ttl"`         // 同一地点的结果缓存多久, 0 表示不缓存
+}
+
+// PersonaConfig 角色库
+type PersonaConfig struct {
+	Dir     string `yaml:"dir" toml:"dir"`         // 角色文件目录, 每个角色一个 json 文件
+	Default string `yaml:"default" toml:"default"` // init 没有指定角色时使用
+}
+
+// HistoryConfig 对话历史记录
+type HistoryConfig struct {
+	Dir string `yaml:"dir" toml:"dir"` // 每个会话一个只追加的 jsonl 文件, 为空时不保存
+}
+
+// RecordingConfig 会话录音, 麦克风和合成的语音按会话、按轮保存为音频文件
+type RecordingConfig struct {
+	Enabled bool   `yaml:"enabled" toml:"enabled"` // 默认关闭
+	Dir     string `yaml:"dir" toml:"dir"`         // 每个会话一个子目录
+}
+
+type SessionConfig struct {
+	SilenceTimeout time.Duration `yaml:"silence_timeout" toml:"silence_timeout"` // 静音多久后自动提问, VAD 漏判时兜底
+	ResumeGrace    time.Duration `yaml:"resume_grace" toml:"resume_grace"`       // 断线后会话保留多久等待重连, 0 表示断线即结束
+	VAD            VADConfig     `yaml:"vad" toml:"vad"`
+}
+
+// VADConfig 服务端语音活动检测, 用户说完后很快结束本轮
+type VADConfig struct {
+	Enabled   bool          `yaml:"enabled" toml:"enabled"`
+	Hangover  time.Duration `yaml:"hangover" toml:"hangover"`     // 静音持续多久算说完
+	MinSpeech time.Duration `yaml:"min_speech" toml:"min_speech"` // 连续说话多久才算开口
+	MinEnergy float64       `yaml:"min_energy" toml:"min_energy"` // 能量阈值下限, 0~1
+}
+
+// Default 没有配置文件时的默认值
+func Default() *Config {
+	return &Config{
+		Server: ServerConfig{
+			Addr:      ":8080",
+			StaticDir: "../../static",
+		},
+		ASR: ASRConfig{Provider: "tencent"},
+		TTS: TTSConfig{Provider: "tencent", FFmpeg: "ffmpeg"},
+		Weather: WeatherConfig{
+			Provider:     "openweathermap",
+			BaseURL:      "https://api.openweathermap.org",
+			Timeout:      5 * time.Second,
+			Retries:      2,
+			RetryBackoff: 300 * time.Millisecond,
+			CacheTTL:     10 * time.Minute,
+		},
+		LLM: LLMConfig{
+			Default:       "doubao",
+			MaxToolRounds: 5,
+			EmotionTags:   true,
+			Context:       ContextConfig{MaxTokens: 8000, KeepRecentTokens: 2000},
+			Providers: []ProviderConfig{
+				{Name: "doubao", Type: "openai", BaseURL: "https://ark.cn-beijing.volces.com/api/v3"},
+				{Name: "ollama", Type: "openai", BaseURL: "http://localhost:11434/v1", Model: "qwen2.5:7b"},
+				{Name: "llamacpp", Type: "openai", BaseURL: "http://localhost:8081/v1", Model: "qwen2.5:7b"},
+				{Name: "vllm", Type: "openai", BaseURL: "http://localhost:8000/v1", Model: "qwen2.5:7b"},
+				{Name: "fake", Type: "fake"},
+			},
+		},
+		Persona: PersonaConfig{
+			Dir:     "personas",
+			Default: "neko",
+		},
+		History:   HistoryConfig{Dir: "data/history"},
+		Recording: RecordingConfig{Dir: "data/recordings"},
+		Session: SessionConfig{
+			SilenceTimeout: 5 * time.Second,
+			ResumeGrace:    60 * time.Second,
+			VAD: VADConfig{
+				Enabled:   true,
+				Hangover:  400 * time.Millisecond,
+				MinSpeech: 200 * time.Millisecond,
+				MinEnergy: 0.01,
+			},
+		},
+	}
+}
+
+// Provider 按名称查找大模型后端配置
+func (c *Config) Provider(name string) *ProviderConfig {
+	for i := range c.LLM.Providers {
+		if c.LLM.Providers[i].Name == name {
+			return &c.LLM.Providers[i]
+		}
+	}
+	return nil
+}
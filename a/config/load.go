@@ -0,0 +1,301 @@
+package config
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+// 环境变量前缀, 例如 VOICE_SERVER_ADDR
+const envPrefix = "VOICE_"
+
+// FromArgs 按 默认值 < 配置文件 < 环境变量 < 命令行参数 的优先级加载配置并校验
+func FromArgs(args []string) (*Config, error) {
+	fs := flag.NewFlagSet("voice-assistant", flag.ContinueOnError)
+	path := fs.String("config", os.Getenv(envPrefix+"CONFIG"), "配置文件路径, 支持 .yaml/.yml/.toml")
+	addr := fs.String("addr", "", "监听地址, 例如 :8080")
+	staticDir := fs.String("static", "", "前端静态文件目录")
+	asrProvider := fs.String("asr", "", "语音识别后端: tencent, fake")
+	ttsProvider := fs.String("tts", "", "语音合成后端: tencent, offline")
+	llmProvider := fs.String("llm", "", "默认大模型后端名称")
+	weatherProvider := fs.String("weather", "", "天气服务: openweathermap, fake")
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+
+	cfg, err := Load(*path)
+	if err != nil {
+		return nil, err
+	}
+
+	setIfNotEmpty(&cfg.Server.Addr, *addr)
+	setIfNotEmpty(&cfg.Server.StaticDir, *staticDir)
+	setIfNotEmpty(&cfg.ASR.Provider, *asrProvider)
+	setIfNotEmpty(&cfg.TTS.Provider, *ttsProvider)
+	setIfNotEmpty(&cfg.LLM.Default, *llmProvider)
+	setIfNotEmpty(&cfg.Weather.Provider, *weatherProvider)
+
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+// Load 读取配置文件并应用环境变量, path 为空时只使用默认值和环境变量
+func Load(path string) (*Config, error) {
+	cfg := Default()
+	if path != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("读取配置文件失败: %v", err)
+		}
+		if err := decode(path, data, cfg); err != nil {
+			return nil, fmt.Errorf("解析配置文件 %s 失败: %v", path, err)
+		}
+	}
+	if err := cfg.applyEnv(); err != nil {
+		return nil, err
+	}
+	return cfg, nil
+}
+
+func decode(path string, data []byte, cfg *Config) error {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		dec := yaml.NewDecoder(bytes.NewReader(data))
+		dec.KnownFields(true)
+		return dec.Decode(cfg)
+	case ".toml":
+		meta, err := toml.Decode(string(data), cfg)
+		if err != nil {
+			return err
+		}
+		if undecoded := meta.Undecoded(); len(undecoded) > 0 {
+			return fmt.Errorf("未知的配置项: %v", undecoded)
+		}
+		return nil
+	default:
+		return fmt.Errorf("不支持的配置文件格式: %s", filepath.Ext(path))
+	}
+}
+
+// applyEnv 环境变量覆盖配置文件
+// 大模型后端按名称覆盖, 例如 VOICE_LLM_DOUBAO_API_KEY
+func (c *Config) applyEnv() error {
+	strs := map[string]*string{
+		"SERVER_ADDR":       &c.Server.Addr,
+		"SERVER_STATIC_DIR": &c.Server.StaticDir,
+		"TENCENT_APP_ID":    &c.Tencent.AppId,
+		"ASR_PROVIDER":      &c.ASR.Provider,
+		"TTS_PROVIDER":      &c.TTS.Provider,
+		"TTS_FFMPEG":        &c.TTS.FFmpeg,
+		"WEATHER_PROVIDER":  &c.Weather.Provider,
+		"WEATHER_BASE_URL":  &c.Weather.BaseURL,
+		"LLM_DEFAULT":       &c.LLM.Default,
+		"PERSONA_DIR":       &c.Persona.Dir,
+		"PERSONA_DEFAULT":   &c.Persona.Default,
+		"HISTORY_DIR":       &c.History.Dir,
+		"RECORDING_DIR":     &c.Recording.Dir,
+	}
+	secrets := map[string]*Secret{
+		"TENCENT_SECRET_ID":  &c.Tencent.SecretId,
+		"TENCENT_SECRET_KEY": &c.Tencent.SecretKey,
+		"WEATHER_API_KEY":    &c.Weather.APIKey,
+	}
+	for i := range c.LLM.Providers {
+		p := &c.LLM.Providers[i]
+		name := "LLM_" + strings.ToUpper(p.Name) + "_"
+		strs[name+"BASE_URL"] = &p.BaseURL
+		strs[name+"MODEL"] = &p.Model
+		secrets[name+"API_KEY"] = &p.APIKey
+	}
+
+	for key, field := range strs {
+		if v, ok := os.LookupEnv(envPrefix + key); ok {
+			*field = v
+		}
+	}
+	for key, field := range secrets {
+		if v, ok := os.LookupEnv(envPrefix + key); ok {
+			*field = Secret(v)
+		}
+	}
+
+	durations := map[string]*time.Duration{
+		"SESSION_SILENCE_TIMEOUT": &c.Session.SilenceTimeout,
+		"SESSION_RESUME_GRACE":    &c.Session.ResumeGrace,
+		"WEATHER_TIMEOUT":         &c.Weather.Timeout,
+		"WEATHER_RETRY_BACKOFF":   &c.Weather.RetryBackoff,
+		"WEATHER_CACHE_TTL":       &c.Weather.CacheTTL,
+		"SESSION_VAD_HANGOVER":    &c.Session.VAD.Hangover,
+		"SESSION_VAD_MIN_SPEECH":  &c.Session.VAD.MinSpeech,
+	}
+	for key, field := range durations {
+		if v, ok := os.LookupEnv(envPrefix + key); ok {
+			d, err := time.ParseDuration(v)
+			if err != nil {
+				return fmt.Errorf("环境变量 %s%s 无效: %v", envPrefix, key, err)
+			}
+			*field = d
+		}
+	}
+	ints := map[string]*int{
+		"LLM_MAX_TOOL_ROUNDS":            &c.LLM.MaxToolRounds,
+		"WEATHER_RETRIES":                &c.Weather.Retries,
+		"LLM_CONTEXT_MAX_TOKENS":         &c.LLM.Context.MaxTokens,
+		"LLM_CONTEXT_KEEP_RECENT_TOKENS": &c.LLM.Context.KeepRecentTokens,
+	}
+	for key, field := range ints {
+		if v, ok := os.LookupEnv(envPrefix + key); ok {
+			n, err := strconv.Atoi(v)
+			if err != nil {
+				return fmt.Errorf("环境变量 %s%s 无效: %v", envPrefix, key, err)
+			}
+			*field = n
+		}
+	}
+	bools := map[string]*bool{
+		"SESSION_VAD_ENABLED": &c.Session.VAD.Enabled,
+		"LLM_EMOTION_TAGS":    &c.LLM.EmotionTags,
+		"RECORDING_ENABLED":   &c.Recording.Enabled,
+	}
+	for key, field := range bools {
+		if v, ok := os.LookupEnv(envPrefix + key); ok {
+			b, err := strconv.ParseBool(v)
+			if err != nil {
+				return fmt.Errorf("环境变量 %s%s 无效: %v", envPrefix, key, err)
+			}
+			*field = b
+		}
+	}
+	floats := map[string]*float64{
+		"SESSION_VAD_MIN_ENERGY": &c.Session.VAD.MinEnergy,
+	}
+	for key, field := range floats {
+		if v, ok := os.LookupEnv(envPrefix + key); ok {
+			f, err := strconv.ParseFloat(v, 64)
+			if err != nil {
+				return fmt.Errorf("环境变量 %s%s 无效: %v", envPrefix, key, err)
+			}
+			*field = f
+		}
+	}
+	return nil
+}
+
+// Validate 检查配置是否完整, 一次返回所有问题
+func (c *Config) Validate() error {
+	var errs []error
+	if c.Server.Addr == "" {
+		errs = append(errs, errors.New("server.addr 不能为空"))
+	}
+
+	needTencent := false
+	switch c.ASR.Provider {
+	case "tencent":
+		needTencent = true
+	case "fake":
+	default:
+		errs = append(errs, fmt.Errorf("asr.provider 无效: %q", c.ASR.Provider))
+	}
+	switch c.TTS.Provider {
+	case "tencent":
+		needTencent = true
+	case "offline":
+	default:
+		errs = append(errs, fmt.Errorf("tts.provider 无效: %q", c.TTS.Provider))
+	}
+	switch c.Weather.Provider {
+	case "openweathermap":
+		if c.Weather.BaseURL == "" {
+			errs = append(errs, errors.New("weather.base_url 不能为空"))
+		}
+	case "fake":
+	default:
+		errs = append(errs, fmt.Errorf("weather.provider 无效: %q", c.Weather.Provider))
+	}
+	if c.Weather.Timeout <= 0 {
+		errs = append(errs, errors.New("weather.timeout 必须大于0"))
+	}
+	if c.Weather.Retries < 0 || c.Weather.RetryBackoff < 0 || c.Weather.CacheTTL < 0 {
+		errs = append(errs, errors.New("weather.retries, retry_backoff, cache_ttl 不能小于0"))
+	}
+	if needTencent && (c.Tencent.AppId == "" || c.Tencent.SecretId == "" || c.Tencent.SecretKey == "") {
+		errs = append(errs, errors.New("使用腾讯云语音服务时 tencent.app_id, secret_id, secret_key 不能为空"))
+	}
+
+	names := make(map[string]bool)
+	for _, p := range c.LLM.Providers {
+		if p.Name == "" {
+			errs = append(errs, errors.New("llm.providers 中存在没有名称的后端"))
+			continue
+		}
+		if names[p.Name] {
+			errs = append(errs, fmt.Errorf("llm.providers 名称重复: %s", p.Name))
+		}
+		names[p.Name] = true
+		switch p.Type {
+		case "openai":
+			if p.BaseURL == "" {
+				errs = append(errs, fmt.Errorf("大模型后端 %s 缺少 base_url", p.Name))
+			}
+		case "fake":
+		default:
+			errs = append(errs, fmt.Errorf("大模型后端 %s 类型无效: %q", p.Name, p.Type))
+		}
+	}
+	if def := c.Provider(c.LLM.Default); def == nil {
+		errs = append(errs, fmt.Errorf("llm.default 指向不存在的后端: %q", c.LLM.Default))
+	} else if def.Type == "openai" && def.Model == "" {
+		errs = append(errs, fmt.Errorf("默认大模型后端 %s 缺少 model", def.Name))
+	}
+	if c.LLM.MaxToolRounds < 1 {
+		errs = append(errs, errors.New("llm.max_tool_rounds 必须大于0"))
+	}
+	if budget := c.LLM.Context; budget.MaxTokens < 0 {
+		errs = append(errs, errors.New("llm.context.max_tokens 不能小于0"))
+	} else if budget.MaxTokens > 0 && (budget.KeepRecentTokens <= 0 || budget.KeepRecentTokens >= budget.MaxTokens) {
+		errs = append(errs, errors.New("llm.context.keep_recent_tokens 必须大于0且小于 max_tokens"))
+	}
+
+	if c.Persona.Dir == "" {
+		errs = append(errs, errors.New("persona.dir 不能为空"))
+	}
+	if c.Recording.Enabled && c.Recording.Dir == "" {
+		errs = append(errs, errors.New("开启录音时 recording.dir 不能为空"))
+	}
+
+	if c.Session.SilenceTimeout <= 0 {
+		errs = append(errs, errors.New("session.silence_timeout 必须大于0"))
+	}
+	if c.Session.ResumeGrace < 0 {
+		errs = append(errs, errors.New("session.resume_grace 不能小于0"))
+	}
+	if vad := c.Session.VAD; vad.Enabled {
+		if vad.Hangover <= 0 {
+			errs = append(errs, errors.New("session.vad.hangover 必须大于0"))
+		}
+		if vad.MinSpeech < 0 {
+			errs = append(errs, errors.New("session.vad.min_speech 不能小于0"))
+		}
+		if vad.MinEnergy <= 0 || vad.MinEnergy >= 1 {
+			errs = append(errs, errors.New("session.vad.min_energy 必须在 0~1 之间"))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func setIfNotEmpty(field *string, value string) {
+	if value != "" {
+		*field = value
+	}
+}
@@ -0,0 +1,187 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+// writeConfig 在临时目录写一个配置文件, 返回路径
+func writeConfig(t *testing.T, name, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// 不需要任何凭证的配置
+const offlineYAML = `
+server:
+  addr: ":9000"
+asr:
+  provider: fake
+tts:
+  provider: offline
+weather:
+  provider: fake
+llm:
+  default: fake
+session:
+  silence_timeout: 3s
+`
+
+func TestPrecedence(t *testing.T) {
+	path := writeConfig(t, "config.yaml", offlineYAML)
+
+	cfg, err := FromArgs([]string{"-config", path})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Server.Addr != ":9000" || cfg.ASR.Provider != "fake" || cfg.Session.SilenceTimeout != 3*time.Second {
+		t.Errorf("应使用配置文件的值: %+v %+v %+v", cfg.Server, cfg.ASR, cfg.Session)
+	}
+	if cfg.Server.StaticDir != Default().Server.StaticDir {
+		t.Errorf("配置文件没写的项应使用默认值, 得到 %q", cfg.Server.StaticDir)
+	}
+
+	t.Setenv("VOICE_SERVER_ADDR", ":9100")
+	t.Setenv("VOICE_SESSION_SILENCE_TIMEOUT", "4s")
+	t.Setenv("VOICE_LLM_DOUBAO_API_KEY", "from-env")
+	cfg, err = FromArgs([]string{"-config", path})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Server.Addr != ":9100" || cfg.Session.SilenceTimeout != 4*time.Second {
+		t.Errorf("环境变量应覆盖配置文件: %q %v", cfg.Server.Addr, cfg.Session.SilenceTimeout)
+	}
+	if cfg.Provider("doubao").APIKey != "from-env" {
+		t.Error("大模型后端应能按名称用环境变量覆盖")
+	}
+
+	cfg, err = FromArgs([]string{"-config", path, "-addr", ":9200", "-llm", "ollama"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Server.Addr != ":9200" || cfg.LLM.Default != "ollama" {
+		t.Errorf("命令行参数应覆盖环境变量: %q %q", cfg.Server.Addr, cfg.LLM.Default)
+	}
+	if cfg.Session.SilenceTimeout != 4*time.Second {
+		t.Errorf("没有对应参数的项仍使用环境变量, 得到 %v", cfg.Session.SilenceTimeout)
+	}
+
+	// 配置文件路径也可以来自环境变量
+	t.Setenv("VOICE_CONFIG", path)
+	if cfg, err = FromArgs(nil); err != nil || cfg.ASR.Provider != "fake" {
+		t.Errorf("应读取 VOICE_CONFIG 指定的配置文件: %v", err)
+	}
+}
+
+func TestLoadTOML(t *testing.T) {
+	path := writeConfig(t, "config.toml", `
+[server]
+addr = ":9000"
+
+[llm]
+default = "fake"
+max_tool_rounds = 3
+`)
+	cfg, err := Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Server.Addr != ":9000" || cfg.LLM.Default != "fake" || cfg.LLM.MaxToolRounds != 3 {
+		t.Errorf("toml 的值没有生效: %+v", cfg.LLM)
+	}
+}
+
+func TestLoadStrict(t *testing.T) {
+	for _, tc := range []struct {
+		name, content, want string
+	}{
+		{"config.yaml", "server:\n  adress: \":9000\"\n", "adress"},
+		{"config.yaml", "speech:\n  provider: fake\n", "speech"},
+		{"config.toml", "[server]\nadress = \":9000\"\n", "未知的配置项"},
+		{"config.json", "{}", "不支持的配置文件格式"},
+	} {
+		_, err := Load(writeConfig(t, tc.name, tc.content))
+		if err == nil || !strings.Contains(err.Error(), tc.want) {
+			t.Errorf("%s %q: 应报错 %q, 得到 %v", tc.name, tc.content, tc.want, err)
+		}
+	}
+
+	if _, err := Load(filepath.Join(t.TempDir(), "missing.yaml")); err == nil {
+		t.Error("配置文件不存在时应报错")
+	}
+	t.Setenv("VOICE_LLM_MAX_TOOL_ROUNDS", "many")
+	if _, err := Load(""); err == nil || !strings.Contains(err.Error(), "VOICE_LLM_MAX_TOOL_ROUNDS") {
+		t.Errorf("环境变量格式不对时应报错, 得到 %v", err)
+	}
+}
+
+func TestLoadExample(t *testing.T) {
+	if _, err := Load("../config.example.yaml"); err != nil {
+		t.Errorf("示例配置应能通过严格解析: %v", err)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	cfg, err := Load(writeConfig(t, "config.yaml", offlineYAML))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := cfg.Validate(); err != nil {
+		t.Fatalf("不需要凭证的配置应通过校验: %v", err)
+	}
+
+	// 默认使用腾讯云, 没有凭证时报错
+	if err := Default().Validate(); err == nil || !strings.Contains(err.Error(), "tencent.app_id") {
+		t.Errorf("缺少腾讯云凭证时应报错, 得到 %v", err)
+	}
+
+	// 一次报告所有问题
+	cfg.Server.Addr = ""
+	cfg.ASR.Provider = "whisper"
+	cfg.LLM.Default = "missing"
+	cfg.LLM.MaxToolRounds = 0
+	cfg.LLM.Context.KeepRecentTokens = cfg.LLM.Context.MaxTokens
+	cfg.LLM.Providers = append(cfg.LLM.Providers, ProviderConfig{Name: "fake", Type: "fake"}, ProviderConfig{Name: "bad", Type: "grpc"})
+	cfg.Recording = RecordingConfig{Enabled: true}
+	cfg.Session.VAD.MinEnergy = 2
+	err = cfg.Validate()
+	if err == nil {
+		t.Fatal("应校验失败")
+	}
+	for _, want := range []string{
+		"server.addr", "asr.provider", "llm.default", "llm.max_tool_rounds", "keep_recent_tokens",
+		"名称重复: fake", "bad 类型无效", "recording.dir", "min_energy",
+	} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("校验结果应包含 %q:\n%v", want, err)
+		}
+	}
+}
+
+func TestSecretRedacted(t *testing.T) {
+	cfg := Default()
+	// 开头和结尾用配置里不会出现的字符
+	cfg.Tencent.SecretId = "Q7Zsecret-id-value8WX"
+	cfg.Tencent.SecretKey = "J3Vshort5K"
+	cfg.LLM.Providers[0].APIKey = "Y2Ppi-key-value4RB"
+	for _, format := range []string{"%v", "%+v", "%#v", "%s"} {
+		printed := fmt.Sprintf(format, *cfg)
+		for _, secret := range []Secret{cfg.Tencent.SecretId, cfg.Tencent.SecretKey, cfg.LLM.Providers[0].APIKey} {
+			// 开头和结尾的几个字符也不能出现
+			if s := string(secret); strings.Contains(printed, s[:3]) || strings.Contains(printed, s[len(s)-2:]) {
+				t.Errorf("%s 打印出了密钥 %s 的一部分", format, s)
+			}
+		}
+	}
+	if Secret("").String() != "" {
+		t.Error("没有填写的密钥应打印为空")
+	}
+}
@@ -3,9 +3,11 @@ module main
 go 1.24.5
 
 require (
+	github.com/BurntSushi/toml v1.4.0
 	github.com/gorilla/websocket v1.5.3
 	github.com/sashabaranov/go-openai v1.40.5
 	github.com/tencentcloud/tencentcloud-sdk-go/tencentcloud/asr v1.0.1200
 	github.com/tencentcloud/tencentcloud-sdk-go/tencentcloud/common v1.0.1211
 	github.com/tencentcloud/tencentcloud-sdk-go/tencentcloud/tts v1.0.1211
+	gopkg.in/yaml.v3 v3.0.1
 )
@@ -0,0 +1,279 @@
+package history
+
+import (
+	"bufio"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sync"
+	"time"
+
+	ark "github.com/sashabaranov/go-openai"
+)
+
+// 历史记录中的一条变化
+const (
+	entryStart   = "start"   // 会话开始, 带上开场消息
+	entryMessage = "message" // 追加一条消息: 用户、大模型回答、工具调用或工具结果
+	entryReplace = "replace" // 回答被打断, 改为实际说出的内容
+	entryRemove  = "remove"  // 回答被打断且一句都没说出去, 删掉
+	entryVoice   = "voice"   // 前端改了音色、语速或音量
+	entrySummary = "summary" // 较早的对话被总结, Index 为总结截止的位置
+	entryToken   = "token"   // 早期没有令牌的记录补发的令牌
+)
+
+// entry 文件中的一行
+type entry struct {
+	Time     time.Time                   `json:"time"`
+	Type     string                      `json:"type"`
+	Persona  string                      `json:"persona,omitempty"`
+	Token    string                      `json:"token,omitempty"`
+	Messages []ark.ChatCompletionMessage `json:"messages,omitempty"`
+	Index    int                         `json:"index,omitempty"`
+	Content  string                      `json:"content,omitempty"`
+	Voice    *Voice                      `json:"voice,omitempty"`
+}
+
+// Voice 会话的语音设置, 重连或重启后接着使用
+type Voice struct {
+	Voice  string  `json:"voice"`
+	Speed  float64 `json:"speed"`
+	Volume float64 `json:"volume"`
+}
+
+var ErrNotFound = errors.New("会话不存在")
+
+// 会话 id 同时用作文件名
+var idPattern = regexp.MustCompile(`^[A-Za-z0-9_-]{1,64}$`)
+
+// Store 按会话 id 保存对话历史, 每个会话是目录下一个只追加的 <id>.jsonl 文件
+type Store struct {
+	dir string
+}
+
+func NewStore(dir string) (*Store, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("创建历史记录目录失败: %v", err)
+	}
+	return &Store{dir: dir}, nil
+}
+
+// NewID 生成一个随机的会话 id
+func NewID() string {
+	b := make([]byte, 12)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// ValidID 会话 id 只能包含字母、数字、_ 和 -
+func ValidID(id string) bool {
+	return idPattern.MatchString(id)
+}
+
+// Create 开始一段新对话并写入开场消息, token 为接着这个会话时要出示的令牌
+// 同名会话已经存在时追加在后面, 重放时从最后一次开场算起, 之前的记录仍然保留在文件里
+func (s *Store) Create(id, token, persona string, messages []ark.ChatCompletionMessage) (*Log, error) {
+	if !ValidID(id) {
+		return nil, fmt.Errorf("会话 id 无效: %q", id)
+	}
+	file, err := os.OpenFile(s.path(id), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("创建历史记录失败: %v", err)
+	}
+	l := &Log{ID: id, file: file}
+	if err := l.write(entry{Type: entryStart, Persona: persona, Token: token, Messages: messages}); err != nil {
+		file.Close()
+		return nil, err
+	}
+	return l, nil
+}
+
+// Transcript 重放后的会话内容
+type Transcript struct {
+	Messages []ark.ChatCompletionMessage
+	Opening  int    // Messages 开头有几条是开场消息
+	Persona  string // 开始时使用的角色, 自由文本设定时为空
+	Token    string // 接着这个会话时要出示的令牌, 早期的记录没有
+	Voice    *Voice // 最后一次开场之后改过的语音设置, 没改过时为 nil
+	// 较早对话的总结, 替代 Messages[Opening:Summarized] 发给大模型, 没有总结时为空
+	Summary    string
+	Summarized int
+}
+
+// Open 读出会话的全部历史并继续追加
+func (s *Store) Open(id string) (*Log, *Transcript, error) {
+	if !ValidID(id) {
+		return nil, nil, fmt.Errorf("%w: %s", ErrNotFound, id)
+	}
+	transcript, err := s.replay(id)
+	if err != nil {
+		return nil, nil, err
+	}
+	file, err := os.OpenFile(s.path(id), os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return nil, nil, fmt.Errorf("打开历史记录失败: %v", err)
+	}
+	return &Log{ID: id, file: file}, transcript, nil
+}
+
+// replay 按顺序重放文件中的每一条变化
+func (s *Store) replay(id string) (*Transcript, error) {
+	file, err := os.Open(s.path(id))
+	if os.IsNotExist(err) {
+		return nil, fmt.Errorf("%w: %s", ErrNotFound, id)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("读取历史记录失败: %v", err)
+	}
+	defer file.Close()
+
+	t := &Transcript{}
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		var e entry
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			// 进程中途退出时最后一行可能不完整, 跳过
+			log.Printf("历史记录 %s 第 %d 行无效, 已跳过: %v", id, line, err)
+			continue
+		}
+		switch e.Type {
+		case entryStart:
+			t.Messages = append([]ark.ChatCompletionMessage(nil), e.Messages...)
+			t.Opening = len(e.Messages)
+			t.Persona = e.Persona
+			t.Token = e.Token
+			t.Voice = nil
+			t.Summary, t.Summarized = "", 0
+		case entryMessage:
+			t.Messages = append(t.Messages, e.Messages...)
+		case entryReplace:
+			if e.Index >= 0 && e.Index < len(t.Messages) {
+				t.Messages[e.Index].Content = e.Content
+			}
+		case entryRemove:
+			if e.Index >= 0 && e.Index < len(t.Messages) {
+				t.Messages = append(t.Messages[:e.Index], t.Messages[e.Index+1:]...)
+				if e.Index < t.Opening {
+					t.Opening--
+				}
+				if e.Index < t.Summarized {
+					t.Summarized--
+				}
+			}
+		case entryVoice:
+			if e.Voice != nil {
+				t.Voice = e.Voice
+			}
+		case entrySummary:
+			if e.Index > t.Opening && e.Index <= len(t.Messages) {
+				t.Summary, t.Summarized = e.Content, e.Index
+			}
+		case entryToken:
+			t.Token = e.Token
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("读取历史记录失败: %v", err)
+	}
+	if len(t.Messages) == 0 {
+		return nil, fmt.Errorf("历史记录 %s 没有开场消息", id)
+	}
+	return t, nil
+}
+
+// Token 会话的令牌, 会话不存在时返回 ErrNotFound, 早期没有令牌的记录返回空
+func (s *Store) Token(id string) (string, error) {
+	if !ValidID(id) {
+		return "", fmt.Errorf("%w: %s", ErrNotFound, id)
+	}
+	transcript, err := s.replay(id)
+	if err != nil {
+		return "", err
+	}
+	return transcript.Token, nil
+}
+
+// SetToken 给早期没有令牌的记录补上令牌, 之后 Token 返回它
+func (s *Store) SetToken(id, token string) error {
+	if !ValidID(id) {
+		return fmt.Errorf("%w: %s", ErrNotFound, id)
+	}
+	file, err := os.OpenFile(s.path(id), os.O_WRONLY|os.O_APPEND, 0o644)
+	if os.IsNotExist(err) {
+		return fmt.Errorf("%w: %s", ErrNotFound, id)
+	}
+	if err != nil {
+		return fmt.Errorf("打开历史记录失败: %v", err)
+	}
+	l := &Log{ID: id, file: file}
+	defer l.Close()
+	return l.write(entry{Type: entryToken, Token: token})
+}
+
+func (s *Store) path(id string) string {
+	return filepath.Join(s.dir, id+".jsonl")
+}
+
+// Log 一个会话的历史记录, 只追加不修改
+type Log struct {
+	ID   string
+	mu   sync.Mutex
+	file *os.File
+}
+
+// Append 追加消息
+func (l *Log) Append(messages ...ark.ChatCompletionMessage) error {
+	if len(messages) == 0 {
+		return nil
+	}
+	return l.write(entry{Type: entryMessage, Messages: messages})
+}
+
+// Replace 修改第 index 条消息的内容
+func (l *Log) Replace(index int, content string) error {
+	return l.write(entry{Type: entryReplace, Index: index, Content: content})
+}
+
+// Remove 删除第 index 条消息
+func (l *Log) Remove(index int) error {
+	return l.write(entry{Type: entryRemove, Index: index})
+}
+
+// Summarize 记下较早对话的总结, 重放时接着使用
+func (l *Log) Summarize(summarized int, summary string) error {
+	return l.write(entry{Type: entrySummary, Index: summarized, Content: summary})
+}
+
+// SaveVoice 记下新的语音设置
+func (l *Log) SaveVoice(v Voice) error {
+	return l.write(entry{Type: entryVoice, Voice: &v})
+}
+
+func (l *Log) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.file.Close()
+}
+
+// write 一条变化写成一行, 一次写入
+func (l *Log) write(e entry) error {
+	e.Time = time.Now()
+	data, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	data = append(data, '\n')
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if _, err := l.file.Write(data); err != nil {
+		return fmt.Errorf("写入历史记录失败: %v", err)
+	}
+	return nil
+}
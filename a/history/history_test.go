@@ -0,0 +1,103 @@
+package history
+
+import (
+	"errors"
+	"testing"
+
+	ark "github.com/sashabaranov/go-openai"
+)
+
+func message(role, content string) ark.ChatCompletionMessage {
+	return ark.ChatCompletionMessage{Role: role, Content: content}
+}
+
+func TestReplaySummary(t *testing.T) {
+	store, err := NewStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	l, err := store.Create("s1", "token", "neko", []ark.ChatCompletionMessage{message(ark.ChatMessageRoleSystem, "你是猫娘")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	l.Append(message(ark.ChatMessageRoleUser, "我叫小明"), message(ark.ChatMessageRoleAssistant, "你好小明"))
+	l.Append(message(ark.ChatMessageRoleUser, "我喜欢猫"), message(ark.ChatMessageRoleAssistant, "我也是"))
+	l.Append(message(ark.ChatMessageRoleUser, "讲个笑话"))
+	if err := l.Summarize(5, "用户叫小明, 喜欢猫"); err != nil {
+		t.Fatal(err)
+	}
+	// 总结之前的回答被删掉, 总结的位置跟着前移
+	l.Remove(2)
+	l.Close()
+
+	_, transcript, err := store.Open("s1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if transcript.Summary != "用户叫小明, 喜欢猫" || transcript.Summarized != 4 {
+		t.Errorf("总结 %q 截止到 %d, 应截止到 4", transcript.Summary, transcript.Summarized)
+	}
+	if got := transcript.Messages[transcript.Summarized].Content; got != "讲个笑话" {
+		t.Errorf("总结之后的第一条应为 讲个笑话, 得到 %q", got)
+	}
+}
+
+func TestReplaySummaryReset(t *testing.T) {
+	store, err := NewStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	opening := []ark.ChatCompletionMessage{message(ark.ChatMessageRoleSystem, "你是猫娘")}
+	l, err := store.Create("s1", "token", "neko", opening)
+	if err != nil {
+		t.Fatal(err)
+	}
+	l.Append(message(ark.ChatMessageRoleUser, "我叫小明"), message(ark.ChatMessageRoleAssistant, "你好小明"))
+	l.Summarize(3, "用户叫小明")
+	l.Close()
+
+	// 重新开始的对话不沿用之前的总结
+	l, err = store.Create("s1", "token", "neko", opening)
+	if err != nil {
+		t.Fatal(err)
+	}
+	l.Close()
+	_, transcript, err := store.Open("s1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if transcript.Summary != "" || transcript.Summarized != 0 {
+		t.Errorf("新的开场之后不应有总结: %q %d", transcript.Summary, transcript.Summarized)
+	}
+}
+
+func TestSetToken(t *testing.T) {
+	store, err := NewStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 早期的记录开场时没有令牌
+	l, err := store.Create("s1", "", "neko", []ark.ChatCompletionMessage{message(ark.ChatMessageRoleSystem, "你是猫娘")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	l.Append(message(ark.ChatMessageRoleUser, "你好"))
+	l.Close()
+
+	if err := store.SetToken("s1", "issued"); err != nil {
+		t.Fatal(err)
+	}
+	if token, err := store.Token("s1"); err != nil || token != "issued" {
+		t.Errorf("补发的令牌 %q, %v, 应为 issued", token, err)
+	}
+	_, transcript, err := store.Open("s1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(transcript.Messages) != 2 {
+		t.Errorf("补发令牌不应改变对话, 得到 %d 条消息", len(transcript.Messages))
+	}
+	if err := store.SetToken("missing", "issued"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("会话不存在时应返回 ErrNotFound, 得到 %v", err)
+	}
+}
@@ -0,0 +1,78 @@
+package link
+
+import (
+	"errors"
+	"log"
+	"main/LLM"
+	"main/LLM/llm/roleModel"
+	"main/history"
+)
+
+// conversation 按 init 消息建立的一段对话
+type conversation struct {
+	llm      *LLM.LLMContext
+	role     *roleModel.Role // 直接填写自由文本设定时为 nil
+	greeting string          // 新会话才有开场白
+	log      *history.Log    // 不保存历史记录时为 nil
+	voice    *history.Voice  // 接着之前的对话时, 之前改过的语音设置
+}
+
+// newConversation 会话 id 有历史记录时接着之前的对话, 否则按角色或自由文本设定开始新会话
+// fresh 为 true 时总是开始新对话, 新的开场消息追加在同一个历史记录文件里; token 记在新的历史记录里
+func newConversation(provider LLM.Provider, personas *roleModel.Store, histories *history.Store, c cmd, opts Options, token string, fresh bool) conversation {
+	if histories != nil && c.Session != "" && !fresh {
+		l, transcript, err := histories.Open(c.Session)
+		if err == nil {
+			conv := conversation{log: l, voice: transcript.Voice}
+			persona := transcript.Persona
+			if c.Persona != "" {
+				persona = c.Persona
+			}
+			opening := transcript.Messages[:transcript.Opening]
+			if persona != "" {
+				role := loadPersona(personas, persona, opts.DefaultPersona)
+				conv.role = &role
+				conv.llm = LLM.NewLLMContextWithMessages(provider, opening, roleToolset(role), opts.LLM)
+			} else {
+				conv.llm = LLM.NewLLMContextWithMessages(provider, opening, nil, opts.LLM)
+			}
+			conv.llm.Restore(transcript.Messages[transcript.Opening:])
+			conv.llm.RestoreSummary(transcript.Summary, transcript.Summarized)
+			conv.llm.SetRecorder(l)
+			log.Printf("继续会话 %s, 共 %d 条历史消息", l.ID, len(transcript.Messages))
+			return conv
+		}
+		if !errors.Is(err, history.ErrNotFound) {
+			log.Printf("读取会话 %s 失败, 开始新会话: %v", c.Session, err)
+		}
+	}
+
+	var conv conversation
+	var persona string
+	if c.Persona == "" && (c.System != "" || c.User != "") {
+		// 兼容直接填写的自由文本设定
+		conv.llm = LLM.NewLLMContext(provider, c.System, c.User, opts.LLM)
+	} else {
+		role := loadPersona(personas, c.Persona, opts.DefaultPersona)
+		conv.role = &role
+		conv.llm = newPersonaContext(provider, role, opts.LLM)
+		conv.greeting = role.Greeting
+		persona = role.ID
+	}
+
+	if histories != nil {
+		// 前端指定的 id 没有记录时直接用它, 方便前端自己生成 id
+		id := c.Session
+		if !history.ValidID(id) {
+			id = history.NewID()
+		}
+		l, err := histories.Create(id, token, persona, conv.llm.Messages())
+		if err != nil {
+			log.Printf("创建会话记录失败, 本次对话不会保存: %v", err)
+		} else {
+			conv.log = l
+			conv.llm.SetRecorder(l)
+		}
+	}
+	return conv
+}
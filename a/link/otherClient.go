@@ -1,14 +1,56 @@
 package link
 
+import (
+	"fmt"
+	"main/LLM/llm/tools"
+	"main/audio"
+	"main/tts"
+)
+
 type Location struct {
 	Latitude  float64 `json:"latitude"`
 	Longitude float64 `json:"longitude"`
 	Accuracy  float64 `json:"accuracy"` // 精度，单位米
 }
 
+func (l Location) valid() bool {
+	return l.Latitude >= -90 && l.Latitude <= 90 && l.Longitude >= -180 && l.Longitude <= 180 && l.Accuracy >= 0
+}
+
+// note 发给大模型的位置说明
+func (l Location) note() string {
+	note := fmt.Sprintf("用户当前的位置: 纬度 %.4f, 经度 %.4f", l.Latitude, l.Longitude)
+	if l.Accuracy > 0 {
+		note += fmt.Sprintf(", 精度约 %.0f 米", l.Accuracy)
+	}
+	return note + "。用户问这里、附近或本地的天气等和位置有关的问题而没有说地点时, 以这个位置为准, 调用工具时可以不填经纬度。"
+}
+
+func (l Location) tool() tools.Location {
+	return tools.Location{Latitude: l.Latitude, Longitude: l.Longitude, Accuracy: l.Accuracy}
+}
+
 type cmd struct {
 	Type     string    `json:"type"`
 	System   string    `json:"system"`
 	User     string    `json:"user"`
+	Provider string    `json:"provider"` // 大模型后端名称, 仅 init 使用
+	Persona  string    `json:"persona"`  // 角色 id, 仅 init 使用, 优先于 system 和 user
+	Session  string    `json:"session"`  // 会话 id, 仅 init 使用, 有历史记录时接着之前的对话
+	Token    string    `json:"token"`    // 仅 init 使用, 接着已有的会话时和 session 一起带上, 见 SessionPayload.Token
 	Location *Location `json:"location"`
+	// 仅 init 使用, 希望收到的音频格式, 为空时使用 16k 的 wav
+	Audio *tts.OutputFormat `json:"audio"`
+	// 仅 init 使用, 之后发来的麦克风音频的格式, 为空时是 16k 单声道 16 位 PCM
+	Input *audio.InputFormat `json:"input"`
+	Voice string             `json:"voice"` // 仅 voice 使用, 音色编号或名称, 见 GET /api/voices
+	// 仅 hello 使用, 前端支持的协议版本和能力
+	Versions     []int    `json:"versions"`
+	Capabilities []string `json:"capabilities"`
+}
+
+// inboundMessage 前端发来的一条消息
+type inboundMessage struct {
+	messageType int
+	data        []byte
 }
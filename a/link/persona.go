@@ -0,0 +1,40 @@
+package link
+
+import (
+	"log"
+	"main/LLM"
+	"main/LLM/llm/roleModel"
+	"main/LLM/llm/tools"
+)
+
+// loadPersona 按 id 取角色, id 为空时用默认角色, 都找不到时用内置的猫娘
+func loadPersona(personas *roleModel.Store, id, defaultID string) roleModel.Role {
+	if id == "" {
+		id = defaultID
+	}
+	role, err := personas.Get(id)
+	if err == nil {
+		return role
+	}
+	log.Printf("%v, 改用默认角色 %s", err, defaultID)
+	if role, err := personas.Get(defaultID); err == nil {
+		return role
+	}
+	return roleModel.Neko
+}
+
+// newPersonaContext 用角色设定创建大模型上下文
+func newPersonaContext(provider LLM.Provider, role roleModel.Role, opts LLM.Options) *LLM.LLMContext {
+	return LLM.NewLLMContextWithMessages(provider, role.Messages(), roleToolset(role), opts)
+}
+
+// roleToolset 角色可以使用的工具
+func roleToolset(role roleModel.Role) *tools.Registry {
+	toolset, err := role.Toolset()
+	if err != nil {
+		// 角色文件里的工具后来被移除了, 退回到全部工具
+		log.Printf("角色 %s 的工具设置无效: %v", role.ID, err)
+		return nil
+	}
+	return toolset
+}
@@ -0,0 +1,294 @@
+package link
+
+import (
+	"encoding/json"
+	"fmt"
+	"main/audio"
+	"main/tts"
+
+	"github.com/gorilla/websocket"
+)
+
+// 前后端之间的 WebSocket 消息协议
+//
+// 第 1 版起每条文本消息都是一个信封:
+//
+//	{"v":1,"type":"answer.delta","turn":3,"seq":12,"payload":{"text":"你好"}}
+//
+// v 为协议版本, turn 为所属的一轮问答(不属于任何一轮时省略), seq 为本条连接上后端发出的消息序号, 从 1 开始递增.
+// 前端连上后先发 hello 说明支持的版本和能力, 后端回 hello 确定使用的版本和双方都支持的能力.
+// 没发 hello 的前端按第 0 版处理, 识别结果和回答仍是最早的 {"asrReturn": "..."}、{"answer": "..."}:
+// 每个识别结果(包括中间结果)发一条 asrReturn, 每轮回答说完后整段发一条 answer, 不发增量.
+// 第 0 版另外只有 {"session": id}、{"control": "stop"} 和 {"error": ..., "code": ...}, 早期前端不认识的键会忽略.
+//
+// 音频仍然用二进制帧发送, 协商了 audio.meta 能力时每个二进制帧之前先发一条 audio 消息说明这段音频.
+// 前端发来的消息同样是信封, payload 的字段和第 0 版的 init 消息相同, 比如:
+//
+//	{"v":1,"type":"init","payload":{"persona":"neko","session":"abc"}}
+//
+// init 里可以用 audio 选择音频格式和采样率, 比如 {"audio":{"format":"opus","sampleRate":16000}},
+// 格式可选 wav(默认)、pcm、mp3、opus, 后端合成不了的格式在服务端转码, session 消息里会带上最终使用的格式.
+// 用 input 说明之后发来的麦克风音频, 比如 {"input":{"encoding":"f32le","sampleRate":48000,"channels":2}},
+// 编码可选 s16le(默认)、f32le, 采样率 8k~48k, 单声道或立体声, 后端混成单声道并重采样到 16k 后再交给语音识别.
+// 流量敏感的客户端可以发 opus: opus 为裸 opus 包, 每个二进制帧一个; ogg、webm 为 MediaRecorder 录出的流, 二进制帧按顺序拼起来是完整的文件.
+// opus 在后端用 ffmpeg 解码, 换成压缩格式或重连后要从流的开头发起, 解码失败时回复 input_format 错误, 重新发 init 后恢复.
+
+// ProtocolVersion 后端支持的最高协议版本
+const ProtocolVersion = 1
+
+// 后端发给前端的消息类型
+const (
+	TypeHello       = "hello"        // HelloPayload, 回复前端的 hello
+	TypeSession     = "session"      // SessionPayload, init 之后告诉前端会话 id
+	TypeTranscript  = "transcript"   // TranscriptPayload, 语音识别的中间结果或一句话的最终结果
+	TypeAnswerDelta = "answer.delta" // AnswerPayload, 大模型回答的增量
+	TypeAnswerDone  = "answer.done"  // AnswerPayload, 一轮回答结束, 带上完整内容
+	TypeAudio       = "audio"        // AudioPayload, 紧跟着的二进制帧是这段音频
+	TypeStop        = "stop"         // StopPayload, 用户插话打断了本轮回答, 前端停止播放
+	TypeState       = "state"        // StatePayload, 后端所处的状态变化
+	TypeError       = "error"        // ErrorPayload, 前端的消息无法处理, 或者语音识别等后端出错
+)
+
+// 前端发给后端的消息类型, payload 见 cmd
+const (
+	TypeInit   = "init"   // 开始或恢复会话
+	TypeGo     = "go"     // 立即把识别到的内容交给大模型
+	TypeHangup = "hangup" // 结束会话
+	TypeUp     = "up"     // 调大音量
+	TypeDown   = "down"   // 调小音量
+	TypeFast   = "fast"   // 加快语速
+	TypeLate   = "late"   // 放慢语速
+	TypeVoice  = "voice"  // 切换音色, payload 为 {"voice": "601000"}
+	// 上报用户当前的位置, payload 为 {"location": {"latitude":..,"longitude":..,"accuracy":..}}
+	TypeUpdateLocation = "updateLocation"
+)
+
+// 能力, 只有双方都支持的才会启用
+const (
+	CapResume    = "resume"     // 断线后带着会话 id 重连可以继续
+	CapInterrupt = "interrupt"  // 用户开口会打断回答
+	CapState     = "state"      // 发送 state 消息
+	CapAudioMeta = "audio.meta" // 二进制音频帧之前先发 audio 消息
+)
+
+// serverCapabilities 后端支持的全部能力
+var serverCapabilities = []string{CapResume, CapInterrupt, CapState, CapAudioMeta}
+
+// 后端的状态
+const (
+	StateThinking = "thinking" // 大模型正在生成回答
+	StateSpeaking = "speaking" // 开始发送本轮的音频
+	StateIdle     = "idle"     // 本轮的回答和音频都已发出, 或者被打断
+)
+
+// 错误码
+const (
+	ErrBadMessage         = "bad_message"         // 消息不是合法的 JSON
+	ErrUnknownType        = "unknown_type"        // 不认识的消息类型
+	ErrUnsupportedVersion = "unsupported_version" // hello 里没有后端支持的版本
+	ErrSession            = "session"             // 无法切换到指定的会话, 比如令牌不对, 继续使用原来的会话
+	ErrTakenOver          = "taken_over"          // 会话被带着令牌的新连接接管, 随后断开, 前端不要自动重连
+	ErrAudioFormat        = "audio_format"        // init 里要求的音频格式不支持, 继续使用原来的格式
+	ErrInputFormat        = "input_format"        // init 里说明的麦克风音频格式不支持, 继续按原来的格式处理; 或者压缩音频解码失败
+	ErrInputOverflow      = "input_overflow"      // 压缩音频来得比解码快, 这条音频流作废, 前端重新发 init 后从头开始发
+	ErrVoice              = "voice"               // 音色目录里没有 voice 消息指定的音色
+	ErrASR                = "asr"                 // 语音识别出错, 随后断开连接, 重连后重新开始识别
+)
+
+// Envelope 第 1 版起所有文本消息的外层
+type Envelope struct {
+	V       int             `json:"v"`
+	Type    string          `json:"type"`
+	Turn    int64           `json:"turn,omitempty"`
+	Seq     int64           `json:"seq,omitempty"`
+	Payload json.RawMessage `json:"payload,omitempty"`
+}
+
+// HelloPayload 前端的 hello 列出支持的版本和能力, 后端回复选定的版本和双方都支持的能力
+type HelloPayload struct {
+	Versions     []int    `json:"versions,omitempty"`
+	Version      int      `json:"version,omitempty"`
+	Capabilities []string `json:"capabilities"`
+}
+
+type SessionPayload struct {
+	ID string `json:"id"`
+	// 接着这个会话要出示的令牌, 只发给这条连接; id 会出现在录音等接口里, 光有 id 不能接管会话
+	Token   string            `json:"token"`
+	Resumed bool              `json:"resumed"` // 接着断线前的对话
+	Audio   tts.OutputFormat  `json:"audio"`   // 之后的音频使用的格式
+	Input   audio.InputFormat `json:"input"`   // 之后发来的麦克风音频按这个格式处理
+}
+
+type TranscriptPayload struct {
+	Text  string `json:"text"`
+	Final bool   `json:"final"` // 一句话的最终结果, 否则是中间结果, 会被后面的结果替换
+}
+
+type AnswerPayload struct {
+	Text string `json:"text"`
+}
+
+type AudioPayload struct {
+	Format     string `json:"format"`
+	SampleRate int    `json:"sampleRate"`
+	Bytes      int    `json:"bytes"`
+	DurationMs int64  `json:"durationMs"` // 无法计算时为 0
+	Text       string `json:"text"`       // 这段音频对应的文字
+}
+
+type StopPayload struct {
+	Spoken string `json:"spoken"` // 被打断前已经播放的内容
+}
+
+type StatePayload struct {
+	State string `json:"state"`
+}
+
+type ErrorPayload struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// Message 一条发给前端的消息, 发送时按协商好的版本编码
+type Message struct {
+	Type    string
+	Turn    int64
+	Payload any
+}
+
+// legacy 第 0 版的格式, 第 0 版没有的消息返回 nil
+func (m Message) legacy() map[string]string {
+	switch p := m.Payload.(type) {
+	case SessionPayload:
+		return map[string]string{"session": p.ID, "token": p.Token}
+	case TranscriptPayload:
+		return map[string]string{"asrReturn": p.Text}
+	case AnswerPayload:
+		if m.Type == TypeAnswerDone {
+			return map[string]string{"answer": p.Text}
+		}
+		return nil
+	case StopPayload:
+		return map[string]string{"control": "stop", "spoken": p.Spoken}
+	case ErrorPayload:
+		// 早期的前端会忽略, 没发 hello 或 hello 协商失败时也能看到原因
+		return map[string]string{"error": p.Message, "code": p.Code}
+	}
+	return nil
+}
+
+// decodeCommand 解析前端的文本消息, 带 v 的是信封, 否则按第 0 版解析
+func decodeCommand(data []byte) (cmd, error) {
+	var env Envelope
+	if err := json.Unmarshal(data, &env); err != nil {
+		return cmd{}, err
+	}
+	var c cmd
+	if env.V == 0 {
+		err := json.Unmarshal(data, &c)
+		return c, err
+	}
+	if len(env.Payload) > 0 {
+		if err := json.Unmarshal(env.Payload, &c); err != nil {
+			return cmd{}, fmt.Errorf("%s 消息的 payload 无效: %v", env.Type, err)
+		}
+	}
+	c.Type = env.Type
+	return c, nil
+}
+
+// negotiate 按前端的 hello 选出双方都支持的最高版本和能力, 没有共同版本时 ok 为 false
+func negotiate(hello cmd) (version int, capabilities []string, ok bool) {
+	for _, v := range hello.Versions {
+		if v >= 1 && v <= ProtocolVersion && v > version {
+			version = v
+		}
+	}
+	if version == 0 {
+		return 0, nil, false
+	}
+	capabilities = []string{}
+	for _, c := range serverCapabilities {
+		for _, wanted := range hello.Capabilities {
+			if c == wanted {
+				capabilities = append(capabilities, c)
+				break
+			}
+		}
+	}
+	return version, capabilities, true
+}
+
+// encoder 按协商好的版本把消息写到一条连接上, 只在处理消息的循环里使用
+type encoder struct {
+	conn         frameWriter
+	version      int
+	capabilities map[string]bool
+	seq          int64
+}
+
+// frameWriter 发送文本和二进制帧, 由 *websocket.Conn 实现
+type frameWriter interface {
+	WriteJSON(v any) error
+	WriteMessage(messageType int, data []byte) error
+}
+
+func newEncoder(conn frameWriter) *encoder {
+	return &encoder{conn: conn, capabilities: map[string]bool{}}
+}
+
+// upgrade hello 协商之后切换到新的版本
+func (e *encoder) upgrade(version int, capabilities []string) {
+	e.version = version
+	e.capabilities = map[string]bool{}
+	for _, c := range capabilities {
+		e.capabilities[c] = true
+	}
+}
+
+func (e *encoder) send(m Message) error {
+	if e.version == 0 {
+		if legacy := m.legacy(); legacy != nil {
+			return e.conn.WriteJSON(legacy)
+		}
+		return nil
+	}
+	if m.Type == TypeState && !e.capabilities[CapState] {
+		return nil
+	}
+	payload, err := json.Marshal(m.Payload)
+	if err != nil {
+		return err
+	}
+	e.seq++
+	return e.conn.WriteJSON(Envelope{V: e.version, Type: m.Type, Turn: m.Turn, Seq: e.seq, Payload: payload})
+}
+
+// sendAudio 发送一段音频, 协商了 audio.meta 时先发说明
+// 说明和音频是一组: 说明发出去而音频没发出去时记在 item 上, 在同一个连接上重试只补发音频, 换了连接才连同说明重发
+func (e *encoder) sendAudio(item *outbound) error {
+	turn, text, audio := item.audio.turn.id, item.audio.text, item.audio.audio
+	if e.version > 0 && e.capabilities[CapAudioMeta] && item.metaSent != e {
+		if err := e.send(Message{Type: TypeAudio, Turn: turn, Payload: AudioPayload{
+			Format:     audio.Format,
+			SampleRate: audio.SampleRate,
+			Bytes:      len(audio.Data),
+			DurationMs: audio.Duration().Milliseconds(),
+			Text:       text,
+		}}); err != nil {
+			return err
+		}
+		item.metaSent = e
+	}
+	if err := e.conn.WriteMessage(websocket.BinaryMessage, audio.Data); err != nil {
+		return err
+	}
+	item.metaSent = nil
+	return nil
+}
+
+// sendError 告诉前端消息无法处理
+func (e *encoder) sendError(code, message string) error {
+	return e.send(Message{Type: TypeError, Payload: ErrorPayload{Code: code, Message: message}})
+}
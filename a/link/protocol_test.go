@@ -0,0 +1,100 @@
+package link
+
+import (
+	"encoding/json"
+	"errors"
+	"main/tts"
+	"testing"
+
+	"github.com/gorilla/websocket"
+)
+
+// fakeConn 记下发出的帧, failBinary 次二进制帧发送失败
+type fakeConn struct {
+	frames     []string
+	failBinary int
+}
+
+func (c *fakeConn) WriteJSON(v any) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	c.frames = append(c.frames, string(data))
+	return nil
+}
+
+func (c *fakeConn) WriteMessage(messageType int, data []byte) error {
+	if messageType == websocket.BinaryMessage && c.failBinary > 0 {
+		c.failBinary--
+		return errors.New("连接已断开")
+	}
+	c.frames = append(c.frames, "binary:"+string(data))
+	return nil
+}
+
+func TestLegacyShapes(t *testing.T) {
+	conn := &fakeConn{}
+	enc := newEncoder(conn)
+	for _, m := range []Message{
+		{Type: TypeTranscript, Payload: TranscriptPayload{Text: "今天"}},
+		{Type: TypeTranscript, Payload: TranscriptPayload{Text: "今天天气", Final: true}},
+		{Type: TypeAnswerDelta, Turn: 1, Payload: AnswerPayload{Text: "晴"}},
+		{Type: TypeAnswerDone, Turn: 1, Payload: AnswerPayload{Text: "晴天"}},
+		{Type: TypeState, Payload: StatePayload{State: "idle"}},
+	} {
+		if err := enc.send(m); err != nil {
+			t.Fatal(err)
+		}
+	}
+	want := []string{`{"asrReturn":"今天"}`, `{"asrReturn":"今天天气"}`, `{"answer":"晴天"}`}
+	if len(conn.frames) != len(want) {
+		t.Fatalf("第 0 版应只发早期的消息, 得到 %q", conn.frames)
+	}
+	for i := range want {
+		if conn.frames[i] != want[i] {
+			t.Errorf("第 %d 条 %s, 应为 %s", i, conn.frames[i], want[i])
+		}
+	}
+}
+
+func TestSendAudioRetry(t *testing.T) {
+	conn := &fakeConn{failBinary: 1}
+	enc := newEncoder(conn)
+	enc.upgrade(1, []string{CapAudioMeta})
+	item := outbound{audio: &audioItem{
+		sentenceItem: sentenceItem{turn: &turn{id: 2}, text: "你好"},
+		audio:        &tts.Audio{Data: []byte("pcm"), Format: "pcm", SampleRate: 16000},
+	}}
+
+	if err := enc.sendAudio(&item); err == nil {
+		t.Fatal("音频发送失败应返回错误")
+	}
+	// 同一个连接上重试只补发音频, 说明不会发两次
+	if err := enc.sendAudio(&item); err != nil {
+		t.Fatal(err)
+	}
+	if len(conn.frames) != 2 || conn.frames[1] != "binary:pcm" {
+		t.Fatalf("应为一条说明加一段音频, 得到 %q", conn.frames)
+	}
+	var env Envelope
+	json.Unmarshal([]byte(conn.frames[0]), &env)
+	if env.Type != TypeAudio || env.Turn != 2 {
+		t.Errorf("说明 %s", conn.frames[0])
+	}
+
+	// 换了连接重新发, 说明和音频都要发
+	conn2 := &fakeConn{failBinary: 0}
+	enc2 := newEncoder(conn2)
+	enc2.upgrade(1, []string{CapAudioMeta})
+	item.metaSent = enc
+	if err := enc2.sendAudio(&item); err != nil {
+		t.Fatal(err)
+	}
+	if len(conn2.frames) != 2 || conn2.frames[1] != "binary:pcm" {
+		t.Errorf("新连接上应连同说明重发, 得到 %q", conn2.frames)
+	}
+	if item.metaSent != nil {
+		t.Error("发送成功后应清除记录")
+	}
+}
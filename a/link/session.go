@@ -0,0 +1,566 @@
+package link
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"log"
+	"main/LLM"
+	"main/LLM/llm/roleModel"
+	"main/LLM/llm/tools"
+	"main/history"
+	"main/recording"
+	"main/tts"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 断线期间最多缓存多少条还没发出去的消息, 超过后丢弃最早的
+const outboxLimit = 256
+
+// sessions 服务端会话表, 所有连接共用
+type sessions struct {
+	synth     tts.Synthesizer
+	providers *LLM.Providers
+	personas  *roleModel.Store
+	histories *history.Store
+	// 为 nil 时不录音
+	recordings *recording.Store
+	opts       Options
+
+	mu   sync.Mutex
+	byID map[string]*Session
+}
+
+func newSessions(synth tts.Synthesizer, providers *LLM.Providers, personas *roleModel.Store, histories *history.Store, recordings *recording.Store, opts Options) *sessions {
+	return &sessions{
+		synth:      synth,
+		providers:  providers,
+		personas:   personas,
+		histories:  histories,
+		recordings: recordings,
+		opts:       opts,
+		byID:       make(map[string]*Session),
+	}
+}
+
+// errSessionToken 接着已有的会话时没带令牌或令牌不对
+var errSessionToken = errors.New("会话令牌不对, 不能接着这个会话")
+
+// connection 一条前端连接, 只用来区分是哪条连接占用了会话
+type connection struct {
+	// 会话被新的连接接管时关闭旧连接
+	kick context.CancelFunc
+}
+
+// attach 连接接入会话: id 对应的会话还在时接着使用, 否则新建
+// 接着已有的会话(内存里的或者历史记录里的)要出示创建时发给前端的令牌, 不对时返回 errSessionToken
+// 会话同一时间只属于一条连接, 旧连接还没断开时会被踢掉
+func (m *sessions) attach(id, token string, conn *connection) (s *Session, resumed bool, err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if s, ok := m.byID[id]; ok {
+		if !sameToken(s.token, token) {
+			return nil, false, errSessionToken
+		}
+		s.mu.Lock()
+		if s.idle != nil {
+			s.idle.Stop()
+			s.idle = nil
+		}
+		old := s.conn
+		s.conn = conn
+		s.mu.Unlock()
+		if old != nil {
+			log.Printf("会话 %s 被新的连接接管", id)
+			old.kick()
+		}
+		return s, true, nil
+	}
+
+	if !history.ValidID(id) {
+		id = history.NewID()
+	}
+	// 有历史记录的会话沿用记下的令牌, 早期没有令牌的记录发一个新的并写回记录里
+	stored, legacy := "", false
+	if m.histories != nil {
+		stored, err = m.histories.Token(id)
+		switch {
+		case errors.Is(err, history.ErrNotFound):
+			stored = ""
+		case err != nil:
+			return nil, false, err
+		case stored == "":
+			legacy = true
+		case !sameToken(stored, token):
+			return nil, false, errSessionToken
+		}
+	}
+	if stored == "" {
+		stored = history.NewID()
+	}
+	if legacy {
+		if err := m.histories.SetToken(id, stored); err != nil {
+			return nil, false, err
+		}
+	}
+	s, err = newSession(m, id, stored)
+	if err != nil {
+		return nil, false, err
+	}
+	s.conn = conn
+	m.byID[id] = s
+	return s, false, nil
+}
+
+// sameToken 按固定时间比较, 不泄露令牌前缀是否猜对
+func sameToken(want, got string) bool {
+	return subtle.ConstantTimeCompare([]byte(want), []byte(got)) == 1
+}
+
+// detach 连接断开, 会话保留一段时间等待重连, 还没初始化过的会话直接关闭
+func (m *sessions) detach(s *Session, conn *connection) {
+	s.mu.Lock()
+	if s.conn != conn {
+		// 已经被新的连接接管
+		s.mu.Unlock()
+		return
+	}
+	s.conn = nil
+	if s.init != nil && m.opts.ResumeGrace > 0 {
+		s.idle = time.AfterFunc(m.opts.ResumeGrace, func() { m.expire(s) })
+		s.mu.Unlock()
+		log.Printf("会话 %s 的连接已断开, %v 内重连可以继续", s.ID, m.opts.ResumeGrace)
+		return
+	}
+	s.mu.Unlock()
+	m.remove(s)
+}
+
+// expire 断线超过等待时间, 没有重连就结束会话
+func (m *sessions) expire(s *Session) {
+	s.mu.Lock()
+	attached := s.conn != nil
+	s.mu.Unlock()
+	if attached {
+		return
+	}
+	log.Printf("会话 %s 超时未重连, 已结束", s.ID)
+	m.remove(s)
+}
+
+// remove 从会话表中删除并关闭会话
+func (m *sessions) remove(s *Session) {
+	m.mu.Lock()
+	if m.byID[s.ID] == s {
+		delete(m.byID, s.ID)
+	}
+	m.mu.Unlock()
+	s.close()
+}
+
+// Session 服务端会话, 保存大模型上下文、语音合成设置和还没发给前端的消息
+// 前端断线后会话保留一段时间, 带着会话 id 重连时接着使用
+type Session struct {
+	ID string
+	// 重连时要带上的令牌, 只发给前端, 不出现在录音等用会话 id 的接口里
+	token string
+
+	m      *sessions
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+
+	TTS *tts.TTSConfig
+	// 等待大模型回答的问题和等待合成的句子
+	questions chan question
+	sentences chan sentenceItem
+	outbox    *outbox
+	recorder  *recording.Recorder
+
+	mu          sync.Mutex
+	provider    LLM.Provider
+	llmCtx      *LLM.LLMContext
+	historyLog  *history.Log
+	init        *cmd      // 最近一次 init, nil 表示还没初始化
+	currentTurn *turn     // 正在进行的一轮问答, 用户插话时打断
+	turns       int64     // 已经开始的轮数, 用作下一轮的 id
+	location    *Location // 前端最近一次上报的位置, nil 表示没有上报
+	conn        *connection
+	idle        *time.Timer
+}
+
+// newSession 创建会话并启动大模型和语音合成协程, 收到 init 前使用默认角色
+func newSession(m *sessions, id, token string) (*Session, error) {
+	provider, err := m.providers.Get("")
+	if err != nil {
+		return nil, err
+	}
+	role := loadPersona(m.personas, "", m.opts.DefaultPersona)
+	ctx, cancel := context.WithCancel(context.Background())
+	s := &Session{
+		ID:        id,
+		token:     token,
+		m:         m,
+		ctx:       ctx,
+		cancel:    cancel,
+		TTS:       tts.InitTTSConfig(),
+		questions: make(chan question, 10),
+		sentences: make(chan sentenceItem, 10),
+		outbox:    newOutbox(outboxLimit),
+		provider:  provider,
+		llmCtx:    newPersonaContext(provider, role, m.opts.LLM),
+	}
+	s.TTS.Apply(role.Voice, role.Speed, role.Volume)
+	if m.recordings != nil {
+		if s.recorder, err = m.recordings.Open(id, token); err != nil {
+			log.Printf("会话 %s 不录音: %v", id, err)
+		}
+	}
+
+	s.wg.Add(2)
+	go s.answerLoop()
+	go s.synthesizeLoop()
+	log.Printf("新建会话 %s", id)
+	return s, nil
+}
+
+// start 按 init 消息开始对话, 返回要说的开场白
+// 重连后前端会再发一次相同的 init, 这时保持原来的对话不变, resumed 为 true
+func (s *Session) start(c cmd) (greeting string, resumed bool) {
+	c.Session = s.ID
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.init != nil && sameInit(*s.init, c) {
+		log.Printf("会话 %s 已恢复, 继续原来的对话", s.ID)
+		return "", true
+	}
+
+	// 可以按名称为本次会话选择大模型后端
+	if selected, err := s.m.providers.Get(c.Provider); err != nil {
+		log.Printf("%v, 继续使用 %s", err, s.provider.Name())
+	} else {
+		s.provider = selected
+	}
+	// 已经初始化过的会话换了设定, 开始新的对话, 历史记录追加在同一个文件里
+	fresh := s.init != nil
+	conv := newConversation(s.provider, s.m.personas, s.m.histories, c, s.m.opts, s.token, fresh)
+	s.llmCtx = conv.llm
+	if s.location != nil {
+		s.llmCtx.SetEnvironment(s.location.note())
+	}
+	if s.historyLog != nil && s.historyLog != conv.log {
+		s.historyLog.Close()
+	}
+	s.historyLog = conv.log
+	if conv.role != nil {
+		s.TTS.Apply(conv.role.Voice, conv.role.Speed, conv.role.Volume)
+		log.Printf("已更新LLM上下文: session=%s, provider=%s, persona=%s", s.ID, s.provider.Name(), conv.role.ID)
+	} else {
+		s.TTS.Apply("", nil, nil)
+		log.Printf("已更新LLM上下文: session=%s, provider=%s, system=%s, user=%s", s.ID, s.provider.Name(), c.System, c.User)
+	}
+	if v := conv.voice; v != nil {
+		s.TTS.Apply(v.Voice, &v.Speed, &v.Volume)
+	}
+	s.init = &c
+	return conv.greeting, false
+}
+
+// sameInit 两次 init 的设定是否相同
+func sameInit(a, b cmd) bool {
+	return a.Persona == b.Persona && a.System == b.System && a.User == b.User && a.Provider == b.Provider
+}
+
+// setOutput 按 init 消息里的 audio 切换发给前端的音频格式, 返回之后使用的格式
+// requested 为 nil 或不支持时保持原来的格式
+func (s *Session) setOutput(requested *tts.OutputFormat) (tts.OutputFormat, error) {
+	s.TTS.StateMutex.Lock()
+	current := s.TTS.Output
+	s.TTS.StateMutex.Unlock()
+	if requested == nil {
+		return current, nil
+	}
+	output, err := tts.CheckOutputFormat(s.m.synth, *requested)
+	if err != nil {
+		return current, err
+	}
+	s.TTS.SetOutput(output)
+	log.Printf("会话 %s 的音频格式: %s %dHz", s.ID, output.Format, output.SampleRate)
+	return output, nil
+}
+
+// setVoice 切换音色, key 为音色目录里的编号或名称, 后端没有音色目录时原样使用
+func (s *Session) setVoice(key string) error {
+	if voices := tts.Voices(s.m.synth); voices != nil {
+		v, ok := tts.FindVoice(voices, key)
+		if !ok {
+			return fmt.Errorf("没有这个音色: %s", key)
+		}
+		key = v.ID
+	}
+	s.TTS.SetVoice(key)
+	s.saveVoice()
+	return nil
+}
+
+// saveVoice 把当前的音色、语速和音量记到历史记录里, 重连或重启后接着使用
+func (s *Session) saveVoice() {
+	voice, speed, volume := s.TTS.Settings()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.historyLog == nil {
+		return
+	}
+	if err := s.historyLog.SaveVoice(history.Voice{Voice: voice, Speed: speed, Volume: volume}); err != nil {
+		log.Printf("保存语音设置失败: %v", err)
+	}
+}
+
+// setLocation 记下前端上报的位置, 之后的回答和工具调用都会用到
+func (s *Session) setLocation(loc Location) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.location = &loc
+	s.llmCtx.SetEnvironment(loc.note())
+}
+
+// question 用户的一个问题, mic 是这个问题的录音, 见 Recorder.CutMic
+type question struct {
+	text string
+	mic  int
+}
+
+// recordMic 录下前端发来的麦克风音频
+func (s *Session) recordMic(pcm []byte) {
+	s.recorder.WriteMic(pcm)
+}
+
+// ask 把用户的话交给大模型
+func (s *Session) ask(text string) {
+	q := question{text: text, mic: s.recorder.CutMic()}
+	select {
+	case s.questions <- q:
+	case <-s.ctx.Done():
+	}
+}
+
+// activeTurn 助手正在回答或播放时返回这一轮, 否则返回 nil
+func (s *Session) activeTurn(now time.Time) *turn {
+	s.mu.Lock()
+	t := s.currentTurn
+	s.mu.Unlock()
+	if t != nil && t.active(now) {
+		return t
+	}
+	return nil
+}
+
+// interrupt 打断本轮回答并通知前端停止播放
+func (s *Session) interrupt(t *turn) {
+	spoken := t.interrupt(time.Now())
+	log.Printf("用户插话, 打断回答, 已播放: %s", spoken)
+	s.send(Message{Type: TypeStop, Turn: t.id, Payload: StopPayload{Spoken: spoken}})
+	if t.settleNow() {
+		s.recorder.FinishTurn(t.id)
+		s.send(Message{Type: TypeState, Turn: t.id, Payload: StatePayload{State: StateIdle}})
+	}
+}
+
+// nextTurn 开始新的一轮问答
+func (s *Session) nextTurn() *turn {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.turns++
+	s.currentTurn = newTurn(s.ctx, s.turns)
+	return s.currentTurn
+}
+
+// send 把消息放进待发送队列, 连接断开时等重连后再发
+func (s *Session) send(m Message) {
+	s.outbox.push(outbound{message: &m})
+}
+
+// settle 本轮的回答和音频都已交给前端时通知前端
+func (s *Session) settle(t *turn) {
+	if t.settle() {
+		s.recorder.FinishTurn(t.id)
+		s.send(Message{Type: TypeState, Turn: t.id, Payload: StatePayload{State: StateIdle}})
+	}
+}
+
+// greet 说出角色的开场白, 和大模型的回答一样可以被打断
+func (s *Session) greet(text string) {
+	// 角色的开场白也可以带情感标签
+	text, emotion := LLM.StripEmotion(text, LLM.Emotion{})
+	t := s.nextTurn()
+	t.addPending()
+	s.send(Message{Type: TypeAnswerDone, Turn: t.id, Payload: AnswerPayload{Text: text}})
+	t.finishGenerating()
+	select {
+	case s.sentences <- sentenceItem{turn: t, text: text, emotion: emotion}:
+	case <-s.ctx.Done():
+	}
+}
+
+// answerLoop 处理 LLM 回复: 文本增量直接发给前端, 完整的句子送去合成
+func (s *Session) answerLoop() {
+	defer s.wg.Done()
+	for {
+		var q question
+		select {
+		case q = <-s.questions:
+		case <-s.ctx.Done():
+			return
+		}
+
+		t := s.nextTurn()
+		s.recorder.NameMic(q.mic, t.id)
+		s.mu.Lock()
+		llmCtx := s.llmCtx
+		ctx := t.ctx
+		if s.location != nil {
+			// 查天气等工具没有指定地点时使用用户当前的位置
+			ctx = tools.WithLocation(ctx, s.location.tool())
+		}
+		s.mu.Unlock()
+		s.send(Message{Type: TypeState, Turn: t.id, Payload: StatePayload{State: StateThinking}})
+
+		var answer strings.Builder
+		reply := llmCtx.Ask(ctx, q.text)
+		t.setReply(reply)
+		for chunk := range reply.Chunks {
+			// 被打断后剩下的内容不再发送
+			if t.canceled() {
+				continue
+			}
+			if chunk.Delta != "" {
+				answer.WriteString(chunk.Delta)
+				s.send(Message{Type: TypeAnswerDelta, Turn: t.id, Payload: AnswerPayload{Text: chunk.Delta}})
+			}
+			if chunk.Sentence != "" {
+				t.addPending()
+				select {
+				case s.sentences <- sentenceItem{turn: t, text: chunk.Sentence, emotion: chunk.Emotion}:
+				case <-s.ctx.Done():
+				}
+			}
+		}
+		log.Printf("大模型返回给前端的内容: %v", answer.String())
+		if !t.canceled() {
+			s.send(Message{Type: TypeAnswerDone, Turn: t.id, Payload: AnswerPayload{Text: answer.String()}})
+		}
+		t.finishGenerating()
+		s.settle(t)
+	}
+}
+
+// synthesizeLoop 一句一句按顺序合成语音
+func (s *Session) synthesizeLoop() {
+	defer s.wg.Done()
+	for {
+		var item sentenceItem
+		select {
+		case item = <-s.sentences:
+		case <-s.ctx.Done():
+			return
+		}
+		t := item.turn
+		// 已被打断的轮次不再合成
+		if t.canceled() {
+			t.doneSynthesizing()
+			continue
+		}
+		emotion := tts.Emotion{Category: item.emotion.Category, Intensity: item.emotion.Intensity}
+		audio, err := s.TTS.Synthesize(s.m.synth, item.text, "", emotion)
+		if err != nil {
+			log.Printf("TTS转换失败: %v", err)
+			t.dropPending()
+		} else {
+			if t.startSpeaking() {
+				s.send(Message{Type: TypeState, Turn: t.id, Payload: StatePayload{State: StateSpeaking}})
+			}
+			s.recorder.WriteAssistant(t.id, audio)
+			s.outbox.push(outbound{audio: &audioItem{sentenceItem: item, audio: audio}})
+		}
+		t.doneSynthesizing()
+		s.settle(t)
+	}
+}
+
+// close 结束会话, 等协程退出后关闭历史记录和录音
+func (s *Session) close() {
+	s.cancel()
+	s.wg.Wait()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.idle != nil {
+		s.idle.Stop()
+	}
+	if s.historyLog != nil {
+		s.historyLog.Close()
+		s.historyLog = nil
+	}
+	s.recorder.Close(s.turns + 1)
+	log.Printf("会话 %s 已关闭", s.ID)
+}
+
+// outbound 一条发给前端的消息, message 和 audio 只有一个不为空
+type outbound struct {
+	message *Message
+	audio   *audioItem
+	// 音频说明已经在这个连接上发出, 音频还没发出
+	metaSent *encoder
+}
+
+// outbox 还没发给前端的消息, 断线期间一直保留, 重连后按顺序补发
+type outbox struct {
+	limit int
+	mu    sync.Mutex
+	items []outbound
+	// 有新消息时通知发送协程
+	ready chan struct{}
+}
+
+func newOutbox(limit int) *outbox {
+	return &outbox{limit: limit, ready: make(chan struct{}, 1)}
+}
+
+func (o *outbox) push(item outbound) {
+	o.mu.Lock()
+	if len(o.items) >= o.limit {
+		log.Printf("待发送消息超过 %d 条, 丢弃最早的一条", o.limit)
+		o.items = o.items[1:]
+	}
+	o.items = append(o.items, item)
+	o.mu.Unlock()
+	o.notify()
+}
+
+// pop 取出最早的一条消息
+func (o *outbox) pop() (outbound, bool) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if len(o.items) == 0 {
+		return outbound{}, false
+	}
+	item := o.items[0]
+	o.items = o.items[1:]
+	return item, true
+}
+
+// unpop 发送失败时放回队首, 重连后再发
+func (o *outbox) unpop(item outbound) {
+	o.mu.Lock()
+	o.items = append([]outbound{item}, o.items...)
+	o.mu.Unlock()
+}
+
+func (o *outbox) notify() {
+	select {
+	case o.ready <- struct{}{}:
+	default:
+	}
+}
@@ -0,0 +1,207 @@
+package link
+
+import (
+	"encoding/json"
+	"main/LLM/llm/roleModel"
+	"main/asr"
+	"main/history"
+	"main/tts"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/gorilla/websocket"
+	ark "github.com/sashabaranov/go-openai"
+)
+
+// initSession 协商协议后发 init, 返回后端回复的 session 消息, 切换会话失败时返回 error 消息
+func initSession(t *testing.T, conn *websocket.Conn, session, token string) (SessionPayload, ErrorPayload) {
+	t.Helper()
+	sendEnvelope(t, conn, TypeHello, HelloPayload{Versions: []int{1}})
+	sendEnvelope(t, conn, TypeInit, map[string]string{"session": session, "token": token})
+	var got SessionPayload
+	var failed ErrorPayload
+	readUntil(t, conn, func(env Envelope, binary []byte) bool {
+		switch env.Type {
+		case TypeError:
+			json.Unmarshal(env.Payload, &failed)
+			return failed.Code == ErrSession
+		case TypeSession:
+			json.Unmarshal(env.Payload, &got)
+			return true
+		}
+		return false
+	})
+	return got, failed
+}
+
+// waitError 等后端发来指定的错误
+func waitError(t *testing.T, conn *websocket.Conn, code string) {
+	t.Helper()
+	readUntil(t, conn, func(env Envelope, binary []byte) bool {
+		if env.Type != TypeError {
+			return false
+		}
+		var p ErrorPayload
+		json.Unmarshal(env.Payload, &p)
+		return p.Code == code
+	})
+}
+
+func TestAttachNeedsToken(t *testing.T) {
+	addr := serve(t, asr.NewScriptedRecognizer(), nil)
+	owner := dial(t, addr, "")
+	first, _ := initSession(t, owner, "", "")
+	if first.ID == "" || first.Token == "" || first.Token == first.ID {
+		t.Fatalf("应发给前端和会话 id 不同的令牌: %+v", first)
+	}
+
+	// 只知道会话 id 接不上
+	other := dial(t, addr, "session="+first.ID)
+	got, failed := initSession(t, other, first.ID, "guess")
+	if failed.Code != ErrSession || got.ID != "" {
+		t.Fatalf("令牌不对时不能接管会话: %+v %+v", got, failed)
+	}
+
+	// 带着令牌的新连接接管会话, 旧连接收到 taken_over 后断开
+	query := url.Values{"session": {first.ID}, "token": {first.Token}}.Encode()
+	again := dial(t, addr, query)
+	got, failed = initSession(t, again, first.ID, first.Token)
+	if got.ID != first.ID || !got.Resumed || failed.Code != "" {
+		t.Fatalf("带着令牌应接着原来的会话: %+v %+v", got, failed)
+	}
+	waitError(t, owner, ErrTakenOver)
+}
+
+func TestResumeHistoryNeedsToken(t *testing.T) {
+	histories, err := history.NewStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := serve(t, asr.NewScriptedRecognizer(), histories)
+	conn := dial(t, addr, "")
+	first, _ := initSession(t, conn, "", "")
+	// 没有等待重连的时间, 断开后会话只剩历史记录
+	conn.Close()
+
+	_, failed := initSession(t, dial(t, addr, ""), first.ID, "")
+	if failed.Code != ErrSession {
+		t.Errorf("没带令牌不能接着历史记录里的会话: %+v", failed)
+	}
+
+	got, failed := initSession(t, dial(t, addr, ""), first.ID, first.Token)
+	if got.ID != first.ID || got.Token != first.Token || failed.Code != "" {
+		t.Errorf("带着令牌应接着原来的会话, 令牌不变: %+v %+v", got, failed)
+	}
+}
+
+func TestResumeLegacyHistory(t *testing.T) {
+	histories, err := history.NewStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 早期的历史记录没有令牌
+	l, err := histories.Create("legacy", "", roleModel.Neko.ID, []ark.ChatCompletionMessage{{Role: ark.ChatMessageRoleSystem, Content: "你是猫娘"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	l.Close()
+	addr := serve(t, asr.NewScriptedRecognizer(), histories)
+
+	conn := dial(t, addr, "")
+	first, failed := initSession(t, conn, "legacy", "")
+	if first.ID != "legacy" || first.Token == "" || failed.Code != "" {
+		t.Fatalf("没有令牌的记录应发一个新令牌: %+v %+v", first, failed)
+	}
+	conn.Close()
+	if stored, err := histories.Token("legacy"); err != nil || stored != first.Token {
+		t.Fatalf("发出的令牌应写回历史记录, 得到 %q, %v", stored, err)
+	}
+
+	// 之后只有拿着这个令牌才能接着
+	if _, failed := initSession(t, dial(t, addr, ""), "legacy", ""); failed.Code != ErrSession {
+		t.Errorf("补发令牌后没带令牌不能接着: %+v", failed)
+	}
+	got, failed := initSession(t, dial(t, addr, ""), "legacy", first.Token)
+	if got.ID != "legacy" || got.Token != first.Token || failed.Code != "" {
+		t.Errorf("带着补发的令牌应接着原来的会话: %+v %+v", got, failed)
+	}
+}
+
+// voiceSynth 离线合成, 记下每句话用的音色
+type voiceSynth struct {
+	*tts.ToneSynthesizer
+	mu     sync.Mutex
+	voices map[string]string
+}
+
+func (s *voiceSynth) Synthesize(req tts.Request) (*tts.Audio, error) {
+	s.mu.Lock()
+	s.voices[req.Text] = req.Voice
+	s.mu.Unlock()
+	return s.ToneSynthesizer.Synthesize(req)
+}
+
+// voiceOf 合成 text 时用的音色
+func (s *voiceSynth) voiceOf(text string) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.voices[text]
+}
+
+// ask 说一句话, 等回答的语音发完
+func ask(t *testing.T, conn *websocket.Conn, recognizer *asr.ScriptedRecognizer) {
+	t.Helper()
+	for sent := 0; sent < recognizer.BytesPerUtterance; sent += 3200 {
+		if err := conn.WriteMessage(websocket.BinaryMessage, make([]byte, 3200)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	answered := false
+	readUntil(t, conn, func(env Envelope, binary []byte) bool {
+		if env.Type == TypeAnswerDone {
+			var p AnswerPayload
+			json.Unmarshal(env.Payload, &p)
+			answered = strings.HasPrefix(p.Text, "你说的是")
+		}
+		return answered && binary != nil
+	})
+}
+
+func TestVoiceCommand(t *testing.T) {
+	histories, err := history.NewStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	recognizer := asr.NewScriptedRecognizer("你好")
+	synth := &voiceSynth{ToneSynthesizer: tts.NewToneSynthesizer(), voices: map[string]string{}}
+	addr := serveWith(t, recognizer, synth, histories)
+
+	conn := dial(t, addr, "")
+	first, _ := initSession(t, conn, "", "")
+	sendEnvelope(t, conn, TypeVoice, map[string]string{"voice": "不存在的音色"})
+	waitError(t, conn, ErrVoice)
+
+	// 按名称切换, 之后的回答使用新音色
+	sendEnvelope(t, conn, TypeVoice, map[string]string{"voice": "标准男声"})
+	ask(t, conn, recognizer)
+	if got := synth.voiceOf("你说的是: 你好"); got != "标准男声" {
+		t.Fatalf("切换后的回答使用 %q", got)
+	}
+	conn.Close()
+
+	// 断线后只剩历史记录, 接着会话时仍是切换后的音色
+	synth.mu.Lock()
+	clear(synth.voices)
+	synth.mu.Unlock()
+	again := dial(t, addr, "")
+	got, failed := initSession(t, again, first.ID, first.Token)
+	if got.ID != first.ID || failed.Code != "" {
+		t.Fatalf("应接着原来的会话: %+v %+v", got, failed)
+	}
+	ask(t, again, recognizer)
+	if got := synth.voiceOf("你说的是: 你好"); got != "标准男声" {
+		t.Errorf("接着会话后的回答使用 %q, 音色应保持不变", got)
+	}
+}
@@ -0,0 +1,162 @@
+package link
+
+import (
+	"context"
+	"main/LLM"
+	"main/tts"
+	"strings"
+	"sync"
+	"time"
+)
+
+// turn 一轮问答, 从把问题交给大模型开始, 到最后一段音频播放完为止
+type turn struct {
+	id     int64 // 会话内从 1 开始递增, 发给前端的消息带上它
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	mu          sync.Mutex
+	reply       *LLM.Reply
+	generating  bool
+	pending     int // 已经交给合成但还没发出的句子数
+	added       int // 交给合成的句子总数
+	synthesized int // 已经合成完(包括失败和跳过)的句子数
+	speaking    bool
+	settled     bool // 已经通知前端本轮结束
+	sentences   []playedSentence
+	playbackEnd time.Time // 按已发送音频的时长估算的前端播放结束时间
+}
+
+// sentenceItem 等待合成的一句话
+type sentenceItem struct {
+	turn    *turn
+	text    string
+	emotion LLM.Emotion
+}
+
+// audioItem 合成好等待发送的一句话
+type audioItem struct {
+	sentenceItem
+	audio *tts.Audio
+}
+
+// playedSentence 已经发给前端的一句话和估算的开始播放时间
+type playedSentence struct {
+	text  string
+	start time.Time
+}
+
+func newTurn(parent context.Context, id int64) *turn {
+	ctx, cancel := context.WithCancel(parent)
+	return &turn{id: id, ctx: ctx, cancel: cancel, generating: true}
+}
+
+func (t *turn) canceled() bool {
+	return t.ctx.Err() != nil
+}
+
+func (t *turn) setReply(reply *LLM.Reply) {
+	t.mu.Lock()
+	t.reply = reply
+	t.mu.Unlock()
+}
+
+func (t *turn) finishGenerating() {
+	t.mu.Lock()
+	t.generating = false
+	t.mu.Unlock()
+}
+
+// active 还在生成或合成回答, 或者前端还在播放
+func (t *turn) active(now time.Time) bool {
+	if t.canceled() {
+		return false
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.generating || t.pending > 0 || now.Before(t.playbackEnd)
+}
+
+// addPending 一句话交给合成
+func (t *turn) addPending() {
+	t.mu.Lock()
+	t.pending++
+	t.added++
+	t.mu.Unlock()
+}
+
+// dropPending 一句话合成失败, 不会再发出
+func (t *turn) dropPending() {
+	t.mu.Lock()
+	t.pending--
+	t.mu.Unlock()
+}
+
+// startSpeaking 第一段音频交给前端时返回 true
+func (t *turn) startSpeaking() bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	first := !t.speaking
+	t.speaking = true
+	return first
+}
+
+// doneSynthesizing 一句话合成完(包括失败和跳过)
+func (t *turn) doneSynthesizing() {
+	t.mu.Lock()
+	t.synthesized++
+	t.mu.Unlock()
+}
+
+// settle 回答生成完且每句都合成完时返回 true, 每轮只返回一次
+func (t *turn) settle() bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.settled || t.generating || t.synthesized < t.added {
+		return false
+	}
+	t.settled = true
+	return true
+}
+
+// settleNow 被打断时立即结束本轮, 之前没有结束过时返回 true
+func (t *turn) settleNow() bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	first := !t.settled
+	t.settled = true
+	return first
+}
+
+// markSent 一句话的音频已经发出, 前端按顺序播放, 排在前一句后面
+func (t *turn) markSent(sentence string, duration time.Duration, now time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.pending--
+	start := now
+	if t.playbackEnd.After(now) {
+		start = t.playbackEnd
+	}
+	t.sentences = append(t.sentences, playedSentence{text: sentence, start: start})
+	t.playbackEnd = start.Add(duration)
+}
+
+// interrupt 打断本轮, 返回实际已经开始播放的内容
+// 历史记录里的回答会被替换为这部分内容
+func (t *turn) interrupt(now time.Time) string {
+	t.cancel()
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	var spoken strings.Builder
+	for _, s := range t.sentences {
+		if s.start.After(now) {
+			break
+		}
+		spoken.WriteString(s.text)
+	}
+	t.playbackEnd = now
+	if t.reply != nil {
+		t.reply.Truncate(spoken.String())
+	}
+	return spoken.String()
+}
@@ -2,9 +2,14 @@ package link
 
 import (
 	"context"
-	"encoding/json"
+	"errors"
+	"fmt"
 	"main/LLM"
+	"main/LLM/llm/roleModel"
 	"main/asr"
+	"main/audio"
+	"main/history"
+	"main/recording"
 	"main/tts"
 	"sync"
 
@@ -27,8 +32,27 @@ var upgrader = websocket.Upgrader{
 	},
 }
 
+// Options 会话相关配置
+type Options struct {
+	SilenceTimeout time.Duration  // 静音超时时间, VAD 漏判时兜底
+	VAD            *asr.VADConfig // 服务端语音活动检测, nil 表示不启用
+	DefaultPersona string         // init 没有指定角色时使用的角色 id
+	ResumeGrace    time.Duration  // 断线后会话保留多久等待重连, 0 表示断线即结束
+	LLM            LLM.Options    // 每个会话的大模型上下文的设置
+}
+
+const (
+	// VAD 判定说完后再等识别结果稳定一小段时间
+	asrSettle = 150 * time.Millisecond
+	// 最后一句迟迟没有最终结果时, 最多等这么久就用中间结果
+	asrFinalWait = 800 * time.Millisecond
+)
+
 // HandleWebSocket 处理前端WebSocket连接
-func HandleWebSocket(asrClient *asr.ASRClient) http.HandlerFunc {
+// 大模型上下文、语音合成设置和待发送的消息保存在服务端会话里, 断线重连后接着使用;
+// 语音识别和 VAD 跟着连接走, 每条连接重新开始
+func HandleWebSocket(recognizer asr.Recognizer, synth tts.Synthesizer, providers *LLM.Providers, personas *roleModel.Store, histories *history.Store, recordings *recording.Store, opts Options) http.HandlerFunc {
+	sessions := newSessions(synth, providers, personas, histories, recordings, opts)
 
 	return func(w http.ResponseWriter, r *http.Request) {
 
@@ -43,42 +67,107 @@ func HandleWebSocket(asrClient *asr.ASRClient) http.HandlerFunc {
 			wsConn.Close()
 		}()
 
-		audioChan := make(chan []byte, 100)
-		resultChan := make(chan string, 10)
-		answerChan := make(chan string, 10)
-		llmChan := make(chan string, 10)
-		returnChan := make(chan string, 10)
-
 		ctx, cancel := context.WithCancel(context.Background())
 		defer cancel()
+		conn := &connection{kick: cancel}
+
+		// 先接入会话, URL 里可以用 ?session=&token= 指定; 前端在 init 里带上别的会话 id 时再切换过去
+		query := r.URL.Query()
+		sess, resumed, err := sessions.attach(query.Get("session"), query.Get("token"), conn)
+		if errors.Is(err, errSessionToken) {
+			// 令牌不对时先用新会话, init 里再切换会告诉前端原因
+			log.Printf("会话 %s 的令牌不对, 使用新的会话", query.Get("session"))
+			sess, resumed, err = sessions.attach("", "", conn)
+		}
+		if err != nil {
+			log.Printf("创建会话失败: %v", err)
+			return
+		}
+		if resumed {
+			sess.outbox.notify()
+		}
+		// 收到 hangup 后会话直接结束, 否则保留一段时间等待重连
+		var hangup bool
+		defer func() {
+			if hangup {
+				sessions.remove(sess)
+			} else {
+				sessions.detach(sess, conn)
+			}
+		}()
+
+		audioChan := make(chan []byte, 100)
+		resultChan := make(chan asr.Result, 10)
+		returnChan := make(chan Message, 10)
+
 		// 使用 WaitGroup 等待所有协程退
 		var wg sync.WaitGroup
 
-		// 缓存识别结果和静音判断变量
-		var partialResults []string
+		// 缓存识别结果和静音判断变量, 多句识别结果按序号拼成一整段话
+		utterance := asr.NewUtterance()
 		var lastAudioTime time.Time
 		// 记录最后一次发送给 LLM 的时间, 避免手动发送后又静音发送导致多次发送
 		var lastTTSTime time.Time
-		// 地理信息
+		// 保护上面的识别状态和 sess, sess 只在处理消息的循环里修改
 		var mu sync.Mutex
-		const silenceTimeout = 5 * time.Second // 静音超时时间
+		silenceTimeout := opts.SilenceTimeout
+		// VAD 状态, 未启用时用识别结果判断插话
+		var vad *asr.VAD
+		if opts.VAD != nil {
+			vad = asr.NewVAD(*opts.VAD)
+		}
+		var speaking bool
+		var lastSpeechEnd time.Time
 
+		// 把拼好的整段话交给大模型, 调用时需持有 mu
+		commitUtterance := func(reason string) {
+			text := utterance.Commit()
+			if text == "" {
+				return
+			}
+			log.Printf("%s，准备调用大模型: %s", reason, text)
+			sess.ask(text)
+			lastTTSTime = time.Now()
+		}
+
+		wg.Add(1)
 		go func() {
-			for val := range resultChan {
-				// 处理未识别到信息的情况
-				if val == "" {
-					continue
+			defer wg.Done()
+			for {
+				var result asr.Result
+				select {
+				case result = <-resultChan:
+				case <-ctx.Done():
+					return
 				}
 				// 缓存识别结果
 				mu.Lock()
-				partialResults = append(partialResults, val)
+				if !utterance.Add(result) {
+					// 这句话已经交给大模型, 迟到的识别结果不再计入
+					mu.Unlock()
+					continue
+				}
+				// 处理未识别到信息的情况
+				if result.Text == "" {
+					mu.Unlock()
+					continue
+				}
 				lastAudioTime = time.Now()
+				s := sess
 				mu.Unlock()
-				// 实时信息发送到前端
-				returnChan <- val
+				// 助手还在说话时用户开口, 打断本轮回答; 启用 VAD 时由 VAD 判断
+				if vad == nil {
+					if t := s.activeTurn(time.Now()); t != nil {
+						s.interrupt(t)
+					}
+				}
+				// 实时信息发送到前端, 中间结果和一句话的最终结果分开
+				select {
+				case returnChan <- Message{Type: TypeTranscript, Payload: TranscriptPayload{Text: result.Text, Final: result.Final}}:
+				case <-ctx.Done():
+					return
+				}
 			}
-			close(llmChan)
-			close(returnChan)
 		}()
 
 		// 定时检测静音并触发大模型处理
@@ -86,7 +175,7 @@ func HandleWebSocket(asrClient *asr.ASRClient) http.HandlerFunc {
 		go func() {
 			defer wg.Done()
 			var lastCheckTime time.Time
-			ticker := time.NewTicker(200 * time.Millisecond)
+			ticker := time.NewTicker(100 * time.Millisecond)
 			defer ticker.Stop()
 
 			for {
@@ -95,18 +184,21 @@ func HandleWebSocket(asrClient *asr.ASRClient) http.HandlerFunc {
 					mu.Lock()
 					elapsed := time.Since(lastAudioTime)
 					currentTime := time.Now()
-					// 暂时只做了5秒静音检测, 不可手动退出
+					// VAD 判定说完, 且每句都拿到了最终结果
+					if vad != nil && !speaking &&
+						lastSpeechEnd.After(lastTTSTime) &&
+						!utterance.Empty() &&
+						(elapsed > asrSettle && !utterance.Pending() || elapsed > asrFinalWait) {
+						commitUtterance("VAD检测到说话结束")
+						lastCheckTime = currentTime
+					}
+					// 静音超时兜底, 不可手动退出
 					if elapsed > silenceTimeout &&
 						currentTime.Sub(lastCheckTime) > silenceTimeout &&
-						lastAudioTime.After(lastTTSTime) {
-						if len(partialResults) > 0 {
-							endText := partialResults[len(partialResults)-1]
-							log.Printf("检测到静音，准备调用大模型: %s", endText)
-							llmChan <- endText
-							lastTTSTime = time.Now()
-							partialResults = nil // 清空缓存
-							lastCheckTime = currentTime
-						}
+						lastAudioTime.After(lastTTSTime) &&
+						!utterance.Empty() {
+						commitUtterance("检测到静音")
+						lastCheckTime = currentTime
 					}
 					mu.Unlock()
 
@@ -116,180 +208,333 @@ func HandleWebSocket(asrClient *asr.ASRClient) http.HandlerFunc {
 			}
 		}()
 
-		// 初始化llmCtx, 传参在最下面的协程里
-		llmCtx := LLM.NewLLMContext("你是一个一个猫娘", "请在每句话结尾加上'喵~'")
-		// 处理 LLM 回复
+		// 启动ASR流式处理, 出错时交给处理消息的循环告诉前端
+		asrErrChan := make(chan error, 1)
 		wg.Add(1)
-		answerTextChan := make(chan string, 10)
 		go func() {
 			defer wg.Done()
-			defer close(answerTextChan)
-			for question := range llmChan {
-				responseChan := llmCtx.Ask(question)
-				for answer := range responseChan {
-					answerChan <- answer
-					answerTextChan <- answer
-				}
+			if err := recognizer.Recognize(ctx, audioChan, resultChan); err != nil {
+				log.Printf("ASR处理失败: %v", err)
+				asrErrChan <- err
 			}
 		}()
 
-		// 启动ASR流式处理
-		wg.Add(1)
+		// 读取前端消息, 单独一个协程, 避免没有消息时阻塞回复的发送
+		// 连接关闭后 ReadMessage 返回错误, 协程随之退出
+		inboundChan := make(chan inboundMessage, 100)
 		go func() {
-			defer wg.Done()
-			defer close(audioChan)
-			if err := asrClient.StartWebSocketStream(ctx, audioChan, resultChan); err != nil {
-				log.Printf("ASR处理失败: %v", err)
-				wsConn.Close()
+			defer close(inboundChan)
+			for {
+				messageType, msg, err := wsConn.ReadMessage()
+				if err != nil {
+					log.Printf("读取消息失败: %v", err)
+					return
+				}
+				select {
+				case inboundChan <- inboundMessage{messageType: messageType, data: msg}:
+				case <-ctx.Done():
+					return
+				}
 			}
 		}()
 
-		TTSCfg := tts.InitTTSConfig()
+		// 没发 hello 之前按第 0 版发送
+		enc := newEncoder(wsConn)
+		// init 说明格式之前按识别用的格式处理麦克风音频
+		var input audio.InputStream = audio.NewInputConverter(audio.RecognizerFormat)
+		inputFailed := false
+		// input 的后台解码输出, 关闭后置为 nil
+		inputOutput := input.Output()
 
-		//处理 TTS 请求
-		returnAudioChan := make(chan []byte, 100)
-		wg.Add(1)
-		go func() {
-			defer wg.Done()
-			for answer := range answerChan {
-				//log.Printf("开始TTS转换: %s", answer)
-
-				// 调用TTS函数生成音频数据
-				audioData, err := TTSCfg.GetTTSRBytes(answer, "")
-				if err != nil {
-					log.Printf("TTS转换失败: %v", err)
+		// flush 按顺序发送会话里待发送的消息, 发送失败的消息放回去, 重连后再发
+		flush := func(s *Session) error {
+			for ctx.Err() == nil {
+				item, ok := s.outbox.pop()
+				if !ok {
+					return nil
+				}
+				if item.audio == nil {
+					if err := enc.send(*item.message); err != nil {
+						s.outbox.unpop(item)
+						return err
+					}
+					continue
+				}
+				if item.audio.turn.canceled() {
 					continue
 				}
-				returnAudioChan <- audioData
+				// 将TTS生成的音频数据返回给前端
+				log.Printf("发送TTS音频数据，长度: %d 字节", len(item.audio.audio.Data))
+				if err := enc.sendAudio(&item); err != nil {
+					s.outbox.unpop(item)
+					return err
+				}
+				item.audio.turn.markSent(item.audio.text, item.audio.audio.Duration(), time.Now())
 			}
-		}()
+			return ctx.Err()
+		}
+
+		// setInput 按 init 里说明的格式处理之后的麦克风音频, 格式没变时接着用原来的音频流
+		// 压缩格式是连续的流, 换格式或解码出错后前端要从头开始发
+		setInput := func(requested *audio.InputFormat) error {
+			if requested == nil {
+				return nil
+			}
+			format, err := requested.Normalize()
+			if err != nil {
+				return err
+			}
+			if format == input.Format() && !inputFailed {
+				return nil
+			}
+			next, err := audio.NewInputStream(format)
+			if err != nil {
+				return err
+			}
+			input.Close()
+			input, inputFailed, inputOutput = next, false, next.Output()
+			log.Printf("会话 %s 的输入音频格式: %s %dHz %d声道", sess.ID, format.Encoding, format.SampleRate, format.Channels)
+			return nil
+		}
+
+		// inputError 音频流出错后不再处理, 直到前端在 init 里重新说明格式, 只告诉前端一次
+		inputError := func(err error) error {
+			if inputFailed {
+				return nil
+			}
+			inputFailed = true
+			log.Printf("处理麦克风音频失败: %v", err)
+			code := ErrInputFormat
+			if errors.Is(err, audio.ErrInputOverflow) {
+				code = ErrInputOverflow
+			}
+			return enc.sendError(code, err.Error())
+		}
+
+		// handleAudio 处理转换成 16k 单声道 16 位 PCM 之后的麦克风音频, 只在处理消息的循环里调用
+		handleAudio := func(pcm []byte) {
+			sess.recordMic(pcm)
+			//log.Printf("收到前端发送的音频数据，长度: %d 字节", len(pcm))
+			select {
+			case audioChan <- pcm:
+			default:
+				log.Printf("audioChan 满，丢弃音频包")
+			}
+			if vad != nil {
+				for _, event := range vad.Process(pcm) {
+					mu.Lock()
+					switch event {
+					case asr.SpeechStart:
+						speaking = true
+					case asr.SpeechEnd:
+						speaking = false
+						lastSpeechEnd = time.Now()
+					}
+					mu.Unlock()
+					// 助手还在说话时用户开口, 打断本轮回答
+					if event == asr.SpeechStart {
+						if t := sess.activeTurn(time.Now()); t != nil {
+							sess.interrupt(t)
+						}
+					}
+				}
+			}
+		}
 
 		// 处理WebSocket消息, 重要核心
-		wg.Add(1)
-		go func() {
-			defer wg.Done()
-			for {
-				select {
-				case answer := <-answerTextChan:
-					// 将大模型返回结果返回给前端
-					//日志检测内容
-					log.Printf("大模型返回给前端的内容: %v", answer)
-					if err := wsConn.WriteJSON(map[string]string{
-						"answer": answer,
-					}); err != nil {
-						log.Printf("发送结果失败: %v", err)
-						return
+	loop:
+		for {
+			select {
+			case <-ctx.Done():
+				// 会话被带着令牌的新连接接管, 告诉前端不要再自动重连抢回来
+				if err := enc.sendError(ErrTakenOver, "会话已在别的连接上继续"); err != nil {
+					log.Printf("发送错误失败: %v", err)
+				}
+				break loop
+			case <-sess.outbox.ready:
+				if err := flush(sess); err != nil {
+					log.Printf("发送结果失败: %v", err)
+					break loop
+				}
+			case err := <-asrErrChan:
+				// 没有识别就没法对话, 告诉前端后断开, 会话保留, 前端重连后接着聊
+				if err := enc.sendError(ErrASR, "语音识别失败: "+err.Error()); err != nil {
+					log.Printf("发送错误失败: %v", err)
+				}
+				break loop
+			case pcm, ok := <-inputOutput:
+				if !ok {
+					// 解码在前端结束之前就退出了
+					inputOutput = nil
+					if err := inputError(input.Err()); err != nil {
+						break loop
 					}
-				case asrReturn := <-returnChan:
-					// 将识别结果返回给前端
-					//日志检测内容
-					log.Printf("识别内容返回给前端: %v", asrReturn)
-					if err := wsConn.WriteJSON(map[string]string{
-						"asrReturn": asrReturn,
-					}); err != nil {
-						log.Printf("发送结果失败: %v", err)
-						return
+					continue
+				}
+				handleAudio(pcm)
+			case asrReturn := <-returnChan:
+				// 将识别结果返回给前端
+				//日志检测内容
+				log.Printf("识别内容返回给前端: %v", asrReturn.Payload)
+				if err := enc.send(asrReturn); err != nil {
+					log.Printf("发送结果失败: %v", err)
+					break loop
+				}
+				// 读取前端发送的音频数据
+			case in, ok := <-inboundChan:
+				if !ok {
+					// 前端断开, 会话保留一段时间, 重连时带上会话 id 接着聊
+					break loop
+				}
+				messageType, msg := in.messageType, in.data
+				if messageType == websocket.BinaryMessage {
+					// 语音识别、VAD 和录音都按 16k 单声道 16 位 PCM 处理, 压缩格式在后台解码, 从 input.Output() 取
+					if inputFailed {
+						continue
 					}
-				case audioData := <-returnAudioChan:
-					// 将TTS生成的音频数据返回给前端
-					log.Printf("发送TTS音频数据，长度: %d 字节", len(audioData))
-					if err := wsConn.WriteMessage(websocket.BinaryMessage, audioData); err != nil {
-						log.Printf("发送音频数据失败: %v", err)
-						return
+					pcm, err := input.Write(msg)
+					if err != nil {
+						if err := inputError(err); err != nil {
+							break loop
+						}
+						continue
 					}
-					// 读取前端发送的音频数据
-				default:
-					messageType, msg, err := wsConn.ReadMessage()
+					if len(pcm) > 0 {
+						handleAudio(pcm)
+					}
+					continue
+				}
+
+				// 文本消息：尝试解析 JSON 控制指令
+				cmd, err := decodeCommand(msg)
+				if err != nil {
+					log.Printf("无法解析JSON消息: %v, 原文: %s", err, string(msg))
+					if err := enc.sendError(ErrBadMessage, err.Error()); err != nil {
+						break loop
+					}
+					continue
+				}
+
+				switch cmd.Type {
+				case TypeHello:
+					// 协商协议版本, 之后的消息都按选定的版本发送
+					version, capabilities, ok := negotiate(cmd)
+					if !ok {
+						log.Printf("前端支持的协议版本 %v 都不支持, 继续使用第 %d 版", cmd.Versions, enc.version)
+						if err := enc.sendError(ErrUnsupportedVersion, fmt.Sprintf("支持的协议版本为 1 到 %d", ProtocolVersion)); err != nil {
+							break loop
+						}
+						continue
+					}
+					enc.upgrade(version, capabilities)
+					log.Printf("使用第 %d 版协议, 能力: %v", version, capabilities)
+					if err := enc.send(Message{Type: TypeHello, Payload: HelloPayload{Version: version, Capabilities: capabilities}}); err != nil {
+						break loop
+					}
+				case TypeInit:
+					// 带着别的会话 id 时切换过去, 断线重连就是这样接上原来的会话
+					if cmd.Session != "" && cmd.Session != sess.ID {
+						next, _, err := sessions.attach(cmd.Session, cmd.Token, conn)
+						if err != nil {
+							log.Printf("切换会话失败: %v", err)
+							if err := enc.sendError(ErrSession, err.Error()); err != nil {
+								break loop
+							}
+							continue
+						}
+						sessions.detach(sess, conn)
+						mu.Lock()
+						sess = next
+						mu.Unlock()
+					}
+					// 前端可以选择音频格式, 不支持时告诉前端并继续使用原来的格式
+					output, err := sess.setOutput(cmd.Audio)
 					if err != nil {
-						log.Printf("读取消息失败: %v", err)
-						//cancel() // 前端WebSocket关闭时，取消上下文有Bug, 因为没写重新连接
-						return
+						log.Printf("切换音频格式失败: %v", err)
+						if err := enc.sendError(ErrAudioFormat, err.Error()); err != nil {
+							break loop
+						}
 					}
-					if messageType == websocket.BinaryMessage {
-						//写入wav文件
-						//if err := asr.WritePCMToWAVFile(msg); err != nil {
-						//	log.Printf("写入WAV失败: %v", err)
-						//}
-						//log.Printf("收到前端发送的音频数据，长度: %d 字节", len(msg))
-						select {
-						case audioChan <- msg: // 仅转发二进制消息
-						default:
-							log.Printf("audioChan 满，丢弃音频包")
+					// 麦克风音频的格式跟着连接走, 重连后前端在 init 里再说明一次
+					if err := setInput(cmd.Input); err != nil {
+						log.Printf("切换输入音频格式失败: %v", err)
+						if err := enc.sendError(ErrInputFormat, err.Error()); err != nil {
+							break loop
 						}
+					}
+					// 初始化或更新 LLM 上下文
+					greeting, resumed := sess.start(cmd)
+					mu.Lock()
+					utterance.Reset()
+					lastAudioTime = time.Now()
+					mu.Unlock()
+					// 告诉前端会话 id, 重连时带上它就能接着聊
+					if err := enc.send(Message{Type: TypeSession, Payload: SessionPayload{ID: sess.ID, Token: sess.token, Resumed: resumed, Audio: output, Input: input.Format()}}); err != nil {
+						log.Printf("发送会话 id 失败: %v", err)
+						break loop
+					}
+					if resumed {
+						// 补发断线期间没发出去的回答和音频
+						sess.outbox.notify()
+					}
+					if greeting != "" {
+						sess.greet(greeting)
+					}
+				case TypeHangup:
+					log.Println("收到 hangup 消息，结束会话")
+					hangup = true
+					break loop
+				case TypeGo: // 手动触发：立即使用当前缓存的识别结果调用 LLM
+					log.Println("收到 go 消息，手动触发大模型调用")
+					mu.Lock()
+					if !utterance.Empty() {
+						commitUtterance("立即调用")
 					} else {
-						// 文本消息：尝试解析 JSON 控制指令
-						var cmd cmd
-						if err := json.Unmarshal(msg, &cmd); err != nil {
-							log.Printf("无法解析JSON消息: %v, 原文: %s", err, string(msg))
-							continue
+						log.Println("无识别内容，跳过 LLM 调用")
+					}
+					mu.Unlock()
+				case TypeUp:
+					sess.TTS.AdjustVolume(true)
+					sess.saveVoice()
+				case TypeDown:
+					sess.TTS.AdjustVolume(false)
+					sess.saveVoice()
+				case TypeFast:
+					sess.TTS.AdjustSpeed(true)
+					sess.saveVoice()
+				case TypeLate:
+					sess.TTS.AdjustSpeed(false)
+					sess.saveVoice()
+				case TypeVoice:
+					if err := sess.setVoice(cmd.Voice); err != nil {
+						log.Printf("切换音色失败: %v", err)
+						if err := enc.sendError(ErrVoice, err.Error()); err != nil {
+							break loop
 						}
-
-						switch cmd.Type {
-						case "init":
-							// 初始化或更新 LLM 上下文
-							mu.Lock()
-							if cmd.System == "" {
-								cmd.System = "你是一个一个猫娘"
-							}
-							if cmd.User == "" {
-								cmd.User = "请在每句话结尾加上'喵~'"
-							}
-							llmCtx = LLM.NewLLMContext(cmd.System, cmd.User)
-							partialResults = nil
-							lastAudioTime = time.Now()
-							mu.Unlock()
-							log.Printf("已更新LLM上下文: system=%s, user=%s", cmd.System, cmd.User)
-						case "hangup":
-							log.Println("收到 hangup 消息，结束会话")
-							cancel()
-						case "go": // 手动触发：立即使用当前缓存的识别结果调用 LLM
-							log.Println("收到 go 消息，手动触发大模型调用")
-							mu.Lock()
-							if len(partialResults) > 0 {
-								endText := partialResults[len(partialResults)-1]
-								log.Printf("立即调用大模型: %s", endText)
-								llmChan <- endText
-								partialResults = nil // 清空缓存
-								lastTTSTime = time.Now()
-							} else {
-								log.Println("无识别内容，跳过 LLM 调用")
-							}
-							mu.Unlock()
-						case "up":
-							TTSCfg.AdjustVolume(true)
-						case "down":
-							TTSCfg.AdjustVolume(false)
-						case "fast":
-							TTSCfg.AdjustSpeed(true)
-						case "late":
-							TTSCfg.AdjustSpeed(false)
-						//case "updatalocation":
-						//	log.Println("收到 updateLocation 消息")
-						//	if cmd.Location != nil {
-						//		mu.Lock()
-						//		// 设置地理位置
-						//		location := Location{
-						//			Latitude:  cmd.Location.Latitude,
-						//			Longitude: cmd.Location.Longitude,
-						//			Accuracy:  cmd.Location.Accuracy,
-						//		}
-						//		log.Printf("地址为: %v", location)
-						//		// 拼接为字符串
-						//
-						//		mu.Unlock()
-						//	} else {
-						//
-						//		log.Printf("updateLocation 消息中缺少 Location 数据")
-						//	}
-						default:
-							log.Printf("未知控制消息类型: %s", cmd.Type)
+						continue
+					}
+					log.Printf("会话 %s 切换音色: %s", sess.ID, cmd.Voice)
+				case TypeUpdateLocation:
+					if cmd.Location == nil || !cmd.Location.valid() {
+						log.Printf("updateLocation 消息中的位置无效: %v", cmd.Location)
+						if err := enc.sendError(ErrBadMessage, "location 缺失或超出范围"); err != nil {
+							break loop
 						}
+						continue
+					}
+					log.Printf("用户位置: %+v", *cmd.Location)
+					sess.setLocation(*cmd.Location)
+				default:
+					log.Printf("未知控制消息类型: %s", cmd.Type)
+					if err := enc.sendError(ErrUnknownType, "未知的消息类型: "+cmd.Type); err != nil {
+						break loop
 					}
 				}
 			}
-		}()
+		}
 		//  等待所有协程退出
-		<-ctx.Done()
+		input.Close()
+		cancel()
 		wg.Wait()
 		log.Println("WebSocket处理已完成")
 	}
@@ -0,0 +1,196 @@
+package link
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"main/LLM"
+	"main/LLM/llm/LLMConfigs"
+	"main/LLM/llm/roleModel"
+	"main/asr"
+	"main/history"
+	"main/tts"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+// startPipeline 用假识别、假大模型和离线合成启动整条语音链路, 返回前端的连接
+func startPipeline(t *testing.T, recognizer asr.Recognizer) *websocket.Conn {
+	t.Helper()
+	return dial(t, serve(t, recognizer, nil), "")
+}
+
+// serve 启动后端, 返回 WebSocket 地址; histories 为 nil 时不保存历史记录
+func serve(t *testing.T, recognizer asr.Recognizer, histories *history.Store) string {
+	t.Helper()
+	return serveWith(t, recognizer, tts.NewToneSynthesizer(), histories)
+}
+
+// serveWith 和 serve 相同, 使用指定的合成后端
+func serveWith(t *testing.T, recognizer asr.Recognizer, synth tts.Synthesizer, histories *history.Store) string {
+	t.Helper()
+	personas, err := roleModel.NewStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	providers := LLM.NewProviders()
+	providers.Add("fake", LLMConfigs.NewScriptedProvider("fake"))
+	if err := providers.SetDefault("fake"); err != nil {
+		t.Fatal(err)
+	}
+	opts := Options{SilenceTimeout: 300 * time.Millisecond, DefaultPersona: roleModel.Neko.ID, LLM: LLM.DefaultOptions()}
+	server := httptest.NewServer(HandleWebSocket(recognizer, synth, providers, personas, histories, nil, opts))
+	t.Cleanup(server.Close)
+	return "ws" + strings.TrimPrefix(server.URL, "http") + "/asr-stream"
+}
+
+// dial 连上后端, query 为空时不带参数
+func dial(t *testing.T, url, query string) *websocket.Conn {
+	t.Helper()
+	if query != "" {
+		url += "?" + query
+	}
+	conn, _, err := websocket.DefaultDialer.Dial(url, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+// sendEnvelope 按第 1 版协议发一条消息
+func sendEnvelope(t *testing.T, conn *websocket.Conn, typ string, payload any) {
+	t.Helper()
+	data, err := json.Marshal(payload)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := conn.WriteJSON(Envelope{V: 1, Type: typ, Payload: data}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// readUntil 读取后端的消息, 直到 done 返回 true; 二进制帧的 typ 为空
+func readUntil(t *testing.T, conn *websocket.Conn, done func(env Envelope, binary []byte) bool) {
+	t.Helper()
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	for {
+		messageType, msg, err := conn.ReadMessage()
+		if err != nil {
+			t.Fatalf("读取消息失败: %v", err)
+		}
+		if messageType == websocket.BinaryMessage {
+			if done(Envelope{}, msg) {
+				return
+			}
+			continue
+		}
+		var env Envelope
+		if err := json.Unmarshal(msg, &env); err != nil {
+			t.Fatalf("消息不是信封: %s", msg)
+		}
+		if done(env, nil) {
+			return
+		}
+	}
+}
+
+func TestPipeline(t *testing.T) {
+	recognizer := asr.NewScriptedRecognizer("你好")
+	conn := startPipeline(t, recognizer)
+	sendEnvelope(t, conn, TypeHello, HelloPayload{Versions: []int{1}, Capabilities: []string{CapState, CapAudioMeta}})
+	sendEnvelope(t, conn, TypeInit, map[string]any{})
+
+	// 说一句话的音频, 假识别每收到这么多字节给出一句
+	for sent := 0; sent < recognizer.BytesPerUtterance; sent += 3200 {
+		if err := conn.WriteMessage(websocket.BinaryMessage, make([]byte, 3200)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var transcript string
+	var answer AnswerPayload
+	var meta AudioPayload
+	var audio []byte
+	readUntil(t, conn, func(env Envelope, binary []byte) bool {
+		switch {
+		case binary != nil:
+			// 回答之前的是开场白的音频
+			if answer.Text != "" {
+				audio = binary
+			}
+		case env.Type == TypeTranscript:
+			var p TranscriptPayload
+			json.Unmarshal(env.Payload, &p)
+			if p.Final {
+				transcript = p.Text
+			}
+		case env.Type == TypeAnswerDone:
+			var p AnswerPayload
+			json.Unmarshal(env.Payload, &p)
+			if strings.HasPrefix(p.Text, "你说的是") {
+				answer = p
+			}
+		case env.Type == TypeAudio && answer.Text != "":
+			json.Unmarshal(env.Payload, &meta)
+		}
+		return audio != nil
+	})
+
+	if transcript != "你好" {
+		t.Errorf("识别结果 %q, 应为 你好", transcript)
+	}
+	if answer.Text != "你说的是: 你好" {
+		t.Errorf("回答 %q", answer.Text)
+	}
+	if meta.Format != "wav" || meta.Bytes != len(audio) || meta.Text != answer.Text {
+		t.Errorf("音频说明 %+v 和音频 %d 字节不符", meta, len(audio))
+	}
+}
+
+// failingRecognizer 收到第一段音频就出错的识别后端
+type failingRecognizer struct{}
+
+func (failingRecognizer) Recognize(ctx context.Context, audioStream <-chan []byte, resultChan chan<- asr.Result) error {
+	select {
+	case <-audioStream:
+		return errors.New("鉴权失败")
+	case <-ctx.Done():
+		return nil
+	}
+}
+
+func TestPipelineASRError(t *testing.T) {
+	conn := startPipeline(t, failingRecognizer{})
+	sendEnvelope(t, conn, TypeHello, HelloPayload{Versions: []int{1}})
+	if err := conn.WriteMessage(websocket.BinaryMessage, make([]byte, 3200)); err != nil {
+		t.Fatal(err)
+	}
+
+	var got ErrorPayload
+	readUntil(t, conn, func(env Envelope, binary []byte) bool {
+		if env.Type == TypeError {
+			json.Unmarshal(env.Payload, &got)
+			return true
+		}
+		return false
+	})
+	if got.Code != ErrASR || !strings.Contains(got.Message, "鉴权失败") {
+		t.Errorf("应收到识别出错的消息, 得到 %+v", got)
+	}
+	// 之后连接断开
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	for {
+		if _, _, err := conn.ReadMessage(); err != nil {
+			if errors.Is(err, os.ErrDeadlineExceeded) {
+				t.Fatal("出错后连接应被后端关闭")
+			}
+			break
+		}
+	}
+}
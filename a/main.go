@@ -3,8 +3,17 @@ package main
 import (
 	"context"
 	"log"
+	"main/LLM"
+	"main/LLM/llm/LLMConfigs"
+	"main/LLM/llm/roleModel"
+	"main/LLM/llm/tools"
 	"main/asr"
+	"main/audio"
+	"main/config"
+	"main/history"
 	"main/link"
+	"main/recording"
+	"main/tts"
 	"net/http"
 	"os"
 	"os/signal"
@@ -13,21 +22,125 @@ import (
 )
 
 func main() {
-	// 1. 初始化ASR客户端
-	asrClient, err := asr.NewASRClient()
+	// 0. 加载配置: 默认值 < 配置文件 < 环境变量 < 命令行参数
+	cfg, err := config.FromArgs(os.Args[1:])
+	if err != nil {
+		log.Fatalf("加载配置失败: %v", err)
+	}
+	// Secret 类型的字段打印时会自动打码
+	log.Printf("当前配置: %+v", *cfg)
+
+	// 1. 初始化ASR后端
+	recognizer, err := asr.NewRecognizer(cfg.ASR.Provider, cfg.Tencent.AppId, string(cfg.Tencent.SecretId), string(cfg.Tencent.SecretKey))
 	if err != nil {
 		log.Fatalf("初始化ASR客户端失败: %v", err)
 	}
 
+	// 初始化TTS后端
+	synth, err := tts.NewSynthesizer(cfg.TTS.Provider, string(cfg.Tencent.SecretId), string(cfg.Tencent.SecretKey))
+	if err != nil {
+		log.Fatalf("初始化TTS客户端失败: %v", err)
+	}
+
+	// 前端要的音频格式合成后端给不了时用 ffmpeg 转码, 前端发来的 opus 也用它解码
+	audio.FFmpeg = cfg.TTS.FFmpeg
+	if !audio.FFmpegAvailable() {
+		log.Printf("找不到 ffmpeg(%q), 只能输出 wav/pcm 和合成后端直接支持的格式, 不能接收 opus 麦克风音频", cfg.TTS.FFmpeg)
+	}
+
+	// 初始化大模型后端, 会话可以在 init 消息里按名称选择
+	providers := LLM.NewProviders()
+	for _, p := range cfg.LLM.Providers {
+		switch p.Type {
+		case "openai":
+			providers.Add(p.Name, LLMConfigs.NewOpenAIProvider(p.Name, p.BaseURL, string(p.APIKey), p.Model))
+		case "fake":
+			providers.Add(p.Name, LLMConfigs.NewScriptedProvider(p.Name))
+		}
+	}
+	if err := providers.SetDefault(cfg.LLM.Default); err != nil {
+		log.Fatalf("初始化大模型后端失败: %v", err)
+	}
+
+	weatherCfg := tools.WeatherClientConfig{
+		BaseURL:  cfg.Weather.BaseURL,
+		APIKey:   string(cfg.Weather.APIKey),
+		Timeout:  cfg.Weather.Timeout,
+		Retries:  cfg.Weather.Retries,
+		Backoff:  cfg.Weather.RetryBackoff,
+		CacheTTL: cfg.Weather.CacheTTL,
+	}
+	if cfg.Weather.Provider == "fake" {
+		weatherCfg.BaseURL, err = tools.StartFakeWeatherServer()
+		if err != nil {
+			log.Fatalf("初始化天气服务失败: %v", err)
+		}
+		log.Printf("使用本地假天气服务: %s", weatherCfg.BaseURL)
+	}
+	tools.Weather = tools.NewWeatherClient(weatherCfg)
+
+	// 角色库, 会话在 init 消息里按 id 选择
+	personas, err := roleModel.NewStore(cfg.Persona.Dir)
+	if err != nil {
+		log.Fatalf("加载角色库失败: %v", err)
+	}
+
+	// 对话历史, 前端带着会话 id 重连时接着之前的对话
+	var histories *history.Store
+	if cfg.History.Dir != "" {
+		histories, err = history.NewStore(cfg.History.Dir)
+		if err != nil {
+			log.Fatalf("初始化历史记录失败: %v", err)
+		}
+	}
+
+	// 会话录音, 默认关闭
+	var recordings *recording.Store
+	if cfg.Recording.Enabled {
+		recordings, err = recording.NewStore(cfg.Recording.Dir)
+		if err != nil {
+			log.Fatalf("初始化录音失败: %v", err)
+		}
+		log.Printf("会话录音保存在 %s", cfg.Recording.Dir)
+	}
+
 	// 2. 设置路由
-	http.HandleFunc("/asr-stream", link.HandleWebSocket(asrClient))
-	http.Handle("/", http.FileServer(http.Dir("../../static"))) // 前端静态文件
-	// 检测是否有效的生成wav文件
-	//http.HandleFunc("/play", asr.ServeWAVFile)
+	opts := link.Options{
+		SilenceTimeout: cfg.Session.SilenceTimeout,
+		DefaultPersona: cfg.Persona.Default,
+		ResumeGrace:    cfg.Session.ResumeGrace,
+		LLM: LLM.Options{
+			MaxToolRounds: cfg.LLM.MaxToolRounds,
+			Budget: LLM.Budget{
+				MaxTokens:        cfg.LLM.Context.MaxTokens,
+				KeepRecentTokens: cfg.LLM.Context.KeepRecentTokens,
+			},
+			EmotionTags: cfg.LLM.EmotionTags,
+		},
+	}
+	if vad := cfg.Session.VAD; vad.Enabled {
+		vadCfg := asr.DefaultVADConfig()
+		vadCfg.Hangover = vad.Hangover
+		vadCfg.MinSpeech = vad.MinSpeech
+		vadCfg.MinEnergy = vad.MinEnergy
+		opts.VAD = &vadCfg
+	}
+	http.HandleFunc("/asr-stream", link.HandleWebSocket(recognizer, synth, providers, personas, histories, recordings, opts))
+	personaAPI := roleModel.Handler(personas)
+	http.Handle("/api/personas", personaAPI)
+	http.Handle("/api/personas/", personaAPI)
+	http.Handle("/api/voices", tts.VoicesHandler(synth))
+	http.Handle("/api/weather/stats", tools.Weather.StatsHandler())
+	if recordings != nil {
+		recordingAPI := recording.Handler(recordings)
+		http.Handle("/api/recordings", recordingAPI)
+		http.Handle("/api/recordings/", recordingAPI)
+	}
+	http.Handle("/", http.FileServer(http.Dir(cfg.Server.StaticDir))) // 前端静态文件
 
 	// 3. 配置优雅关闭
 	server := &http.Server{
-		Addr:    ":8080",
+		Addr:    cfg.Server.Addr,
 		Handler: nil,
 	}
 
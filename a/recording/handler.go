@@ -0,0 +1,63 @@
+package recording
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+)
+
+// Handler 录音的下载接口, 挂载在 /api/recordings
+// 只能访问自己的会话, 要带上创建会话时发给前端的令牌
+//
+//	GET /api/recordings?session=&token=          列出一个会话的录音
+//	GET /api/recordings/{session}/{name}?token=  下载录音文件
+func Handler(store *Store) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /api/recordings", func(w http.ResponseWriter, r *http.Request) {
+		session := r.URL.Query().Get("session")
+		if err := store.Authorize(session, r.URL.Query().Get("token")); err != nil {
+			writeError(w, err)
+			return
+		}
+		files, err := store.List(session)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, files)
+	})
+	mux.HandleFunc("GET /api/recordings/{session}/{name}", func(w http.ResponseWriter, r *http.Request) {
+		if err := store.Authorize(r.PathValue("session"), r.URL.Query().Get("token")); err != nil {
+			writeError(w, err)
+			return
+		}
+		path, err := store.Path(r.PathValue("session"), r.PathValue("name"))
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		w.Header().Set("Content-Disposition", `attachment; filename="`+r.PathValue("name")+`"`)
+		http.ServeFile(w, r, path)
+	})
+	return mux
+}
+
+func writeError(w http.ResponseWriter, err error) {
+	status := http.StatusInternalServerError
+	switch {
+	case errors.Is(err, ErrNotFound):
+		status = http.StatusNotFound
+	case errors.Is(err, ErrForbidden):
+		status = http.StatusForbidden
+	}
+	writeJSON(w, status, map[string]string{"error": err.Error()})
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Printf("写入响应失败: %v", err)
+	}
+}
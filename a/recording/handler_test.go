@@ -0,0 +1,68 @@
+package recording
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+)
+
+func TestHandlerRequiresToken(t *testing.T) {
+	store, err := NewStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for session, token := range map[string]string{"mine": "token-mine", "other": "token-other"} {
+		r, err := store.Open(session, token)
+		if err != nil {
+			t.Fatal(err)
+		}
+		r.WriteAssistant(1, voice(20))
+		r.Close(2)
+	}
+	server := httptest.NewServer(Handler(store))
+	t.Cleanup(server.Close)
+
+	get := func(path string, query url.Values) (int, []byte) {
+		t.Helper()
+		resp, err := http.Get(server.URL + path + "?" + query.Encode())
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+		return resp.StatusCode, body
+	}
+
+	for _, tc := range []struct {
+		name  string
+		path  string
+		query url.Values
+		want  int
+	}{
+		{"列出全部会话", "/api/recordings", nil, http.StatusForbidden},
+		{"列出时不带令牌", "/api/recordings", url.Values{"session": {"mine"}}, http.StatusForbidden},
+		{"列出时用别的会话的令牌", "/api/recordings", url.Values{"session": {"mine"}, "token": {"token-other"}}, http.StatusForbidden},
+		{"列出不存在的会话", "/api/recordings", url.Values{"session": {"nobody"}, "token": {"token-mine"}}, http.StatusForbidden},
+		{"下载时不带令牌", "/api/recordings/mine/turn-0001-assistant.wav", nil, http.StatusForbidden},
+		{"下载时用别的会话的令牌", "/api/recordings/mine/turn-0001-assistant.wav", url.Values{"token": {"token-other"}}, http.StatusForbidden},
+		{"下载令牌文件", "/api/recordings/mine/token", url.Values{"token": {"token-mine"}}, http.StatusNotFound},
+		{"下载不存在的录音", "/api/recordings/mine/turn-0009-user.wav", url.Values{"token": {"token-mine"}}, http.StatusNotFound},
+		{"下载自己的录音", "/api/recordings/mine/turn-0001-assistant.wav", url.Values{"token": {"token-mine"}}, http.StatusOK},
+	} {
+		if status, body := get(tc.path, tc.query); status != tc.want {
+			t.Errorf("%s: 状态码 %d, 应为 %d: %s", tc.name, status, tc.want, body)
+		}
+	}
+
+	status, body := get("/api/recordings", url.Values{"session": {"mine"}, "token": {"token-mine"}})
+	var files []File
+	if err := json.Unmarshal(body, &files); status != http.StatusOK || err != nil {
+		t.Fatalf("列出自己的录音: %d %s", status, body)
+	}
+	if len(files) != 1 || files[0].Session != "mine" || files[0].Name != "turn-0001-assistant.wav" {
+		t.Errorf("只应列出自己的录音, 得到 %+v", files)
+	}
+}
@@ -0,0 +1,375 @@
+package recording
+
+import (
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"main/audio"
+	"main/tts"
+)
+
+// 麦克风音频的格式, 和送给语音识别的一样
+const (
+	micSampleRate = 16000
+	micChannels   = 1
+	micBits       = 16
+)
+
+var (
+	ErrNotFound  = errors.New("录音不存在")
+	ErrForbidden = errors.New("会话令牌不对, 不能访问这个会话的录音")
+)
+
+// 会话目录里记下会话令牌的文件, 不符合 filePattern, 不会被列出
+const tokenFile = "token"
+
+// 会话 id 用作目录名, 和历史记录的要求相同
+var sessionPattern = regexp.MustCompile(`^[A-Za-z0-9_-]{1,64}$`)
+
+// 录音文件名: turn-0003-user.wav 是第 3 轮用户说的话, turn-0003-assistant.wav 是第 3 轮发给前端的语音
+// 发给前端的是 mp3 或 opus 时按原格式保存为 .mp3 或 .ogg
+var filePattern = regexp.MustCompile(`^turn-(\d{4,})-(user|assistant)\.(wav|mp3|ogg)$`)
+
+// Store 按会话保存录音, 每个会话是目录下的一个子目录
+type Store struct {
+	dir string
+}
+
+func NewStore(dir string) (*Store, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("创建录音目录失败: %v", err)
+	}
+	return &Store{dir: dir}, nil
+}
+
+// Open 开始录一个会话, 会话已有录音时接着往同一个目录里写
+// token 是会话的令牌, 记在目录里, 之后凭它列出和下载这个会话的录音
+func (s *Store) Open(session, token string) (*Recorder, error) {
+	if !sessionPattern.MatchString(session) {
+		return nil, fmt.Errorf("会话 id 无效: %q", session)
+	}
+	dir := filepath.Join(s.dir, session)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("创建录音目录失败: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, tokenFile), []byte(token), 0o600); err != nil {
+		return nil, fmt.Errorf("保存会话令牌失败: %v", err)
+	}
+	// 服务重启后会话的轮次从 1 重新算, 接在已有的录音后面编号, 不覆盖之前的文件
+	r := &Recorder{dir: dir}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("读取录音目录失败: %v", err)
+	}
+	for _, e := range entries {
+		if m := filePattern.FindStringSubmatch(e.Name()); m != nil {
+			if turn, _ := strconv.ParseInt(m[1], 10, 64); turn > r.offset {
+				r.offset = turn
+			}
+		}
+	}
+	return r, nil
+}
+
+// File 一个录音文件
+type File struct {
+	Session string    `json:"session"`
+	Name    string    `json:"name"`
+	Size    int64     `json:"size"`
+	ModTime time.Time `json:"modTime"`
+}
+
+// List 列出录音, session 为空时列出全部会话, 按会话和文件名排序
+// 正在录的文件用的是临时文件名, 补上长度后才改名, 所以不会列出
+func (s *Store) List(session string) ([]File, error) {
+	var sessions []string
+	if session != "" {
+		if !sessionPattern.MatchString(session) {
+			return nil, fmt.Errorf("%w: %s", ErrNotFound, session)
+		}
+		sessions = []string{session}
+	} else {
+		entries, err := os.ReadDir(s.dir)
+		if err != nil {
+			return nil, fmt.Errorf("读取录音目录失败: %v", err)
+		}
+		for _, e := range entries {
+			if e.IsDir() && sessionPattern.MatchString(e.Name()) {
+				sessions = append(sessions, e.Name())
+			}
+		}
+	}
+
+	files := []File{}
+	for _, id := range sessions {
+		entries, err := os.ReadDir(filepath.Join(s.dir, id))
+		if os.IsNotExist(err) {
+			if session != "" {
+				return nil, fmt.Errorf("%w: %s", ErrNotFound, session)
+			}
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("读取录音目录失败: %v", err)
+		}
+		for _, e := range entries {
+			if !filePattern.MatchString(e.Name()) {
+				continue
+			}
+			info, err := e.Info()
+			if err != nil {
+				continue
+			}
+			files = append(files, File{Session: id, Name: e.Name(), Size: info.Size(), ModTime: info.ModTime()})
+		}
+	}
+	sort.Slice(files, func(i, j int) bool {
+		if files[i].Session != files[j].Session {
+			return files[i].Session < files[j].Session
+		}
+		return files[i].Name < files[j].Name
+	})
+	return files, nil
+}
+
+// Authorize 检查 token 是不是会话的令牌, 会话不存在或没有记下令牌时同样返回 ErrForbidden,
+// 不透露哪些会话有录音
+func (s *Store) Authorize(session, token string) error {
+	if !sessionPattern.MatchString(session) || token == "" {
+		return ErrForbidden
+	}
+	stored, err := os.ReadFile(filepath.Join(s.dir, session, tokenFile))
+	if err != nil || len(stored) == 0 || subtle.ConstantTimeCompare(stored, []byte(token)) != 1 {
+		return ErrForbidden
+	}
+	return nil
+}
+
+// Path 录音文件的路径, 会话 id 或文件名无效时返回 ErrNotFound
+func (s *Store) Path(session, name string) (string, error) {
+	if !sessionPattern.MatchString(session) || !filePattern.MatchString(name) {
+		return "", ErrNotFound
+	}
+	path := filepath.Join(s.dir, session, name)
+	if _, err := os.Stat(path); err != nil {
+		return "", ErrNotFound
+	}
+	return path, nil
+}
+
+// Recorder 一个会话的录音, 麦克风按问题切成一段一段, 发给前端的语音按轮保存
+// 录音失败只记日志, 不影响对话, 没有开启录音时为 nil, 方法都不做任何事
+type Recorder struct {
+	dir    string
+	offset int64 // 之前已有的轮数, 加在本次的轮次上
+
+	mu         sync.Mutex
+	mic        *audio.WAVWriter // 还没提问的麦克风音频, nil 表示还没收到
+	micPending int              // 已切好、等待确定轮次的麦克风文件序号
+	assistant  *take
+	finished   int64 // 已经结束的轮次, 之后到的语音不再写入
+	closed     bool
+}
+
+// take 正在写的一轮语音
+type take struct {
+	turn int64
+	ext  string
+	wav  *audio.WAVWriter // ext 为 wav 时使用
+	file *os.File         // 压缩格式直接追加
+	path string           // 写完后改成的文件名, 写的时候加上 .part
+}
+
+// WriteMic 追加麦克风收到的 16k 单声道 PCM
+func (r *Recorder) WriteMic(pcm []byte) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.closed || len(pcm) == 0 {
+		return
+	}
+	if r.mic == nil {
+		r.micPending++
+		w, err := audio.CreateWAV(r.pendingPath(r.micPending), micSampleRate, micChannels, micBits)
+		if err != nil {
+			log.Printf("创建录音文件失败: %v", err)
+			r.micPending--
+			return
+		}
+		r.mic = w
+	}
+	if _, err := r.mic.Write(pcm); err != nil {
+		log.Printf("写入录音失败: %v", err)
+	}
+}
+
+// CutMic 用户说完一个问题时调用, 结束当前这段麦克风录音, 返回交给 NameMic 的标识
+// 这段还没有声音时返回 0
+func (r *Recorder) CutMic() int {
+	if r == nil {
+		return 0
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.cutMic()
+}
+
+func (r *Recorder) cutMic() int {
+	if r.mic == nil {
+		return 0
+	}
+	if err := r.mic.Close(); err != nil {
+		log.Printf("保存录音失败: %v", err)
+	}
+	r.mic = nil
+	return r.micPending
+}
+
+// NameMic 问题对应的轮次确定后, 把 CutMic 切出的那段改名为 turn-xxxx-user.wav
+func (r *Recorder) NameMic(pending int, turn int64) {
+	if r == nil || pending == 0 {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if err := os.Rename(r.pendingPath(pending), r.turnPath(turn, "user", "wav")); err != nil {
+		log.Printf("保存录音失败: %v", err)
+	}
+}
+
+// WriteAssistant 追加第 turn 轮发给前端的一段语音
+func (r *Recorder) WriteAssistant(turn int64, a *tts.Audio) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.closed || turn <= r.finished {
+		return
+	}
+	ext := a.Format
+	switch ext {
+	case "pcm":
+		ext = "wav"
+	case "opus":
+		ext = "ogg"
+	}
+	if r.assistant != nil && (r.assistant.turn != turn || r.assistant.ext != ext) {
+		r.assistant.close()
+		r.assistant = nil
+	}
+	if r.assistant == nil {
+		t, err := r.openTake(turn, ext, a.SampleRate)
+		if err != nil {
+			log.Printf("创建录音文件失败: %v", err)
+			return
+		}
+		r.assistant = t
+	}
+	if err := r.assistant.write(a); err != nil {
+		log.Printf("写入录音失败: %v", err)
+	}
+}
+
+func (r *Recorder) openTake(turn int64, ext string, sampleRate int) (*take, error) {
+	t := &take{turn: turn, ext: ext, path: r.turnPath(turn, "assistant", ext)}
+	var err error
+	if ext == "wav" {
+		t.wav, err = audio.CreateWAV(t.path+".part", sampleRate, 1, 16)
+	} else {
+		t.file, err = os.Create(t.path + ".part")
+	}
+	if err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+func (t *take) write(a *tts.Audio) error {
+	if t.wav == nil {
+		_, err := t.file.Write(a.Data)
+		return err
+	}
+	pcm := a.Data
+	if a.Format == "wav" {
+		wav, err := audio.DecodeWAV(a.Data)
+		if err != nil {
+			return err
+		}
+		pcm = wav.PCM
+	}
+	// 一轮之内换了采样率时按文件的采样率保存
+	_, err := t.wav.Write(audio.Resample(pcm, a.SampleRate, t.wav.SampleRate()))
+	return err
+}
+
+func (t *take) close() {
+	var err error
+	if t.wav != nil {
+		err = t.wav.Close()
+	} else {
+		err = t.file.Close()
+	}
+	if err == nil {
+		err = os.Rename(t.path+".part", t.path)
+	}
+	if err != nil {
+		log.Printf("保存录音失败: %v", err)
+	}
+}
+
+// FinishTurn 第 turn 轮结束或被打断时调用, 保存这一轮的语音
+func (r *Recorder) FinishTurn(turn int64) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.finished = max(r.finished, turn)
+	if r.assistant != nil && r.assistant.turn <= turn {
+		r.assistant.close()
+		r.assistant = nil
+	}
+}
+
+// Close 会话结束时调用, 还没提问的麦克风录音记为第 next 轮
+func (r *Recorder) Close(next int64) {
+	if r == nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.closed {
+		return
+	}
+	r.closed = true
+	if pending := r.cutMic(); pending != 0 {
+		if err := os.Rename(r.pendingPath(pending), r.turnPath(next, "user", "wav")); err != nil {
+			log.Printf("保存录音失败: %v", err)
+		}
+	}
+	if r.assistant != nil {
+		r.assistant.close()
+		r.assistant = nil
+	}
+}
+
+// pendingPath 切好但还不知道属于哪一轮的麦克风录音, 不符合 filePattern, 不会被列出
+func (r *Recorder) pendingPath(n int) string {
+	return filepath.Join(r.dir, fmt.Sprintf("pending-%d.wav", n))
+}
+
+func (r *Recorder) turnPath(turn int64, who, ext string) string {
+	return filepath.Join(r.dir, fmt.Sprintf("turn-%04d-%s.%s", r.offset+turn, who, ext))
+}
@@ -0,0 +1,106 @@
+package recording
+
+import (
+	"main/audio"
+	"main/tts"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+// voice 一段 16k 的 wav 语音
+func voice(ms int) *tts.Audio {
+	pcm := make([]byte, 16*2*ms)
+	return &tts.Audio{Data: audio.EncodeWAV(pcm, 16000, 1, 16), Format: "wav", SampleRate: 16000}
+}
+
+// names 列出会话的录音文件名
+func names(t *testing.T, store *Store, session string) []string {
+	t.Helper()
+	files, err := store.List(session)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var out []string
+	for _, f := range files {
+		out = append(out, f.Name)
+	}
+	return out
+}
+
+func TestRecorderRenamesWhenDone(t *testing.T) {
+	store, err := NewStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err := store.Open("s1", "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r.WriteMic(make([]byte, 3200))
+	pending := r.CutMic()
+	r.WriteAssistant(1, voice(100))
+	r.WriteAssistant(1, voice(100))
+	// 还在写的和还不知道轮次的都不列出
+	if got := names(t, store, "s1"); len(got) != 0 {
+		t.Fatalf("写完前列出了 %v", got)
+	}
+	if _, err := os.Stat(filepath.Join(store.dir, "s1", "turn-0001-assistant.wav.part")); err != nil {
+		t.Fatalf("写的时候应使用 .part 文件: %v", err)
+	}
+
+	r.NameMic(pending, 1)
+	r.FinishTurn(1)
+	// 结束后到的语音不再写入
+	r.WriteAssistant(1, voice(100))
+	want := []string{"turn-0001-assistant.wav", "turn-0001-user.wav"}
+	if got := names(t, store, "s1"); !slices.Equal(got, want) {
+		t.Fatalf("录音 %v, 应为 %v", got, want)
+	}
+	path, err := store.Path("s1", "turn-0001-assistant.wav")
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	wav, err := audio.DecodeWAV(data)
+	if err != nil {
+		t.Fatalf("改名后的文件头应已补上长度: %v", err)
+	}
+	if len(wav.PCM) != 2*16*2*100 {
+		t.Errorf("语音 %d 字节, 应为两段共 %d 字节", len(wav.PCM), 2*16*2*100)
+	}
+}
+
+func TestRecorderContinuesNumbering(t *testing.T) {
+	store, err := NewStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err := store.Open("s1", "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.WriteAssistant(1, voice(20))
+	r.FinishTurn(1)
+	r.WriteAssistant(2, voice(20))
+	// 还没提问的麦克风录音记为下一轮
+	r.WriteMic(make([]byte, 3200))
+	r.Close(3)
+
+	// 服务重启后同一个会话的轮次从 1 重新算, 接在已有的录音后面
+	r, err = store.Open("s1", "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	r.WriteAssistant(1, voice(20))
+	r.Close(2)
+	want := []string{"turn-0001-assistant.wav", "turn-0002-assistant.wav", "turn-0003-user.wav", "turn-0004-assistant.wav"}
+	if got := names(t, store, "s1"); !slices.Equal(got, want) {
+		t.Errorf("录音 %v, 应为 %v", got, want)
+	}
+}
@@ -0,0 +1,100 @@
+package tts
+
+import (
+	"fmt"
+	"main/audio"
+	"slices"
+)
+
+// OutputFormat 发给前端的音频格式, 会话开始时由前端选择
+type OutputFormat struct {
+	Format     string `json:"format"`     // wav, pcm(16bit 单声道), mp3, opus(ogg 封装)
+	SampleRate int    `json:"sampleRate"` // 为 0 时使用 16000
+}
+
+// DefaultOutputFormat 前端没有选择时使用, 和早期一样是 16k 的 wav
+var DefaultOutputFormat = OutputFormat{Format: "wav", SampleRate: 16000}
+
+// outputSampleRates 每种格式可选的采样率
+var outputSampleRates = map[string][]int{
+	"wav":  {8000, 16000, 22050, 24000, 32000, 44100, 48000},
+	"pcm":  {8000, 16000, 22050, 24000, 32000, 44100, 48000},
+	"mp3":  {8000, 16000, 22050, 24000, 32000, 44100, 48000},
+	"opus": {8000, 16000, 24000, 48000},
+}
+
+// FormatSynthesizer 能直接合成多种格式的后端, 不能直接合成的格式由 Convert 转换
+type FormatSynthesizer interface {
+	Synthesizer
+	SupportsFormat(f OutputFormat) bool
+}
+
+// CheckOutputFormat 补全默认值并检查 synth 能否输出这种格式
+// wav 和 pcm 总能转换, mp3 和 opus 需要后端直接支持或者有 ffmpeg
+func CheckOutputFormat(synth Synthesizer, f OutputFormat) (OutputFormat, error) {
+	if f.Format == "" {
+		f.Format = DefaultOutputFormat.Format
+	}
+	if f.SampleRate == 0 {
+		f.SampleRate = DefaultOutputFormat.SampleRate
+	}
+	rates, ok := outputSampleRates[f.Format]
+	if !ok {
+		return f, fmt.Errorf("不支持的音频格式: %s", f.Format)
+	}
+	if !slices.Contains(rates, f.SampleRate) {
+		return f, fmt.Errorf("%s 不支持 %dHz, 可选 %v", f.Format, f.SampleRate, rates)
+	}
+	switch f.Format {
+	case "mp3", "opus":
+		if native, ok := synth.(FormatSynthesizer); ok && native.SupportsFormat(f) {
+			return f, nil
+		}
+		if !audio.FFmpegAvailable() {
+			return f, fmt.Errorf("服务端没有 ffmpeg, 无法输出 %s", f.Format)
+		}
+	}
+	return f, nil
+}
+
+// Convert 把合成结果转换成 f 指定的格式和采样率, 已经符合或 f 为空时原样返回
+// 只能从 wav 和 pcm 转换, 需要转换时后端应合成这两种格式
+func Convert(a *Audio, f OutputFormat) (*Audio, error) {
+	if f.Format == "" || a.Format == f.Format && a.SampleRate == f.SampleRate {
+		return a, nil
+	}
+	var pcm []byte
+	switch a.Format {
+	case "wav":
+		wav, err := audio.DecodeWAV(a.Data)
+		if err != nil {
+			return nil, err
+		}
+		if wav.Channels != 1 || wav.BitsPerSample != 16 {
+			return nil, fmt.Errorf("只能转换 16bit 单声道的 wav, 收到 %d声道/%dbit", wav.Channels, wav.BitsPerSample)
+		}
+		pcm = wav.PCM
+	case "pcm":
+		pcm = a.Data
+	default:
+		return nil, fmt.Errorf("无法把 %s 转换为 %s", a.Format, f.Format)
+	}
+	pcm = audio.Resample(pcm, a.SampleRate, f.SampleRate)
+
+	converted := &Audio{Format: f.Format, SampleRate: f.SampleRate}
+	switch f.Format {
+	case "wav":
+		converted.Data = audio.EncodeWAV(pcm, f.SampleRate, 1, 16)
+	case "pcm":
+		converted.Data = pcm
+	default:
+		data, err := audio.EncodePCM(pcm, f.SampleRate, f.Format)
+		if err != nil {
+			return nil, err
+		}
+		converted.Data = data
+		// 压缩后无法从长度算出时长, 按编码前的 PCM 记下来
+		converted.Length = (&Audio{Data: pcm, Format: "pcm", SampleRate: f.SampleRate}).Duration()
+	}
+	return converted, nil
+}
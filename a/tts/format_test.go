@@ -0,0 +1,95 @@
+package tts
+
+import (
+	"encoding/binary"
+	"main/audio"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// fakeFFmpeg 用 shell 脚本代替 ffmpeg, 编码结果是固定的几个字节, 时长只能从 Length 得到
+func fakeFFmpeg(t *testing.T) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "ffmpeg")
+	if err := os.WriteFile(path, []byte("#!/bin/sh\ncat >/dev/null\nprintf encoded\n"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	old := audio.FFmpeg
+	audio.FFmpeg = path
+	t.Cleanup(func() { audio.FFmpeg = old })
+}
+
+// nativeMP3 像腾讯云一样直接合成 mp3 的假后端, 每个字一帧, 不记 Length
+type nativeMP3 struct{}
+
+// mp3Header 第 III 层 32kbps 的帧头, 16k 和 24k 是 MPEG-2, 8k 是 MPEG-2.5
+var mp3Header = map[int]uint32{8000: 0xFFE34800, 16000: 0xFFF34800, 24000: 0xFFF34400}
+
+func (nativeMP3) SupportsFormat(f OutputFormat) bool {
+	_, ok := mp3Header[f.SampleRate]
+	return f.Format == "mp3" && ok
+}
+
+func (nativeMP3) Synthesize(req Request) (*Audio, error) {
+	rate := req.Output.SampleRate
+	frame := make([]byte, 72*32000/rate)
+	binary.BigEndian.PutUint32(frame, mp3Header[rate])
+	var data []byte
+	for range []rune(req.Text) {
+		data = append(data, frame...)
+	}
+	return &Audio{Data: data, Format: "mp3", SampleRate: rate}, nil
+}
+
+func TestDurationEveryFormat(t *testing.T) {
+	fakeFFmpeg(t)
+	synth := NewToneSynthesizer()
+	source, err := synth.Synthesize(Request{Text: "你好"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := source.Duration()
+
+	for format, rates := range outputSampleRates {
+		for _, rate := range rates {
+			f, err := CheckOutputFormat(synth, OutputFormat{Format: format, SampleRate: rate})
+			if err != nil {
+				t.Fatal(err)
+			}
+			config := InitTTSConfig()
+			config.SetOutput(f)
+			a, err := config.Synthesize(synth, "你好", "", Emotion{})
+			if err != nil {
+				t.Fatalf("%s/%d: %v", format, rate, err)
+			}
+			// 重采样后的样本数取整, 允许差一毫秒
+			if got := a.Duration(); got < want-time.Millisecond || got > want+time.Millisecond {
+				t.Errorf("%s/%d: 时长 %v, 应为 %v", format, rate, got, want)
+			}
+		}
+	}
+}
+
+func TestDurationNativeMP3(t *testing.T) {
+	// 超过长度上限时分段合成再拼接, 每段都没有 Length
+	synth := NewSegmentedSynthesizer(nativeMP3{}, 4)
+	text := "今天天气很好。我们出去走走吧。"
+	for rate := range mp3Header {
+		f, err := CheckOutputFormat(synth, OutputFormat{Format: "mp3", SampleRate: rate})
+		if err != nil {
+			t.Fatal(err)
+		}
+		config := InitTTSConfig()
+		config.SetOutput(f)
+		a, err := config.Synthesize(synth, text, "", Emotion{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := time.Duration(len([]rune(text))) * 576 * time.Second / time.Duration(rate)
+		if got := a.Duration(); got != want {
+			t.Errorf("%dHz: 时长 %v, 应为 %v", rate, got, want)
+		}
+	}
+}
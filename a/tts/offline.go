@@ -0,0 +1,89 @@
+package tts
+
+import (
+	"encoding/binary"
+	"math"
+	"strings"
+	"unicode"
+
+	"main/audio"
+)
+
+const offlineSampleRate = 16000
+
+// ToneSynthesizer 离线合成后端, 不需要网络
+// 每个字生成一个带谐波的音节音, 标点处停顿, 只能听出节奏和语调,
+// 用于没有网络或凭证时跑通整个流程
+type ToneSynthesizer struct {
+	SampleRate int
+}
+
+func NewToneSynthesizer() *ToneSynthesizer {
+	return &ToneSynthesizer{SampleRate: offlineSampleRate}
+}
+
+// Voices 实现 VoiceCatalog
+func (s *ToneSynthesizer) Voices() []Voice {
+	return offlineVoices
+}
+
+// Synthesize 实现 Synthesizer
+func (s *ToneSynthesizer) Synthesize(req Request) (*Audio, error) {
+	// 语速 [-2,6] 对应音节时长 300ms ~ 100ms
+	syllable := 0.18 / (1 + req.Speed*0.2)
+	if syllable < 0.1 {
+		syllable = 0.1
+	}
+	// 音量 [-10,10] 对应振幅 0.05 ~ 0.85
+	amplitude := 0.05 + 0.04*(req.Volume+10)
+
+	base := 220.0
+	if v, _ := FindVoice(offlineVoices, req.Voice); v.Gender == "male" {
+		base = 120.0
+	}
+
+	var pcm []byte
+	for _, r := range req.Text {
+		switch {
+		case strings.ContainsRune("。！？!?；;\n", r):
+			pcm = s.appendSilence(pcm, 0.3)
+		case unicode.IsPunct(r) || unicode.IsSpace(r):
+			pcm = s.appendSilence(pcm, 0.15)
+		default:
+			// 用字符编码决定音高, 同一个字每次发音相同
+			freq := base * (1 + float64(r%12)/24)
+			pcm = s.appendSyllable(pcm, freq, syllable, amplitude)
+		}
+	}
+
+	return &Audio{
+		Data:       audio.EncodeWAV(pcm, s.SampleRate, 1, 16),
+		Format:     "wav",
+		SampleRate: s.SampleRate,
+	}, nil
+}
+
+// appendSyllable 基频加两个谐波, 前后各 20% 淡入淡出
+func (s *ToneSynthesizer) appendSyllable(pcm []byte, freq, seconds, amplitude float64) []byte {
+	n := int(seconds * float64(s.SampleRate))
+	fade := n / 5
+	for i := 0; i < n; i++ {
+		t := float64(i) / float64(s.SampleRate)
+		v := 0.6*math.Sin(2*math.Pi*freq*t) +
+			0.3*math.Sin(2*math.Pi*2*freq*t) +
+			0.1*math.Sin(2*math.Pi*3*freq*t)
+
+		env := 1.0
+		if i < fade {
+			env = float64(i) / float64(fade)
+		} else if i > n-fade {
+			env = float64(n-i) / float64(fade)
+		}
+		pcm = binary.LittleEndian.AppendUint16(pcm, uint16(int16(v*env*amplitude*math.MaxInt16)))
+	}
+	return pcm
+}
+
+func (s *ToneSynthesizer) appendSilence(pcm []byte, seconds float64) []byte {
+	return append(pcm, make([]byte, int(seconds*float64(s.SampleRate))*2)...)
+}
@@ -0,0 +1,174 @@
+package tts
+
+import (
+	"strings"
+	"unicode"
+)
+
+// 腾讯云单次合成最多 150 个汉字(全角标点算一个)或 500 个字母(半角字符算一个)
+// 按十分之一个汉字计数: 汉字和全角字符算 10, 半角字符算 3, 混合中英文时也不会超限
+const (
+	wideCost   = 10
+	narrowCost = 3
+)
+
+// TencentTextLimit 腾讯云单次合成的长度上限, 以汉字计
+const TencentTextLimit = 150
+
+// 依次尝试的切分位置: 句末标点、分句标点、空白, 都放不下时才在字符之间硬切
+var boundaries = []string{
+	"。！？!?；;…\n",
+	"，,、：:",
+	" \t",
+}
+
+// SplitText 把 text 切成若干段, 每段不超过 limit 个汉字的长度
+// 尽量在句子之间切开, 一句放不下时再按分句、空白切, 不会把英文单词和数字切断, 除非它们本身就超长
+// 相邻的短句会合并到同一段, 减少请求次数. 只有标点和空白的段会被丢掉
+func SplitText(text string, limit int) []string {
+	text = strings.TrimSpace(text)
+	if text == "" || limit <= 0 {
+		return nil
+	}
+	var segments []string
+	for _, s := range split(text, limit*wideCost, 0) {
+		if s = strings.TrimSpace(s); speakable(s) {
+			segments = append(segments, s)
+		}
+	}
+	return segments
+}
+
+// split 在第 level 级边界处切开并贪心合并, 仍然超长的部分交给下一级
+func split(text string, limit, level int) []string {
+	if textCost(text) <= limit {
+		return []string{text}
+	}
+	if level == len(boundaries) {
+		return hardSplit(text, limit)
+	}
+	var segments []string
+	var current strings.Builder
+	currentCost := 0
+	flush := func() {
+		if current.Len() > 0 {
+			segments = append(segments, current.String())
+			current.Reset()
+			currentCost = 0
+		}
+	}
+	for _, piece := range splitAfter(text, boundaries[level]) {
+		cost := textCost(piece)
+		if currentCost+cost <= limit {
+			current.WriteString(piece)
+			currentCost += cost
+			continue
+		}
+		flush()
+		if cost <= limit {
+			current.WriteString(piece)
+			currentCost = cost
+			continue
+		}
+		segments = append(segments, split(piece, limit, level+1)...)
+	}
+	flush()
+	return segments
+}
+
+// splitAfter 在 marks 中的字符之后切开, 每一片保留结尾的标点
+// 半角的 . , : 两边都是数字时不算边界, 比如 3.14、1,000、12:30; 半角句点后面跟着空白或结尾时才算句末
+func splitAfter(text string, marks string) []string {
+	runes := []rune(text)
+	var pieces []string
+	start := 0
+	for i := range runes {
+		if !isBoundary(runes, i, marks) {
+			continue
+		}
+		// 连续的标点留在同一片, 比如 "？！" 和 "……"
+		if i+1 < len(runes) && strings.ContainsRune(marks, runes[i+1]) {
+			continue
+		}
+		pieces = append(pieces, string(runes[start:i+1]))
+		start = i + 1
+	}
+	if start < len(runes) {
+		pieces = append(pieces, string(runes[start:]))
+	}
+	return pieces
+}
+
+func isBoundary(runes []rune, i int, marks string) bool {
+	r := runes[i]
+	if r == '.' && strings.ContainsRune(marks, '!') {
+		// 英文句点只在句末标点这一级考虑
+		return i+1 == len(runes) || unicode.IsSpace(runes[i+1])
+	}
+	if !strings.ContainsRune(marks, r) {
+		return false
+	}
+	if r == ',' || r == ':' {
+		between := i > 0 && i+1 < len(runes) && unicode.IsDigit(runes[i-1]) && unicode.IsDigit(runes[i+1])
+		return !between
+	}
+	return true
+}
+
+// hardSplit 逐个字符切, 尽量不在英文单词或数字中间断开
+func hardSplit(text string, limit int) []string {
+	runes := []rune(text)
+	var segments []string
+	start, cost := 0, 0
+	for i := 0; i < len(runes); i++ {
+		c := runeCost(runes[i])
+		if cost+c <= limit || i == start {
+			cost += c
+			continue
+		}
+		cut := i
+		// 退回到这个单词的开头, 单词占满整段时只能硬切
+		for cut > start && isWordRune(runes[cut-1]) && isWordRune(runes[cut]) {
+			cut--
+		}
+		if cut == start {
+			cut = i
+		}
+		segments = append(segments, string(runes[start:cut]))
+		start, cost = cut, 0
+		i = cut - 1
+	}
+	if start < len(runes) {
+		segments = append(segments, string(runes[start:]))
+	}
+	return segments
+}
+
+func textCost(text string) int {
+	cost := 0
+	for _, r := range text {
+		cost += runeCost(r)
+	}
+	return cost
+}
+
+func runeCost(r rune) int {
+	if r < 0x80 {
+		return narrowCost
+	}
+	return wideCost
+}
+
+func isWordRune(r rune) bool {
+	return r < 0x80 && (unicode.IsLetter(r) || unicode.IsDigit(r))
+}
+
+// speakable 至少有一个文字或数字, 只有标点的段合成不出声音
+func speakable(text string) bool {
+	for _, r := range text {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			return true
+		}
+	}
+	return false
+}
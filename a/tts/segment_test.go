@@ -0,0 +1,74 @@
+package tts
+
+import (
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestSplitText(t *testing.T) {
+	for _, tc := range []struct {
+		name  string
+		text  string
+		limit int
+		want  []string
+	}{
+		{"空", "  ", 5, nil},
+		{"只有标点", "……", 5, nil},
+		{"不超过上限", "你好。", 150, []string{"你好。"}},
+		{"汉字正好到上限", "一二三四五", 5, []string{"一二三四五"}},
+		{"汉字超过上限一个字", "一二三四五六", 5, []string{"一二三四五", "六"}},
+		{"半角字符正好到上限", "abcdefghij", 3, []string{"abcdefghij"}},
+		{"句子正好到上限", "今天天气很好。我们出去玩吧！", 7, []string{"今天天气很好。", "我们出去玩吧！"}},
+		{"连续的标点不分开", "真的吗？！好吧。", 5, []string{"真的吗？！", "好吧。"}},
+		{"中英混合按空白切", "我喜欢 Go language 和编程。", 5, []string{"我喜欢 Go", "language", "和编程。"}},
+		{"小数千分位和时间不切开", "圆周率是3.14，一共1,000个，时间12:30。", 7,
+			[]string{"圆周率是3.14，", "一共1,000个，", "时间12:30。"}},
+		{"英文句点只在句末", "I paid 3.50 dollars. Then I left.", 7, []string{"I paid 3.50 dollars.", "Then I left."}},
+		{"硬切时不切断单词", "一二三四五abcdef", 6, []string{"一二三四五", "abcdef"}},
+		{"超长的单词只能硬切", "go supercalifragilisticexpialidocious", 4,
+			[]string{"go", "supercalifrag", "ilisticexpial", "idocious"}},
+	} {
+		got := SplitText(tc.text, tc.limit)
+		if !slices.Equal(got, tc.want) {
+			t.Errorf("%s: 切成 %q, 应为 %q", tc.name, got, tc.want)
+			continue
+		}
+		for _, s := range got {
+			if cost := textCost(s); cost > tc.limit*wideCost {
+				t.Errorf("%s: %q 的长度 %d 超过上限 %d", tc.name, s, cost, tc.limit*wideCost)
+			}
+		}
+		// 除了段与段之间的空白, 一个字也不丢
+		if got != nil && noSpace(strings.Join(got, "")) != noSpace(tc.text) {
+			t.Errorf("%s: 拼回去是 %q", tc.name, strings.Join(got, ""))
+		}
+	}
+}
+
+func TestIsBoundary(t *testing.T) {
+	for _, tc := range []struct {
+		text  string
+		at    int
+		marks string
+		want  bool
+	}{
+		{"3.14", 1, boundaries[0], false},
+		{"end.", 3, boundaries[0], true},
+		{"end. next", 3, boundaries[0], true},
+		{"1,000", 1, boundaries[1], false},
+		{"a, b", 1, boundaries[1], true},
+		{"12:30", 2, boundaries[1], false},
+		{"注意: 小心", 2, boundaries[1], true},
+		{"好，", 1, boundaries[1], true},
+		{"end.", 3, boundaries[1], false}, // 英文句点不是分句标点
+	} {
+		if got := isBoundary([]rune(tc.text), tc.at, tc.marks); got != tc.want {
+			t.Errorf("%q 第 %d 个字符是否边界: %v, 应为 %v", tc.text, tc.at, got, tc.want)
+		}
+	}
+}
+
+func noSpace(s string) string {
+	return strings.Join(strings.Fields(s), "")
+}
@@ -0,0 +1,97 @@
+package tts
+
+import (
+	"bytes"
+	"fmt"
+	"main/audio"
+	"sync"
+)
+
+// SegmentedSynthesizer 把超过后端长度上限的文字切成几段, 并发合成后按顺序拼成一段音频
+type SegmentedSynthesizer struct {
+	Synthesizer
+	Limit       int // 每段最多多少个汉字的长度
+	Concurrency int // 同时合成的段数, 不大于 0 时逐段合成
+}
+
+// 长回答同时合成的段数, 腾讯云默认并发上限是 20, 留给其他会话
+const defaultSegmentConcurrency = 4
+
+func NewSegmentedSynthesizer(synth Synthesizer, limit int) *SegmentedSynthesizer {
+	return &SegmentedSynthesizer{Synthesizer: synth, Limit: limit, Concurrency: defaultSegmentConcurrency}
+}
+
+// SupportsFormat 实现 FormatSynthesizer, 和被包装的后端相同
+func (s *SegmentedSynthesizer) SupportsFormat(f OutputFormat) bool {
+	native, ok := s.Synthesizer.(FormatSynthesizer)
+	return ok && native.SupportsFormat(f)
+}
+
+// Voices 实现 VoiceCatalog, 和被包装的后端相同
+func (s *SegmentedSynthesizer) Voices() []Voice {
+	return Voices(s.Synthesizer)
+}
+
+// Synthesize 实现 Synthesizer, 不超过上限时直接交给后端
+func (s *SegmentedSynthesizer) Synthesize(req Request) (*Audio, error) {
+	segments := SplitText(req.Text, s.Limit)
+	if len(segments) <= 1 {
+		return s.Synthesizer.Synthesize(req)
+	}
+
+	results := make([]*Audio, len(segments))
+	errs := make([]error, len(segments))
+	workers := s.Concurrency
+	if workers <= 0 {
+		workers = 1
+	}
+	sem := make(chan struct{}, workers)
+	var wg sync.WaitGroup
+	for i, text := range segments {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int, text string) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			segment := req
+			segment.Text = text
+			results[i], errs[i] = s.Synthesizer.Synthesize(segment)
+		}(i, text)
+	}
+	wg.Wait()
+
+	for i, err := range errs {
+		if err != nil {
+			return nil, fmt.Errorf("合成第 %d/%d 段失败: %v", i+1, len(segments), err)
+		}
+	}
+	return joinAudio(results)
+}
+
+// joinAudio 按顺序拼接格式相同的几段音频, wav 重写文件头, pcm 和 mp3 直接首尾相接
+// 后端不会直接合成 opus, 所以不用拼接 ogg
+func joinAudio(parts []*Audio) (*Audio, error) {
+	first := parts[0]
+	for i, part := range parts[1:] {
+		if part.Format != first.Format || part.SampleRate != first.SampleRate {
+			return nil, fmt.Errorf("第 %d 段音频是 %s/%dHz, 和第 1 段的 %s/%dHz 不同",
+				i+2, part.Format, part.SampleRate, first.Format, first.SampleRate)
+		}
+	}
+	joined := &Audio{Format: first.Format, SampleRate: first.SampleRate}
+	data := make([][]byte, len(parts))
+	for i, part := range parts {
+		data[i] = part.Data
+		joined.Length += part.Length
+	}
+	if first.Format == "wav" {
+		wav, err := audio.ConcatWAV(data...)
+		if err != nil {
+			return nil, fmt.Errorf("拼接音频失败: %v", err)
+		}
+		joined.Data = wav
+	} else {
+		joined.Data = bytes.Join(data, nil)
+	}
+	return joined, nil
+}
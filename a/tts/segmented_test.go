@@ -0,0 +1,73 @@
+package tts
+
+import (
+	"encoding/binary"
+	"main/audio"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// numberSynthesizer 每段合成 samples 个值为段号的样本, 段号是文字开头的数字,
+// 越靠前的段越晚完成, 记下同时合成的最大段数
+type numberSynthesizer struct {
+	samples int
+
+	mu      sync.Mutex
+	running int
+	peak    int
+}
+
+func (s *numberSynthesizer) Synthesize(req Request) (*Audio, error) {
+	s.mu.Lock()
+	s.running++
+	s.peak = max(s.peak, s.running)
+	s.mu.Unlock()
+	defer func() {
+		s.mu.Lock()
+		s.running--
+		s.mu.Unlock()
+	}()
+
+	n := int(req.Text[0] - '0')
+	time.Sleep(time.Duration(10-n) * 5 * time.Millisecond)
+	pcm := make([]byte, 0, s.samples*2)
+	for range s.samples {
+		pcm = binary.LittleEndian.AppendUint16(pcm, uint16(n))
+	}
+	return &Audio{Data: audio.EncodeWAV(pcm, 16000, 1, 16), Format: "wav", SampleRate: 16000}, nil
+}
+
+func TestSegmentedJoinsInOrder(t *testing.T) {
+	backend := &numberSynthesizer{samples: 160}
+	synth := &SegmentedSynthesizer{Synthesizer: backend, Limit: 4, Concurrency: 4}
+	// 每句一段, 两句放不进一段
+	var text strings.Builder
+	for i := 1; i <= 8; i++ {
+		text.WriteString(string(rune('0'+i)) + "号段。")
+	}
+
+	a, err := synth.Synthesize(Request{Text: text.String()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if backend.peak < 2 || backend.peak > 4 {
+		t.Errorf("同时合成 %d 段, 应在 2 到 4 段之间", backend.peak)
+	}
+	wav, err := audio.DecodeWAV(a.Data)
+	if err != nil {
+		t.Fatalf("拼接结果不是一个有效的 wav: %v", err)
+	}
+	if wav.SampleRate != 16000 || len(wav.PCM) != 8*160*2 {
+		t.Fatalf("拼接结果 %dHz %d 字节, 应为 16000Hz %d 字节", wav.SampleRate, len(wav.PCM), 8*160*2)
+	}
+	for i := range 8 {
+		if got := binary.LittleEndian.Uint16(wav.PCM[i*160*2:]); int(got) != i+1 {
+			t.Errorf("第 %d 段的内容是第 %d 段的", i+1, got)
+		}
+	}
+	if got, want := a.Duration(), 8*10*time.Millisecond; got != want {
+		t.Errorf("时长 %v, 应为 %v", got, want)
+	}
+}
@@ -0,0 +1,80 @@
+package tts
+
+import (
+	"fmt"
+	"main/audio"
+	"time"
+)
+
+// Request 一次语音合成请求
+type Request struct {
+	Text   string
+	Voice  string  // 音色名称, 为空时使用默认音色
+	Speed  float64 // 语速 [-2,6]
+	Volume float64 // 音量 [-10,10]
+	// 希望的输出格式, 后端不能直接合成时返回 wav 或 pcm, 由调用方转换
+	Output  OutputFormat
+	Emotion Emotion // 音色不支持这种情感时按中性合成
+}
+
+// Emotion 合成时的情感
+type Emotion struct {
+	Category  string // 取值见 Voice.Emotions, 为空表示中性
+	Intensity int    // 情感程度 [50,200], 0 表示默认
+}
+
+// Audio 合成结果
+type Audio struct {
+	Data       []byte
+	Format     string // wav, pcm, mp3, opus
+	SampleRate int
+	Length     time.Duration // 压缩格式的播放时长, 为 0 时由 Duration 计算
+}
+
+// Duration 播放时长, 没有记下 Length 时按 16bit 单声道的 wav/pcm 的长度或 mp3 的帧头计算
+// opus 没有记下 Length 时返回 0
+func (a *Audio) Duration() time.Duration {
+	if a.Length > 0 {
+		return a.Length
+	}
+	if a.Format == "mp3" {
+		return audio.MP3Duration(a.Data)
+	}
+	if a.SampleRate <= 0 {
+		return 0
+	}
+	size := len(a.Data)
+	switch a.Format {
+	case "wav":
+		size -= 44
+	case "pcm":
+	default:
+		return 0
+	}
+	if size <= 0 {
+		return 0
+	}
+	return time.Duration(size) * time.Second / time.Duration(a.SampleRate*2)
+}
+
+// Synthesizer 语音合成后端
+type Synthesizer interface {
+	Synthesize(req Request) (*Audio, error)
+}
+
+// NewSynthesizer 按名称创建合成后端, 可选 tencent(默认) 和 offline
+// 腾讯云单次合成有长度上限, 长回答会自动分段合成再拼接
+func NewSynthesizer(provider, secretId, secretKey string) (Synthesizer, error) {
+	switch provider {
+	case "", "tencent":
+		tencent, err := NewTencentSynthesizer(secretId, secretKey)
+		if err != nil {
+			return nil, err
+		}
+		return NewSegmentedSynthesizer(tencent, TencentTextLimit), nil
+	case "offline":
+		return NewToneSynthesizer(), nil
+	default:
+		return nil, fmt.Errorf("未知的TTS后端: %s", provider)
+	}
+}
@@ -4,35 +4,122 @@ import (
 	"encoding/base64"
 	"fmt"
 	"log"
-	"main/client"
+	"main/audio"
+	"slices"
 
+	"github.com/tencentcloud/tencentcloud-sdk-go/tencentcloud/common"
 	"github.com/tencentcloud/tencentcloud-sdk-go/tencentcloud/common/errors"
 	tts "github.com/tencentcloud/tencentcloud-sdk-go/tencentcloud/tts/v20190823"
 )
 
-func (config *TTSConfig) GetTTSRBytes(text string, speakerType string) ([]byte, error) {
-	ttsClient, err := NewTTSClient(client.SecretId, client.SecretKey)
+// TencentSynthesizer 腾讯云语音合成, 复用同一个 TTSClient
+type TencentSynthesizer struct {
+	client *TTSClient
+}
+
+func NewTencentSynthesizer(secretId, secretKey string) (*TencentSynthesizer, error) {
+	ttsClient, err := NewTTSClient(secretId, secretKey)
 	if err != nil {
-		log.Printf("tts初始化错误: %v", err)
+		return nil, err
 	}
+	return &TencentSynthesizer{client: ttsClient}, nil
+}
+
+// Voices 实现 VoiceCatalog
+func (s *TencentSynthesizer) Voices() []Voice {
+	return tencentVoices
+}
+
+// tencentSupportsEmotion 只有多情感音色能设置情感, 其他音色设置了会报错
+func tencentSupportsEmotion(voice, category string) bool {
+	v, ok := FindVoice(tencentVoices, voice)
+	return ok && slices.Contains(v.Emotions, category)
+}
 
-	speed := config.Speed
-	volume := config.Volume
-	speaker := ttsSpeaker(speakerType)
+// 腾讯云能直接合成的格式和采样率
+var (
+	tencentCodecs      = []string{"wav", "pcm", "mp3"}
+	tencentSampleRates = []int{8000, 16000, 24000}
+)
+
+// SupportsFormat 实现 FormatSynthesizer
+func (s *TencentSynthesizer) SupportsFormat(f OutputFormat) bool {
+	return slices.Contains(tencentCodecs, f.Format) && slices.Contains(tencentSampleRates, f.SampleRate)
+}
+
+// tencentRequest 按 req 填写合成请求, 音色不支持 req.Emotion 时不设置情感, 按中性合成
+func tencentRequest(req Request, output OutputFormat) *tts.TextToVoiceRequest {
+	speaker := ttsSpeaker(req.Voice)
 	request := tts.NewTextToVoiceRequest()
-	request = setRequest(request, text, speed, volume, speaker)
-	response, err := ttsClient.client.TextToVoice(request)
+	request = setRequest(request, req.Text, req.Speed, req.Volume, speaker)
+	request.Codec = common.StringPtr(output.Format)
+	request.SampleRate = common.Uint64Ptr(uint64(output.SampleRate))
+	if emotion := req.Emotion; emotion.Category != "" && tencentSupportsEmotion(req.Voice, emotion.Category) {
+		request.EmotionCategory = common.StringPtr(emotion.Category)
+		if emotion.Intensity > 0 {
+			request.EmotionIntensity = common.Int64Ptr(int64(emotion.Intensity))
+		}
+	}
+	return request
+}
+
+// Synthesize 实现 Synthesizer, 不能直接合成 req.Output 时返回 16k 的 wav
+func (s *TencentSynthesizer) Synthesize(req Request) (*Audio, error) {
+	output := req.Output
+	if !s.SupportsFormat(output) {
+		output = DefaultOutputFormat
+	}
+	response, err := s.client.client.TextToVoice(tencentRequest(req, output))
 	if _, ok := err.(*errors.TencentCloudSDKError); ok {
-		log.Printf("ttsApi错误: %s", err)
+		return nil, fmt.Errorf("ttsApi错误: %s", err)
 	}
 	if err != nil {
-		log.Printf("获取ttsResponse错误: %s", err)
+		return nil, fmt.Errorf("获取ttsResponse错误: %s", err)
 	}
 
-	return ttsClient.GetBytes(response)
+	audioBytes, err := s.client.GetBytes(response)
+	if err != nil {
+		return nil, err
+	}
+	result := &Audio{Data: audioBytes, Format: output.Format, SampleRate: output.SampleRate}
+	if output.Format == "mp3" {
+		// 直接合成的 mp3 不经过 Convert, 时长按帧头算出来
+		result.Length = audio.MP3Duration(audioBytes)
+	}
+	return result, nil
+}
+
+// Synthesize 使用当前的语速和音量调用合成后端, voice 为空时使用当前音色
+// 后端不能直接合成当前的输出格式时在这里转换
+func (config *TTSConfig) Synthesize(synth Synthesizer, text string, voice string, emotion Emotion) (*Audio, error) {
+	config.StateMutex.Lock()
+	if voice == "" {
+		voice = config.Voice
+	}
+	req := Request{
+		Text:    text,
+		Voice:   voice,
+		Speed:   config.Speed,
+		Volume:  config.Volume,
+		Output:  config.Output,
+		Emotion: emotion,
+	}
+	config.StateMutex.Unlock()
+	audio, err := synth.Synthesize(req)
+	if err != nil {
+		return nil, err
+	}
+	converted, err := Convert(audio, req.Output)
+	if err != nil {
+		return nil, fmt.Errorf("转换音频格式失败: %v", err)
+	}
+	return converted, nil
 }
 
 func (t *TTSClient) GetBytes(response *tts.TextToVoiceResponse) ([]byte, error) {
+	if response == nil || response.Response == nil || response.Response.Audio == nil {
+		return nil, fmt.Errorf("ttsResponse中没有音频数据")
+	}
 	audioStr := *response.Response.Audio
 	audioBytes, err := base64.StdEncoding.DecodeString(audioStr)
 	if err != nil {
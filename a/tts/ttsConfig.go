@@ -3,8 +3,10 @@ package tts
 import "sync"
 
 type TTSConfig struct {
+	Voice      string // 为空时使用合成后端的默认音色
 	Volume     float64
 	Speed      float64
+	Output     OutputFormat // 发给前端的音频格式
 	StateMutex sync.Mutex
 }
 
@@ -12,5 +14,40 @@ func InitTTSConfig() *TTSConfig {
 	config := TTSConfig{}
 	config.Volume = 5.0
 	config.Speed = 0.0
+	config.Output = DefaultOutputFormat
 	return &config
 }
+
+// Apply 切换音色, speed 和 volume 为 nil 时保持不变
+func (config *TTSConfig) Apply(voice string, speed, volume *float64) {
+	config.StateMutex.Lock()
+	defer config.StateMutex.Unlock()
+	config.Voice = voice
+	if speed != nil {
+		config.Speed = *speed
+	}
+	if volume != nil {
+		config.Volume = *volume
+	}
+}
+
+// SetOutput 切换输出格式, f 应先经过 CheckOutputFormat
+func (config *TTSConfig) SetOutput(f OutputFormat) {
+	config.StateMutex.Lock()
+	defer config.StateMutex.Unlock()
+	config.Output = f
+}
+
+// SetVoice 切换音色, 语速和音量不变
+func (config *TTSConfig) SetVoice(voice string) {
+	config.StateMutex.Lock()
+	defer config.StateMutex.Unlock()
+	config.Voice = voice
+}
+
+// Settings 当前的音色、语速和音量
+func (config *TTSConfig) Settings() (voice string, speed, volume float64) {
+	config.StateMutex.Lock()
+	defer config.StateMutex.Unlock()
+	return config.Voice, config.Speed, config.Volume
+}
@@ -0,0 +1,47 @@
+package tts
+
+import "testing"
+
+func TestTencentSupportsEmotion(t *testing.T) {
+	for _, tc := range []struct {
+		voice, category string
+		want            bool
+	}{
+		{"爱小溪", "happy", true},
+		{"601000", "sajiao", true},
+		{"爱小辰", "news", false}, // 腾讯云有, 但不在常用的情感里
+		{"温柔女声", "happy", false},
+		{"", "happy", false}, // 默认音色是温柔女声
+		{"不存在的音色", "happy", false},
+	} {
+		if got := tencentSupportsEmotion(tc.voice, tc.category); got != tc.want {
+			t.Errorf("%s 是否支持 %s: %v, 应为 %v", tc.voice, tc.category, got, tc.want)
+		}
+	}
+}
+
+func TestTencentRequestEmotion(t *testing.T) {
+	output := OutputFormat{Format: "wav", SampleRate: 16000}
+
+	request := tencentRequest(Request{Text: "你好", Voice: "爱小溪", Emotion: Emotion{Category: "happy", Intensity: 150}}, output)
+	if request.EmotionCategory == nil || *request.EmotionCategory != "happy" ||
+		request.EmotionIntensity == nil || *request.EmotionIntensity != 150 {
+		t.Errorf("多情感音色应带上情感: %v %v", request.EmotionCategory, request.EmotionIntensity)
+	}
+	if *request.VoiceType != 601000 {
+		t.Errorf("音色 %d, 应为 601000", *request.VoiceType)
+	}
+
+	request = tencentRequest(Request{Text: "你好", Voice: "爱小溪", Emotion: Emotion{Category: "sad"}}, output)
+	if request.EmotionCategory == nil || *request.EmotionCategory != "sad" || request.EmotionIntensity != nil {
+		t.Errorf("没有指定程度时只带情感: %v %v", request.EmotionCategory, request.EmotionIntensity)
+	}
+
+	// 不支持情感的音色按中性合成, 不能带上情感参数, 否则腾讯云会报错
+	for _, voice := range []string{"温柔女声", ""} {
+		request = tencentRequest(Request{Text: "你好", Voice: voice, Emotion: Emotion{Category: "happy", Intensity: 150}}, output)
+		if request.EmotionCategory != nil || request.EmotionIntensity != nil {
+			t.Errorf("%q 不支持情感, 却带上了 %v %v", voice, request.EmotionCategory, request.EmotionIntensity)
+		}
+	}
+}
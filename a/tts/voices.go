@@ -0,0 +1,84 @@
+package tts
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+// Voice 音色目录中的一项
+type Voice struct {
+	ID       string   `json:"id"`                 // 合成后端的音色编号, voice 消息和角色设定里用它选择音色
+	Name     string   `json:"name"`               // 显示名称, 也可以用来选择音色
+	Gender   string   `json:"gender"`             // female, male
+	Language string   `json:"language"`           // zh, en
+	Emotions []string `json:"emotions,omitempty"` // 支持的情感, 为空时只有中性
+}
+
+// VoiceCatalog 能列出可选音色的合成后端, 第一个是默认音色
+type VoiceCatalog interface {
+	Voices() []Voice
+}
+
+// Voices 合成后端的音色目录, 后端不提供时为空
+func Voices(synth Synthesizer) []Voice {
+	if catalog, ok := synth.(VoiceCatalog); ok {
+		return catalog.Voices()
+	}
+	return nil
+}
+
+// FindVoice 按编号或显示名称查找音色, 为空时返回默认音色
+func FindVoice(voices []Voice, key string) (Voice, bool) {
+	if len(voices) == 0 {
+		return Voice{}, false
+	}
+	if key == "" {
+		return voices[0], true
+	}
+	for _, v := range voices {
+		if v.ID == key || v.Name == key {
+			return v, true
+		}
+	}
+	return Voice{}, false
+}
+
+// VoicesHandler 以 JSON 返回音色目录
+func VoicesHandler(synth Synthesizer) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "只支持 GET", http.StatusMethodNotAllowed)
+			return
+		}
+		voices := Voices(synth)
+		if voices == nil {
+			voices = []Voice{}
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(voices)
+	})
+}
+
+// 腾讯云多情感音色支持的情感, 取值见 setRequest 中 EmotionCategory 的说明
+var tencentEmotions = []string{"neutral", "sad", "happy", "angry", "fear", "sajiao", "amaze", "disgusted", "peaceful"}
+
+// tencentVoices 常用的腾讯云音色, 编号即 VoiceType, 完整列表见腾讯云语音合成文档
+// 前三个沿用早期的名称, 角色设定里写的 "标准女声" 等仍然有效
+var tencentVoices = []Voice{
+	{ID: "1003", Name: "温柔女声", Gender: "female", Language: "zh"},
+	{ID: "1001", Name: "标准女声", Gender: "female", Language: "zh"},
+	{ID: "1002", Name: "标准男声", Gender: "male", Language: "zh"},
+	{ID: "1050", Name: "WeJack", Gender: "male", Language: "en"},
+	{ID: "1051", Name: "WeRose", Gender: "female", Language: "en"},
+	{ID: "601000", Name: "爱小溪", Gender: "female", Language: "zh", Emotions: tencentEmotions},
+	{ID: "601001", Name: "爱小洛", Gender: "female", Language: "zh", Emotions: tencentEmotions},
+	{ID: "601002", Name: "爱小辰", Gender: "male", Language: "zh", Emotions: tencentEmotions},
+	{ID: "601004", Name: "爱小树", Gender: "male", Language: "zh", Emotions: tencentEmotions},
+}
+
+// offlineVoices 离线后端只能区分男声和女声
+var offlineVoices = []Voice{
+	{ID: "温柔女声", Name: "温柔女声", Gender: "female", Language: "zh"},
+	{ID: "标准女声", Name: "标准女声", Gender: "female", Language: "zh"},
+	{ID: "标准男声", Name: "标准男声", Gender: "male", Language: "zh"},
+}
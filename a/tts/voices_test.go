@@ -0,0 +1,63 @@
+package tts
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// getVoices 请求音色目录, 返回状态码和原始内容
+func getVoices(t *testing.T, synth Synthesizer, method string) (int, string) {
+	t.Helper()
+	w := httptest.NewRecorder()
+	VoicesHandler(synth).ServeHTTP(w, httptest.NewRequest(method, "/api/voices", nil))
+	return w.Code, w.Body.String()
+}
+
+func TestVoicesHandler(t *testing.T) {
+	for _, tc := range []struct {
+		name  string
+		synth Synthesizer
+		want  []Voice
+	}{
+		{"离线", NewToneSynthesizer(), offlineVoices},
+		// 分段合成包装后仍是腾讯云的目录, 带着多情感音色的情感
+		{"腾讯云", NewSegmentedSynthesizer(&TencentSynthesizer{}, TencentTextLimit), tencentVoices},
+	} {
+		code, body := getVoices(t, tc.synth, http.MethodGet)
+		var got []Voice
+		if err := json.Unmarshal([]byte(body), &got); code != http.StatusOK || err != nil {
+			t.Fatalf("%s: %d %s", tc.name, code, body)
+		}
+		if !slices.EqualFunc(got, tc.want, func(a, b Voice) bool {
+			return a.ID == b.ID && a.Name == b.Name && a.Gender == b.Gender && slices.Equal(a.Emotions, b.Emotions)
+		}) {
+			t.Errorf("%s: 音色目录 %+v", tc.name, got)
+		}
+	}
+
+	// 没有目录的后端返回空数组, 不是 null
+	if code, body := getVoices(t, nativeMP3{}, http.MethodGet); code != http.StatusOK || strings.TrimSpace(body) != "[]" {
+		t.Errorf("没有音色目录时应返回 [], 得到 %d %s", code, body)
+	}
+	if code, _ := getVoices(t, NewToneSynthesizer(), http.MethodPost); code != http.StatusMethodNotAllowed {
+		t.Errorf("POST 应返回 405, 得到 %d", code)
+	}
+}
+
+func TestFindVoice(t *testing.T) {
+	for _, key := range []string{"601000", "爱小溪"} {
+		if v, ok := FindVoice(tencentVoices, key); !ok || v.ID != "601000" {
+			t.Errorf("按 %q 找到 %+v", key, v)
+		}
+	}
+	if v, ok := FindVoice(tencentVoices, ""); !ok || v.ID != tencentVoices[0].ID {
+		t.Errorf("为空时应返回默认音色, 得到 %+v", v)
+	}
+	if _, ok := FindVoice(tencentVoices, "不存在"); ok {
+		t.Error("不在目录里的音色不应找到")
+	}
+}